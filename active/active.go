@@ -129,7 +129,8 @@ func (src *GCSSource) CancelStreaming() {
 	src.ctx.cancel()
 }
 
-// Next implements RunnableSource.  It returns
+// Next implements RunnableSource.  The Runnables implement ObjectRunnable.
+// It returns
 //    the next pending job to run, OR
 //    iterator.Done OR
 //    ctx.Err() OR
@@ -189,6 +190,6 @@ func (src *GCSSource) streamToPending(ctx context.Context) {
 		}
 		debug.Printf("Adding gs://%s/%s", f.Bucket, f.Name)
 		// Blocks until consumer reads channel.
-		src.pendingChan <- src.toRunnable(f)
+		src.pendingChan <- &objectRunnable{Runnable: src.toRunnable(f), obj: f}
 	}
 }
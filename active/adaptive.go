@@ -0,0 +1,196 @@
+package active
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// TokenCapacity reports the current capacity of the AdaptiveTokenSource.
+var TokenCapacity = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "etl_active_token_capacity",
+		Help: "Current capacity of the adaptive token source.",
+	},
+)
+
+// adaptiveDecrease is the multiplicative decrease applied to the capacity
+// when the backend error count increases.
+const adaptiveDecrease = 0.75
+
+// ErrorSignal returns a cumulative count of backend errors.  An increase in
+// the count between adjustments causes the AdaptiveTokenSource to reduce its
+// capacity.
+type ErrorSignal func() float64
+
+// CounterSignal returns an ErrorSignal that sums the values of the named
+// counter in the default prometheus registry, for all series that match the
+// labels.  A nil labels map matches all series.
+func CounterSignal(name string, labels map[string]string) ErrorSignal {
+	return func() float64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			return 0
+		}
+		sum := 0.0
+		for _, mf := range families {
+			if mf.GetName() != name {
+				continue
+			}
+		metric:
+			for _, m := range mf.GetMetric() {
+				for _, lp := range m.GetLabel() {
+					if v, ok := labels[lp.GetName()]; ok && v != lp.GetValue() {
+						continue metric
+					}
+				}
+				sum += m.GetCounter().GetValue()
+			}
+		}
+		return sum
+	}
+}
+
+// DefaultErrorSignals returns the signals that indicate the pipeline is
+// overloading its backends: BigQuery quota errors, transient GCS read errors,
+// and annotation errors.  Corrupt archives and successful resumes are also
+// counted by etl_gcs_retry_count, but don't indicate load, so they are
+// excluded.
+func DefaultErrorSignals() []ErrorSignal {
+	return []ErrorSignal{
+		CounterSignal("etl_warning_count", map[string]string{"kind": "Quota Exceeded"}),
+		CounterSignal("etl_gcs_retry_count", map[string]string{"status": "stream error"}),
+		CounterSignal("etl_gcs_retry_count", map[string]string{"phase": "range read"}),
+		CounterSignal("etl_annotator_Error_Count", nil),
+	}
+}
+
+// AdaptiveTokenSource is a TokenSource whose capacity adapts to backend errors,
+// using additive increase, multiplicative decrease (AIMD).  The capacity is
+// reduced whenever the error signals increase, and increased while the
+// source is healthy and fully used.
+// It is THREAD-SAFE.
+type AdaptiveTokenSource struct {
+	min, max int
+	increase float64
+	signals  []ErrorSignal
+
+	lock       sync.Mutex
+	capacity   float64
+	inUse      int
+	lastErrors float64
+	changed    chan struct{} // Closed whenever inUse or capacity changes.
+}
+
+// NewAdaptiveTokenSource returns an AdaptiveTokenSource with capacity between
+// min and max, starting at min.
+func NewAdaptiveTokenSource(min, max int, signals ...ErrorSignal) *AdaptiveTokenSource {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	increase := float64(max-min) / 20
+	if increase < 1 {
+		increase = 1
+	}
+	ts := &AdaptiveTokenSource{
+		min: min, max: max, increase: increase, signals: signals,
+		capacity: float64(min), changed: make(chan struct{}),
+	}
+	ts.lastErrors = ts.errors()
+	TokenCapacity.Set(ts.capacity)
+	return ts
+}
+
+// notify wakes any goroutines waiting in Acquire.  Caller must hold the lock.
+func (ts *AdaptiveTokenSource) notify() {
+	close(ts.changed)
+	ts.changed = make(chan struct{})
+}
+
+// Acquire acquires an admission token, blocking until one is available or the
+// context is done.
+func (ts *AdaptiveTokenSource) Acquire(ctx context.Context) error {
+	for {
+		ts.lock.Lock()
+		if ts.inUse < int(ts.capacity) {
+			ts.inUse++
+			ts.lock.Unlock()
+			return nil
+		}
+		changed := ts.changed
+		ts.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release releases an admission token.
+func (ts *AdaptiveTokenSource) Release() {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.inUse--
+	ts.notify()
+}
+
+// Capacity returns the current number of tokens.
+func (ts *AdaptiveTokenSource) Capacity() int {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return int(ts.capacity)
+}
+
+func (ts *AdaptiveTokenSource) errors() float64 {
+	total := 0.0
+	for _, s := range ts.signals {
+		total += s()
+	}
+	return total
+}
+
+// Adjust updates the capacity based on the error signals since the last call.
+func (ts *AdaptiveTokenSource) Adjust() {
+	total := ts.errors()
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if total > ts.lastErrors {
+		ts.capacity *= adaptiveDecrease
+		if ts.capacity < float64(ts.min) {
+			ts.capacity = float64(ts.min)
+		}
+	} else if ts.inUse >= int(ts.capacity) {
+		// Only grow when all tokens are in use, so that the capacity
+		// reflects demonstrated demand.
+		ts.capacity += ts.increase
+		if ts.capacity > float64(ts.max) {
+			ts.capacity = float64(ts.max)
+		}
+	}
+	ts.lastErrors = total
+	TokenCapacity.Set(ts.capacity)
+	ts.notify()
+}
+
+// Run calls Adjust every period, until the context is done.
+func (ts *AdaptiveTokenSource) Run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ts.Adjust()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package active_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/api/iterator"
+
+	"github.com/m-lab/etl/active"
+	"github.com/m-lab/etl/metrics"
+)
+
+func tryAcquire(ts active.TokenSource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	return ts.Acquire(ctx)
+}
+
+func TestAdaptiveTokenSource(t *testing.T) {
+	errCount := 0.0
+	signal := func() float64 { return errCount }
+	ts := active.NewAdaptiveTokenSource(2, 22, signal)
+	if ts.Capacity() != 2 {
+		t.Fatal("Should start at min", ts.Capacity())
+	}
+	for i := 0; i < 2; i++ {
+		if err := tryAcquire(ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tryAcquire(ts); err != context.DeadlineExceeded {
+		t.Fatal("Should block at capacity", err)
+	}
+
+	// Healthy and fully used, so it should grow by (22-2)/20.
+	ts.Adjust()
+	if ts.Capacity() != 3 {
+		t.Error("Should have grown", ts.Capacity())
+	}
+	if err := tryAcquire(ts); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		ts.Adjust()
+	}
+	if ts.Capacity() != 4 {
+		t.Error("Should not grow when tokens are unused", ts.Capacity())
+	}
+
+	// Errors should shrink the capacity, but not below min.
+	for i := 0; i < 10; i++ {
+		errCount++
+		ts.Adjust()
+	}
+	if ts.Capacity() != 2 {
+		t.Error("Should have shrunk to min", ts.Capacity())
+	}
+	// Three tokens are still in use.
+	if err := tryAcquire(ts); err != context.DeadlineExceeded {
+		t.Error("Should block while over capacity", err)
+	}
+	ts.Release()
+	if err := tryAcquire(ts); err != context.DeadlineExceeded {
+		t.Error("Should block at capacity", err)
+	}
+	ts.Release()
+	if err := tryAcquire(ts); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdaptiveThrottledSource(t *testing.T) {
+	src := source{count: 5, stats: newThrottleStats(100)}
+	ts := active.Throttle(&src, active.NewAdaptiveTokenSource(2, 10))
+
+	eg, err := runAll(context.Background(), ts)
+	if err != iterator.Done {
+		t.Fatal("Expected iterator.Done", err)
+	}
+	if err = eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if src.stats.done() != 5 {
+		t.Error("Should have been 5 runnables", src.stats.done())
+	}
+	if src.stats.max() > 2 {
+		t.Error("Max running > 2", src.stats.max())
+	}
+}
+
+func TestCounterSignal(t *testing.T) {
+	c := promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "etl_test_counter_signal",
+		Help: "Counter for TestCounterSignal.",
+	}, []string{"kind"})
+	c.WithLabelValues("a").Add(2)
+	c.WithLabelValues("b").Add(3)
+
+	if v := active.CounterSignal("etl_test_counter_signal", nil)(); v != 5 {
+		t.Error("Expected 5, got", v)
+	}
+	if v := active.CounterSignal("etl_test_counter_signal", map[string]string{"kind": "b"})(); v != 3 {
+		t.Error("Expected 3, got", v)
+	}
+	if v := active.CounterSignal("etl_no_such_counter", nil)(); v != 0 {
+		t.Error("Expected 0, got", v)
+	}
+}
+
+func TestDefaultErrorSignals(t *testing.T) {
+	ts := active.NewAdaptiveTokenSource(2, 22, active.DefaultErrorSignals()...)
+	for i := 0; i < 2; i++ {
+		if err := tryAcquire(ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts.Adjust()
+	if ts.Capacity() != 3 {
+		t.Fatal("Should have grown", ts.Capacity())
+	}
+	if err := tryAcquire(ts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt archives and successful resumes don't indicate load.
+	metrics.GCSRetryCount.WithLabelValues("test", "next", "1", "corrupt archive").Inc()
+	metrics.GCSRetryCount.WithLabelValues("test", "resume", "1", "ok").Inc()
+	ts.Adjust()
+	if ts.Capacity() != 4 {
+		t.Error("Should have grown", ts.Capacity())
+	}
+
+	// Transient read errors do.
+	for _, lv := range [][]string{
+		{"test", "read", "1", "stream error"},
+		{"test", "range read", "1", "error"},
+	} {
+		before := ts.Capacity()
+		metrics.GCSRetryCount.WithLabelValues(lv...).Inc()
+		ts.Adjust()
+		if ts.Capacity() >= before {
+			t.Error("Should have shrunk after", lv, ts.Capacity())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package active
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/m-lab/etl/etl"
+)
+
+// MemoryReserved reports the memory reserved by running tasks.
+var MemoryReserved = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "etl_active_memory_reserved_bytes",
+		Help: "Estimated memory reserved by running tasks.",
+	},
+)
+
+// ArchiveWeight estimates the memory needed to process an archive, from its
+// compressed size and the expansion factor for its datatype.
+func ArchiveWeight(o *storage.ObjectAttrs) int64 {
+	factor := 1.0
+	dp, err := etl.ValidateTestPath(fmt.Sprintf("gs://%s/%s", o.Bucket, o.Name))
+	if err == nil {
+		factor = dp.GetDataType().ExpansionFactor()
+	}
+	return int64(float64(o.Size) * factor)
+}
+
+// MemoryTokenSource limits the total estimated memory of running tasks.
+// Unlike a TokenSource, each acquisition is weighted by the object processed.
+type MemoryTokenSource struct {
+	sem    *semaphore.Weighted
+	budget int64
+	weight func(*storage.ObjectAttrs) int64
+}
+
+// NewMemoryTokenSource returns a MemoryTokenSource with a budget in bytes.
+// If weight is nil, ArchiveWeight is used.
+func NewMemoryTokenSource(budget int64, weight func(*storage.ObjectAttrs) int64) *MemoryTokenSource {
+	if weight == nil {
+		weight = ArchiveWeight
+	}
+	return &MemoryTokenSource{sem: semaphore.NewWeighted(budget), budget: budget, weight: weight}
+}
+
+// Acquire blocks until there is enough memory to process the object, and
+// returns the amount acquired, which must be passed to Release.  Objects
+// larger than the budget acquire the entire budget, so they run alone.
+func (ms *MemoryTokenSource) Acquire(ctx context.Context, o *storage.ObjectAttrs) (int64, error) {
+	w := ms.weight(o)
+	if w > ms.budget {
+		w = ms.budget
+	}
+	if w < 1 {
+		w = 1
+	}
+	if err := ms.sem.Acquire(ctx, w); err != nil {
+		return 0, err
+	}
+	MemoryReserved.Add(float64(w))
+	return w, nil
+}
+
+// Release releases memory acquired by Acquire.
+func (ms *MemoryTokenSource) Release(w int64) {
+	MemoryReserved.Sub(float64(w))
+	ms.sem.Release(w)
+}
+
+// ObjectRunnable is a Runnable that processes a GCS object.
+type ObjectRunnable interface {
+	Runnable
+	Object() *storage.ObjectAttrs
+}
+
+// objectRunnable associates a Runnable with the object it processes.
+type objectRunnable struct {
+	Runnable
+	obj *storage.ObjectAttrs
+}
+
+func (r *objectRunnable) Object() *storage.ObjectAttrs {
+	return r.obj
+}
+
+// memoryThrottledSource encapsulates a Source and a MemoryTokenSource.
+type memoryThrottledSource struct {
+	RunnableSource
+	memory *MemoryTokenSource
+}
+
+// Next implements Source.Next
+func (ms *memoryThrottledSource) Next(ctx context.Context) (Runnable, error) {
+	next, err := ms.RunnableSource.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	or, ok := next.(ObjectRunnable)
+	if !ok {
+		return next, nil
+	}
+	// We want Next to block here until there is enough memory.
+	w, err := ms.memory.Acquire(ctx, or.Object())
+	if err != nil {
+		return nil, err
+	}
+	return &throttledRunnable{
+		Runnable: next,
+		release:  func() { ms.memory.Release(w) }}, nil
+}
+
+// ThrottleMemory applies a MemoryTokenSource to throttle a Source.  Only
+// ObjectRunnables, such as those from a GCSSource, are throttled.
+func ThrottleMemory(src RunnableSource, memory *MemoryTokenSource) RunnableSource {
+	return &memoryThrottledSource{
+		RunnableSource: src,
+		memory:         memory}
+}
@@ -0,0 +1,88 @@
+package active_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+
+	"github.com/m-lab/etl/active"
+)
+
+func TestArchiveWeight(t *testing.T) {
+	ndt := &storage.ObjectAttrs{Bucket: "m-lab-sandbox",
+		Name: "ndt/2016/01/26/20160126T000000Z-mlab1-prg01-ndt-0007.tgz", Size: 1000}
+	if w := active.ArchiveWeight(ndt); w != 10000 {
+		t.Error("Expected NDT weight 10000, got", w)
+	}
+	unknown := &storage.ObjectAttrs{Bucket: "foobar", Name: "obj1", Size: 1000}
+	if w := active.ArchiveWeight(unknown); w != 1000 {
+		t.Error("Expected unknown weight 1000, got", w)
+	}
+}
+
+func TestMemoryTokenSource(t *testing.T) {
+	ms := active.NewMemoryTokenSource(100, func(o *storage.ObjectAttrs) int64 { return o.Size })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	w1, err := ms.Acquire(ctx, &storage.ObjectAttrs{Size: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Acquire(ctx, &storage.ObjectAttrs{Size: 60}); err != context.DeadlineExceeded {
+		t.Error("Should block when over budget", err)
+	}
+	ms.Release(w1)
+
+	// Objects larger than the budget take the whole budget.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	w, err := ms.Acquire(ctx, &storage.ObjectAttrs{Size: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 100 {
+		t.Error("Expected weight 100, got", w)
+	}
+	ms.Release(w)
+}
+
+func TestThrottleMemory(t *testing.T) {
+	stats := newThrottleStats(100)
+	sizes := []int64{50, 50, 50, 100, 10, 10}
+	lister := func(ctx context.Context) ([]*storage.ObjectAttrs, int64, error) {
+		objs := make([]*storage.ObjectAttrs, len(sizes))
+		for i := range sizes {
+			objs[i] = &storage.ObjectAttrs{Bucket: "foobar", Name: "obj", Size: sizes[i]}
+		}
+		return objs, 0, nil
+	}
+	toRunnable := func(o *storage.ObjectAttrs) active.Runnable {
+		return &statsRunnable{stats}
+	}
+	ctx := context.Background()
+	src, err := active.NewGCSSource(ctx, "test", lister, toRunnable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The budget allows at most two of the larger objects at once.
+	ms := active.NewMemoryTokenSource(100, func(o *storage.ObjectAttrs) int64 { return o.Size })
+	ts := active.Throttle(active.ThrottleMemory(src, ms), active.NewWSTokenSource(10))
+
+	eg, err := runAll(ctx, ts)
+	if err != iterator.Done {
+		t.Fatal("Expected iterator.Done", err)
+	}
+	if err = eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if stats.done() != len(sizes) {
+		t.Error("Expected", len(sizes), "runnables, got", stats.done())
+	}
+	if stats.max() > 2 {
+		t.Error("Max running > 2", stats.max())
+	}
+}
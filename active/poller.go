@@ -3,11 +3,15 @@ package active
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"math/rand"
 	"net/url"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -21,9 +25,19 @@ import (
 	"github.com/m-lab/etl-gardener/tracker"
 	"github.com/m-lab/go/rtx"
 
+	"github.com/m-lab/etl/etl"
 	"github.com/m-lab/etl/metrics"
 )
 
+var (
+	// MaxRetries is the number of times a Runnable is retried after a
+	// retryable error.
+	MaxRetries = 3
+	// RetryBaseDelay is the delay before the first retry.  It doubles for
+	// each subsequent retry.
+	RetryBaseDelay = 10 * time.Second
+)
+
 // JobFailures counts the all errors that result in test loss.
 //
 // Provides metrics:
@@ -43,6 +57,7 @@ var JobFailures = promauto.NewCounterVec(
 type GardenerAPI struct {
 	trackerBase url.URL
 	gcs         stiface.Client
+	memory      *MemoryTokenSource // Optional limit on memory of running tasks.
 }
 
 // NewGardenerAPI creates a GardenerAPI.
@@ -50,6 +65,12 @@ func NewGardenerAPI(trackerBase url.URL, gcs stiface.Client) *GardenerAPI {
 	return &GardenerAPI{trackerBase: trackerBase, gcs: gcs}
 }
 
+// LimitMemory limits the estimated memory of all running tasks.  It should be
+// called before Poll.
+func (g *GardenerAPI) LimitMemory(memory *MemoryTokenSource) {
+	g.memory = memory
+}
+
 // MustStorageClient creates a default GCS client.
 func MustStorageClient(ctx context.Context) stiface.Client {
 	c, err := storage.NewClient(ctx, option.WithScopes(storage.ScopeReadOnly))
@@ -89,9 +110,87 @@ func postAndIgnoreResponse(ctx context.Context, url url.URL) error {
 	return nil
 }
 
+// IsRetryable returns true if err is a ProcessingError with a status code
+// that indicates a transient failure.
+func IsRetryable(err error) bool {
+	var pErr etl.ProcessingError
+	if !errors.As(err, &pErr) {
+		return false
+	}
+	switch pErr.Code() {
+	case http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// FailedFiles collects the files that could not be processed.
+// It is THREAD-SAFE.
+type FailedFiles struct {
+	lock  sync.Mutex
+	files []string
+}
+
+// Add adds a file to the list.
+func (ff *FailedFiles) Add(file string) {
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+	ff.files = append(ff.files, file)
+}
+
+// Files returns the failed files.
+func (ff *FailedFiles) Files() []string {
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+	return append([]string{}, ff.files...)
+}
+
+// Detail returns a summary of the failed files, suitable for a tracker update.
+func (ff *FailedFiles) Detail() string {
+	files := ff.Files()
+	const maxFiles = 10
+	if len(files) > maxFiles {
+		return fmt.Sprintf("%d files failed: %s, ...", len(files), strings.Join(files[:maxFiles], ", "))
+	}
+	return fmt.Sprintf("%d files failed: %s", len(files), strings.Join(files, ", "))
+}
+
+// runWithRetry runs r, retrying with exponential backoff while it returns a
+// retryable error, up to MaxRetries times.  If r is throttled, the retries
+// run the wrapped Runnable, so the throttle tokens are held until the last
+// attempt completes, and released only once.
+func runWithRetry(ctx context.Context, label string, r Runnable) error {
+	if w, ok := r.(wrappedRunnable); ok {
+		return w.RunWrapped(func(inner Runnable) error {
+			return runWithRetry(ctx, label, inner)
+		})
+	}
+	delay := RetryBaseDelay
+	for retries := 0; ; retries++ {
+		err := r.Run()
+		if err == nil || !IsRetryable(err) || retries >= MaxRetries {
+			return err
+		}
+		log.Println("Retrying", r.Info(), "after", err)
+		metrics.ActiveErrors.WithLabelValues(label, "retry").Inc()
+
+		// Use some randomness to reduce risk of synchronization across tasks.
+		jittered := time.Duration(float64(delay) * (0.5 + rand.Float64()))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jittered):
+		}
+		delay *= 2
+	}
+}
+
 // RunAll will execute functions provided by Next() until there are no more,
-// or the context is canceled.
-func (g *GardenerAPI) RunAll(ctx context.Context, rSrc RunnableSource, job tracker.Job) (*errgroup.Group, error) {
+// or the context is canceled.  Runnables that fail with a retryable error are
+// retried.  Runnables that still fail are added to failed, if not nil.
+func (g *GardenerAPI) RunAll(ctx context.Context, rSrc RunnableSource, job tracker.Job, failed *FailedFiles) (*errgroup.Group, error) {
 	eg := &errgroup.Group{}
 	for {
 		run, err := rSrc.Next(ctx)
@@ -111,12 +210,18 @@ func (g *GardenerAPI) RunAll(ctx context.Context, rSrc RunnableSource, job track
 			metrics.ActiveTasks.WithLabelValues(rSrc.Label()).Inc()
 			defer metrics.ActiveTasks.WithLabelValues(rSrc.Label()).Dec()
 
-			err := run.Run()
+			err := runWithRetry(ctx, rSrc.Label(), run)
 			if err == nil {
 				update := tracker.UpdateURL(g.trackerBase, job, tracker.Parsing, run.Info())
 				if postErr := postAndIgnoreResponse(ctx, *update); postErr != nil {
 					log.Println(postErr, "on update for", job.Path())
 				}
+			} else {
+				log.Println("Failed", run.Info(), err)
+				metrics.ActiveErrors.WithLabelValues(rSrc.Label(), "failed").Inc()
+				if failed != nil {
+					failed.Add(run.Info())
+				}
 			}
 			return err
 		}
@@ -160,7 +265,11 @@ func (g *GardenerAPI) pollAndRun(ctx context.Context,
 	if err != nil {
 		return err
 	}
-	src := Throttle(gcsSource, tokens)
+	var src RunnableSource = gcsSource
+	if g.memory != nil {
+		src = ThrottleMemory(src, g.memory)
+	}
+	src = Throttle(src, tokens)
 
 	log.Println("Running", job.Path())
 
@@ -169,7 +278,8 @@ func (g *GardenerAPI) pollAndRun(ctx context.Context,
 		log.Println(postErr)
 	}
 
-	eg, err := g.RunAll(ctx, src, job.Job)
+	failed := &FailedFiles{}
+	eg, err := g.RunAll(ctx, src, job.Job, failed)
 
 	// Once all are dispatched, we want to wait until all have completed
 	// before posting the state change.
@@ -178,6 +288,12 @@ func (g *GardenerAPI) pollAndRun(ctx context.Context,
 		eg.Wait()
 		log.Println("finished", job.Path())
 		update := tracker.UpdateURL(g.trackerBase, job.Job, tracker.ParseComplete, "")
+		if files := failed.Files(); len(files) > 0 {
+			log.Println(job.Path(), "failed files:", files)
+			JobFailures.WithLabelValues(
+				job.Experiment+"/"+job.Datatype, job.Date.Format("2006"), "files").Inc()
+			update = tracker.UpdateURL(g.trackerBase, job.Job, tracker.Failed, failed.Detail())
+		}
 		// TODO - should this have a retry?
 		if postErr := postAndIgnoreResponse(ctx, *update); postErr != nil {
 			log.Println(postErr)
@@ -187,18 +303,18 @@ func (g *GardenerAPI) pollAndRun(ctx context.Context,
 	return err
 }
 
-// Poll requests work items from gardener, and processes them.
+// Poll requests work items from gardener, and processes them.  The tokens
+// limit the number of concurrent tasks across all jobs.
 func (g *GardenerAPI) Poll(ctx context.Context,
-	toRunnable func(o *storage.ObjectAttrs) Runnable, maxWorkers int, period time.Duration) {
+	toRunnable func(o *storage.ObjectAttrs) Runnable, tokens TokenSource, period time.Duration) {
 	// Poll no faster than period.
 	ticker := time.NewTicker(period)
-	throttle := NewWSTokenSource(maxWorkers)
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			err := g.pollAndRun(ctx, toRunnable, throttle)
+			err := g.pollAndRun(ctx, toRunnable, tokens)
 			if err != nil {
 				log.Println(err)
 			}
@@ -6,10 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/m-lab/etl-gardener/tracker"
 	"github.com/m-lab/etl/active"
 	"github.com/m-lab/go/rtx"
@@ -128,7 +130,8 @@ func TestGardenerAPI_RunAll(t *testing.T) {
 	p := newCounter(t)
 	src, err := g.JobFileSource(ctx, job.Job, p.toRunnable)
 	rtx.Must(err, "file source")
-	eg, err := g.RunAll(ctx, src, job.Job)
+	failed := &active.FailedFiles{}
+	eg, err := g.RunAll(ctx, src, job.Job, failed)
 	if err != iterator.Done {
 		t.Fatal(err)
 	}
@@ -152,6 +155,97 @@ func TestGardenerAPI_RunAll(t *testing.T) {
 	}
 }
 
+// codeError is a ProcessingError with an http status code.
+type codeError int
+
+func (e codeError) DataType() string { return "test" }
+func (e codeError) Detail() string   { return "test" }
+func (e codeError) Code() int        { return int(e) }
+func (e codeError) Error() string    { return http.StatusText(int(e)) }
+
+// flakyRunnable returns each of errs in turn, then succeeds.
+type flakyRunnable struct {
+	name string
+	errs []error
+	runs int
+}
+
+func (fr *flakyRunnable) Run() error {
+	fr.runs++
+	if len(fr.errs) > 0 {
+		err := fr.errs[0]
+		fr.errs = fr.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (fr *flakyRunnable) Info() string {
+	return fr.name
+}
+
+type sliceSource []active.Runnable
+
+func (ss *sliceSource) Next(ctx context.Context) (active.Runnable, error) {
+	if len(*ss) == 0 {
+		return nil, iterator.Done
+	}
+	next := (*ss)[0]
+	*ss = (*ss)[1:]
+	return next, nil
+}
+
+func (ss *sliceSource) Label() string {
+	return "test"
+}
+
+func TestGardenerAPI_RunAllRetries(t *testing.T) {
+	defer func(d time.Duration) { active.RetryBaseDelay = d }(active.RetryBaseDelay)
+	active.RetryBaseDelay = time.Millisecond
+
+	fg := fakeGardener{t: t, jobs: make([]tracker.Job, 0)}
+	server := httptest.NewServer(&fg)
+	defer server.Close()
+	tkURL, err := url.Parse(server.URL)
+	rtx.Must(err, "bad url")
+	g := active.NewGardenerAPI(*tkURL, testClient())
+
+	unavailable := codeError(http.StatusServiceUnavailable)
+	recovers := &flakyRunnable{name: "recovers", errs: []error{unavailable}}
+	persistent := &flakyRunnable{name: "persistent",
+		errs: []error{unavailable, unavailable, unavailable, unavailable}}
+	badRequest := &flakyRunnable{name: "bad request", errs: []error{codeError(http.StatusBadRequest)}}
+	src := sliceSource{recovers, persistent, badRequest}
+
+	failed := &active.FailedFiles{}
+	eg, err := g.RunAll(context.Background(), &src, tracker.Job{}, failed)
+	if err != iterator.Done {
+		t.Fatal(err)
+	}
+	if err = eg.Wait(); err == nil {
+		t.Error("Expected an error")
+	}
+
+	if recovers.runs != 2 {
+		t.Error("Should have retried once", recovers.runs)
+	}
+	if persistent.runs != active.MaxRetries+1 {
+		t.Error("Should have retried", active.MaxRetries, "times", persistent.runs)
+	}
+	if badRequest.runs != 1 {
+		t.Error("Should not retry bad request", badRequest.runs)
+	}
+	files := failed.Files()
+	if len(files) != 2 {
+		t.Fatal("Expected 2 failed files", files)
+	}
+	for _, f := range files {
+		if f != "persistent" && f != "bad request" {
+			t.Error("Unexpected failed file", f)
+		}
+	}
+}
+
 func TestGardenerAPI_Poll(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -172,7 +266,7 @@ func TestGardenerAPI_Poll(t *testing.T) {
 
 	// The test counter creates runnables for the jobs.
 	p := newCounter(t)
-	go g.Poll(ctx, p.toRunnable, 2, 100*time.Millisecond)
+	go g.Poll(ctx, p.toRunnable, active.NewWSTokenSource(2), 100*time.Millisecond)
 
 	time.Sleep(1000 * time.Millisecond)
 	cancel()
@@ -192,3 +286,80 @@ func TestGardenerAPI_Poll(t *testing.T) {
 		t.Error(&fg)
 	}
 }
+
+// loggedRunnable logs each run of a flakyRunnable.
+type loggedRunnable struct {
+	*flakyRunnable
+	lock *sync.Mutex
+	log  *[]string
+}
+
+func (lr *loggedRunnable) Run() error {
+	lr.lock.Lock()
+	*lr.log = append(*lr.log, lr.name)
+	lr.lock.Unlock()
+	time.Sleep(time.Millisecond)
+	return lr.flakyRunnable.Run()
+}
+
+func TestGardenerAPI_RunAllRetriesThrottled(t *testing.T) {
+	defer func(d time.Duration) { active.RetryBaseDelay = d }(active.RetryBaseDelay)
+	active.RetryBaseDelay = time.Millisecond
+
+	fg := fakeGardener{t: t, jobs: make([]tracker.Job, 0)}
+	server := httptest.NewServer(&fg)
+	defer server.Close()
+	tkURL, err := url.Parse(server.URL)
+	rtx.Must(err, "bad url")
+	g := active.NewGardenerAPI(*tkURL, testClient())
+
+	unavailable := codeError(http.StatusServiceUnavailable)
+	names := []string{"a", "b", "c"}
+	lister := func(ctx context.Context) ([]*storage.ObjectAttrs, int64, error) {
+		objs := make([]*storage.ObjectAttrs, len(names))
+		for i := range names {
+			objs[i] = &storage.ObjectAttrs{Bucket: "foobar", Name: names[i], Size: 10}
+		}
+		return objs, 0, nil
+	}
+	lock := sync.Mutex{}
+	runs := []string{}
+	toRunnable := func(o *storage.ObjectAttrs) active.Runnable {
+		return &loggedRunnable{&flakyRunnable{name: o.Name, errs: []error{unavailable, unavailable}}, &lock, &runs}
+	}
+	ctx := context.Background()
+	src, err := active.NewGCSSource(ctx, "test", lister, toRunnable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each object needs the whole memory budget, and there is one token, so
+	// the tasks, including their retries, must run one at a time.
+	ms := active.NewMemoryTokenSource(10, func(o *storage.ObjectAttrs) int64 { return 10 })
+	tokens := active.NewWSTokenSource(1)
+	ts := active.Throttle(active.ThrottleMemory(src, ms), tokens)
+
+	eg, err := g.RunAll(ctx, ts, tracker.Job{}, nil)
+	if err != iterator.Done {
+		t.Fatal(err)
+	}
+	if err = eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a,a,a,b,b,b,c,c,c"
+	if got := strings.Join(runs, ","); got != want {
+		t.Errorf("Runs = %s, want %s", got, want)
+	}
+	// The tokens and memory must each have been released exactly once.
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := tokens.Acquire(ctx); err != nil {
+		t.Error("Token not released", err)
+	}
+	if err := tokens.Acquire(ctx); err == nil {
+		t.Error("Token released more than once")
+	}
+	if _, err := ms.Acquire(ctx, &storage.ObjectAttrs{}); err != nil {
+		t.Error("Memory not released", err)
+	}
+}
@@ -2,6 +2,7 @@ package active
 
 import (
 	"context"
+	"sync"
 
 	"golang.org/x/sync/semaphore"
 )
@@ -38,19 +39,36 @@ type throttledSource struct {
 	throttle TokenSource
 }
 
+// wrappedRunnable is implemented by Runnables that hold a resource while
+// the Runnable they wrap runs.  RunWrapped runs it with run, which may call
+// Run several times, e.g. to retry, while the resource is held.
+type wrappedRunnable interface {
+	RunWrapped(run func(Runnable) error) error
+}
+
 // throttledRunnable encapsulates a Runnable and a token release function.
 type throttledRunnable struct {
 	Runnable
 	release func()
+	once    sync.Once // The token is released only once.
 }
 
 // Run implements Source.Run
 func (tr *throttledRunnable) Run() error {
 	// The run function must release the token when it completes.
-	defer tr.release()
+	defer tr.once.Do(tr.release)
 	return tr.Runnable.Run()
 }
 
+// RunWrapped implements wrappedRunnable, holding the token until run returns.
+func (tr *throttledRunnable) RunWrapped(run func(Runnable) error) error {
+	defer tr.once.Do(tr.release)
+	if w, ok := tr.Runnable.(wrappedRunnable); ok {
+		return w.RunWrapped(run)
+	}
+	return run(tr.Runnable)
+}
+
 // Next implements Source.Next
 func (ts *throttledSource) Next(ctx context.Context) (Runnable, error) {
 	// We want Next to block here until a throttle token is available.
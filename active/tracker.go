@@ -0,0 +1,299 @@
+package active
+
+// LocalTracker is a minimal in-process replacement for the Gardener job
+// tracker, for small deployments and integration tests.  It serves the same
+// /job, /heartbeat and /update endpoints, so GardenerAPI works unchanged
+// when pointed at it.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-lab/etl-gardener/tracker"
+)
+
+// ErrBadJobSpec is returned when a job spec can't be parsed.
+var ErrBadJobSpec = errors.New("invalid job spec")
+
+// JobConfig describes a range of dates to process for one datatype.
+type JobConfig struct {
+	Bucket     string
+	Experiment string
+	Datatype   string
+	Start      string // First date, as YYYY-MM-DD
+	End        string // Last date, as YYYY-MM-DD.  Defaults to Start.
+}
+
+// ParseJobSpec parses a job config of the form
+// "bucket,experiment,datatype,start[,end]".
+func ParseJobSpec(spec string) (JobConfig, error) {
+	fields := strings.Split(spec, ",")
+	if len(fields) < 4 || len(fields) > 5 {
+		return JobConfig{}, fmt.Errorf("%w: %q", ErrBadJobSpec, spec)
+	}
+	jc := JobConfig{Bucket: fields[0], Experiment: fields[1], Datatype: fields[2], Start: fields[3]}
+	if len(fields) == 5 {
+		jc.End = fields[4]
+	}
+	return jc, nil
+}
+
+// LoadJobConfigs reads a JSON list of JobConfigs from a file.
+func LoadJobConfigs(path string) ([]JobConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configs := []JobConfig{}
+	err = json.Unmarshal(data, &configs)
+	return configs, err
+}
+
+// jobs returns one Job for each date in the config.
+func (jc JobConfig) jobs() ([]tracker.Job, error) {
+	start, err := time.Parse("2006-01-02", jc.Start)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadJobSpec, err)
+	}
+	end := start
+	if jc.End != "" {
+		end, err = time.Parse("2006-01-02", jc.End)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadJobSpec, err)
+		}
+	}
+	if jc.Bucket == "" || jc.Experiment == "" || jc.Datatype == "" || end.Before(start) {
+		return nil, fmt.Errorf("%w: %+v", ErrBadJobSpec, jc)
+	}
+	jobs := []tracker.Job{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		jobs = append(jobs, tracker.NewJob(jc.Bucket, jc.Experiment, jc.Datatype, d))
+	}
+	return jobs, nil
+}
+
+// JobStatus is the status of a single job in the LocalTracker.
+type JobStatus struct {
+	Job        tracker.Job
+	State      tracker.State
+	Detail     string
+	Heartbeats int
+	Updated    time.Time
+}
+
+// LocalTracker hands out jobs in order, and tracks their progress.  If it has
+// a state file, progress is saved after every change, and restored when a new
+// LocalTracker is created, so completed jobs are not processed again.
+// It is THREAD-SAFE.
+type LocalTracker struct {
+	statePath string
+
+	lock sync.Mutex
+	jobs []*JobStatus
+}
+
+// NewLocalTracker creates a LocalTracker for the configured jobs.  If
+// statePath is not empty, state is restored from it, if it exists.
+func NewLocalTracker(configs []JobConfig, statePath string) (*LocalTracker, error) {
+	lt := &LocalTracker{statePath: statePath}
+	for _, jc := range configs {
+		jobs, err := jc.jobs()
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range jobs {
+			lt.jobs = append(lt.jobs, &JobStatus{Job: j, State: tracker.Init})
+		}
+	}
+	if statePath == "" {
+		return lt, nil
+	}
+	data, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return lt, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	saved := []*JobStatus{}
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	for _, s := range saved {
+		js := lt.find(s.Job)
+		if js == nil {
+			continue
+		}
+		*js = *s
+		if js.State != tracker.ParseComplete && js.State != tracker.Failed {
+			// The job was interrupted, so it must be restarted.
+			js.State = tracker.Init
+		}
+	}
+	return lt, nil
+}
+
+// find returns the status for the job, or nil.  Caller must hold the lock,
+// except during construction.
+func (lt *LocalTracker) find(j tracker.Job) *JobStatus {
+	for _, js := range lt.jobs {
+		if js.Job.Path() == j.Path() {
+			return js
+		}
+	}
+	return nil
+}
+
+// save writes the state file, if any.  Caller must hold the lock.
+func (lt *LocalTracker) save() {
+	if lt.statePath == "" {
+		return
+	}
+	data, err := json.MarshalIndent(lt.jobs, "", "  ")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// Write and rename, so that the state file is never partially written.
+	tmp := lt.statePath + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+		err = os.Rename(tmp, lt.statePath)
+	}
+	if err != nil {
+		log.Println("Error saving tracker state:", err)
+	}
+}
+
+// Status returns a copy of the status of all jobs.
+func (lt *LocalTracker) Status() []JobStatus {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	status := make([]JobStatus, len(lt.jobs))
+	for i := range lt.jobs {
+		status[i] = *lt.jobs[i]
+	}
+	return status
+}
+
+func (lt *LocalTracker) nextJob(resp http.ResponseWriter, req *http.Request) {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	for _, js := range lt.jobs {
+		if js.State == tracker.Init {
+			js.State = tracker.Parsing
+			js.Updated = time.Now()
+			lt.save()
+			resp.Write(js.Job.Marshal())
+			return
+		}
+	}
+	resp.WriteHeader(http.StatusInternalServerError)
+	resp.Write([]byte("No jobs available"))
+}
+
+// jobStatus returns the status of the job in the request, or writes an error.
+// Caller must hold the lock.
+func (lt *LocalTracker) jobStatus(resp http.ResponseWriter, req *http.Request) *JobStatus {
+	j := tracker.Job{}
+	if err := json.Unmarshal([]byte(req.Form.Get("job")), &j); err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	js := lt.find(j)
+	if js == nil {
+		resp.WriteHeader(http.StatusGone)
+		return nil
+	}
+	return js
+}
+
+func (lt *LocalTracker) heartbeat(resp http.ResponseWriter, req *http.Request) {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	if js := lt.jobStatus(resp, req); js != nil {
+		js.Heartbeats++
+		js.Updated = time.Now()
+	}
+}
+
+func (lt *LocalTracker) update(resp http.ResponseWriter, req *http.Request) {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	js := lt.jobStatus(resp, req)
+	if js == nil {
+		return
+	}
+	state := tracker.State(req.Form.Get("state"))
+	if state == "" {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	js.State = state
+	js.Detail = req.Form.Get("detail")
+	js.Updated = time.Now()
+	lt.save()
+}
+
+func (lt *LocalTracker) status(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json")
+	data, err := json.MarshalIndent(lt.Status(), "", "  ")
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.Write(data)
+}
+
+// ServeHTTP implements http.Handler, serving the tracker endpoints used by
+// GardenerAPI, and a JSON summary of all jobs at /status.
+func (lt *LocalTracker) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet && req.URL.Path == "/status" {
+		lt.status(resp, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch req.URL.Path {
+	case "/job":
+		lt.nextJob(resp, req)
+	case "/heartbeat":
+		lt.heartbeat(resp, req)
+	case "/update":
+		lt.update(resp, req)
+	default:
+		resp.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Serve listens on addr, and serves the tracker at the root of that address
+// in the background, until the listener is closed.  The tracker client
+// requests absolute paths, so the tracker can't share a mux with other
+// handlers.  Serve returns the base URL for a GardenerAPI, and the listener
+// is ready to accept requests when it returns.
+func (lt *LocalTracker) Serve(addr string) (url.URL, net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return url.URL{}, nil, err
+	}
+	go func() {
+		err := http.Serve(ln, lt)
+		log.Println("Local tracker stopped:", err)
+	}()
+	return url.URL{Scheme: "http", Host: ln.Addr().String()}, ln, nil
+}
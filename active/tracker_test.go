@@ -0,0 +1,95 @@
+package active_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/m-lab/etl-gardener/tracker"
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/active"
+)
+
+func TestParseJobSpec(t *testing.T) {
+	jc, err := active.ParseJobSpec("foobar,ndt,ndt5,2019-01-01,2019-01-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := active.JobConfig{Bucket: "foobar", Experiment: "ndt", Datatype: "ndt5",
+		Start: "2019-01-01", End: "2019-01-31"}
+	if jc != want {
+		t.Error("Got", jc, "want", want)
+	}
+	if _, err := active.ParseJobSpec("foobar,ndt,ndt5"); !errors.Is(err, active.ErrBadJobSpec) {
+		t.Error("Expected ErrBadJobSpec", err)
+	}
+	bad := []active.JobConfig{{Bucket: "foobar", Experiment: "ndt", Datatype: "ndt5", Start: "2019-01-02", End: "2019-01-01"}}
+	if _, err := active.NewLocalTracker(bad, ""); !errors.Is(err, active.ErrBadJobSpec) {
+		t.Error("Expected ErrBadJobSpec", err)
+	}
+}
+
+func TestLocalTracker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "TestLocalTracker")
+	rtx.Must(err, "tempdir")
+	defer os.RemoveAll(dir)
+	statePath := path.Join(dir, "state.json")
+
+	// The first date matches the objects in testClient, and the second has none.
+	configs := []active.JobConfig{{Bucket: "foobar", Experiment: "ndt", Datatype: "ndt5",
+		Start: "2019-01-01", End: "2019-01-02"}}
+	lt, err := active.NewLocalTracker(configs, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Serve the tracker as the worker does.
+	base, ln, err := lt.Serve("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	g := active.NewGardenerAPI(base, testClient())
+
+	p := newCounter(t)
+	go g.Poll(ctx, p.toRunnable, active.NewWSTokenSource(2), 100*time.Millisecond)
+	time.Sleep(1000 * time.Millisecond)
+	cancel()
+
+	if p.success != 3 {
+		t.Error("Expected 3 successes", p.success)
+	}
+	status := lt.Status()
+	if len(status) != 2 {
+		t.Fatal("Expected 2 jobs", status)
+	}
+	for _, s := range status {
+		if s.State != tracker.ParseComplete {
+			t.Error("Expected ParseComplete", s)
+		}
+	}
+	if status[0].Heartbeats != 3 {
+		t.Error("Expected 3 heartbeats", status[0])
+	}
+
+	// A new tracker should restore the state, and have no jobs to run.
+	configs[0].End = "2019-01-03"
+	lt2, err := active.NewLocalTracker(configs, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = lt2.Status()
+	if len(status) != 3 {
+		t.Fatal("Expected 3 jobs", status)
+	}
+	if status[0].State != tracker.ParseComplete || status[2].State != tracker.Init {
+		t.Error("State not restored", status)
+	}
+}
@@ -101,7 +101,8 @@ func NewColumnPartitionedInserter(pdt bqx.PDT) (row.Sink, error) {
 func NewColumnPartitionedInserterWithUploader(pdt bqx.PDT, uploader etl.Uploader) (row.Sink, error) {
 	token := make(chan struct{}, 1)
 	token <- struct{}{}
-	fl := sink{uploader: uploader, putTimeout: putContextTimeout, maxRetryDelay: maxPutRetryDelay, token: token}
+	fl := sink{uploader: uploader, putTimeout: putContextTimeout, maxRetryDelay: maxPutRetryDelay,
+		limiter: TableLimiter(TableID(pdt.Project, pdt.Dataset, pdt.Table)), token: token}
 
 	sink := (row.Sink)(&fl)
 	return sink, nil
@@ -135,7 +136,8 @@ func NewBQInserter(params etl.InserterParams, uploader etl.Uploader) (etl.Insert
 	token := make(chan struct{}, 1)
 	token <- struct{}{}
 	rows := make([]interface{}, 0, params.BufferSize)
-	sink := sink{uploader: uploader, putTimeout: params.PutTimeout, maxRetryDelay: params.MaxRetryDelay, token: token}
+	sink := sink{uploader: uploader, putTimeout: params.PutTimeout, maxRetryDelay: params.MaxRetryDelay,
+		limiter: TableLimiter(TableID(params.Project, params.Dataset, params.Table)), token: token}
 	in := BQInserter{sink: sink, params: params, rows: rows}
 	return &in, nil
 }
@@ -156,6 +158,8 @@ func GetClient(project string) (*bigquery.Client, error) {
 
 // MapSaver is a generic implementation of bq.ValueSaver, based on maps.  This avoids extra
 // conversion steps in the bigquery library (except for the JSON conversion).
+// NOTE: MapSaver provides no insert ID, so rows are not deduplicated if a task is
+// retried.  Row types should instead implement Save with an ID from row.InsertID.
 // IMPLEMENTS: bigquery.ValueSaver
 type MapSaver map[string]bigquery.Value
 
@@ -348,6 +352,7 @@ func (in *sink) release() {
 // It is THREAD-SAFE.
 // It may block if there is already a Put or Flush in progress.
 func (in *BQInserter) Put(rows []interface{}) error {
+	in.limiter.Wait(rows)
 	in.acquire()
 	_, err := in.flushSlice(rows, in.TableBase(), in.FullTableName())
 	in.release()
@@ -362,6 +367,7 @@ func (in *BQInserter) Put(rows []interface{}) error {
 // It is THREAD-SAFE.
 // It may block if there is already a Put or Flush in progress.
 func (in *BQInserter) PutAsync(rows []interface{}) {
+	in.limiter.Wait(rows)
 	in.acquire()
 	go func() {
 		in.flushSlice(rows, in.TableBase(), in.FullTableName())
@@ -387,6 +393,7 @@ type sink struct {
 	uploader      etl.Uploader // May be a BQ Uploader, or a test Uploader
 	maxRetryDelay time.Duration
 	putTimeout    time.Duration // Timeout used for BQ put operations.
+	limiter       *Limiter      // Limits the insert rate, shared by all sinks for the table.
 
 	// TODO: Consider making some of these atomics?
 	pending  int // Number of rows being flushed.
@@ -403,7 +410,9 @@ type sink struct {
 
 // Commit implements row.Sink.
 // It is thread safe, and returns the number of rows successfull committed.
+// It may block if the table's insert rate limit is exceeded.
 func (in *sink) Commit(rows []interface{}, label string) (int, error) {
+	in.limiter.Wait(rows)
 	in.acquire()
 	defer in.release()
 	return in.flushSlice(rows, label, label)
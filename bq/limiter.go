@@ -0,0 +1,154 @@
+package bq
+
+// The streaming insert quota for a BigQuery table is shared by every worker
+// that inserts into it.  Previously we stayed under the quota by tuning the
+// task queue max_concurrent_requests by hand.  The limiters here bound the
+// insert rate of each table within a process, regardless of MAX_WORKERS.
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/m-lab/etl/metrics"
+)
+
+var (
+	// DefaultRowsPerSec is the default per table row rate limit, set from
+	// BQ_MAX_ROWS_PER_SEC.  Zero means unlimited.
+	DefaultRowsPerSec = envRate("BQ_MAX_ROWS_PER_SEC")
+	// DefaultBytesPerSec is the default per table byte rate limit, set from
+	// BQ_MAX_BYTES_PER_SEC.  Zero means unlimited.
+	DefaultBytesPerSec = envRate("BQ_MAX_BYTES_PER_SEC")
+
+	// tableLimiters holds the *Limiter for each table.  Keys are full table names.
+	tableLimiters = sync.Map{}
+)
+
+func envRate(name string) float64 {
+	s := os.Getenv(name)
+	if s == "" {
+		return 0
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || rate < 0 {
+		log.Printf("Ignoring invalid %s=%q\n", name, s)
+		return 0
+	}
+	return rate
+}
+
+// bucket is a token bucket that holds up to one second of tokens.  The
+// balance may go negative, so that requests larger than the bucket size
+// are delayed in proportion to their size.
+type bucket struct {
+	rate   float64 // Tokens per second.  Zero means unlimited.
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes n tokens from the bucket, and returns how long the caller
+// must wait before using them.
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.tokens += b.rate * now.Sub(b.last).Seconds()
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Limiter limits the rows/sec and bytes/sec inserted into a table.
+// It is THREAD-SAFE.
+type Limiter struct {
+	table string
+
+	lock  sync.Mutex
+	rows  bucket
+	bytes bucket
+}
+
+// NewLimiter creates a Limiter for the table.  A rate of zero means unlimited.
+func NewLimiter(table string, rowsPerSec, bytesPerSec float64) *Limiter {
+	l := &Limiter{table: table}
+	l.SetLimits(rowsPerSec, bytesPerSec)
+	return l
+}
+
+// TableID returns the full project.dataset.table name used to key limiters.
+// Partitions and template suffixes share the limiter of the base table.
+func TableID(project, dataset, table string) string {
+	return project + "." + dataset + "." + table
+}
+
+// TableLimiter returns the Limiter shared by all sinks for the table, creating
+// it with the default limits if necessary.  table should be a full name from
+// TableID.
+func TableLimiter(table string) *Limiter {
+	l, ok := tableLimiters.Load(table)
+	if !ok {
+		l, _ = tableLimiters.LoadOrStore(table,
+			NewLimiter(table, DefaultRowsPerSec, DefaultBytesPerSec))
+	}
+	return l.(*Limiter)
+}
+
+// SetTableLimits changes the limits for the table, including for any
+// existing sinks.  A rate of zero means unlimited.
+func SetTableLimits(table string, rowsPerSec, bytesPerSec float64) {
+	TableLimiter(table).SetLimits(rowsPerSec, bytesPerSec)
+}
+
+// SetLimits changes the rate limits, and refills the buckets.
+func (l *Limiter) SetLimits(rowsPerSec, bytesPerSec float64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.rows = bucket{rate: rowsPerSec, tokens: rowsPerSec, last: now}
+	l.bytes = bucket{rate: bytesPerSec, tokens: bytesPerSec, last: now}
+}
+
+// Reserve accounts for inserting rows and bytes, and returns how long the
+// caller must wait before inserting them.
+func (l *Limiter) Reserve(rows, bytes int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	delay := l.rows.reserve(float64(rows), now)
+	if d := l.bytes.reserve(float64(bytes), now); d > delay {
+		delay = d
+	}
+	return delay
+}
+
+// Wait blocks until the rows may be inserted, and returns the time spent waiting.
+func (l *Limiter) Wait(rows []interface{}) time.Duration {
+	if len(rows) == 0 {
+		return 0
+	}
+	bytes := 0
+	l.lock.Lock()
+	limitBytes := l.bytes.rate > 0
+	l.lock.Unlock()
+	if limitBytes {
+		// Like maybeCountRowSize, estimate the size from the JSON of the first row.
+		jsonRow, _ := json.Marshal(rows[0])
+		bytes = len(jsonRow) * len(rows)
+	}
+	delay := l.Reserve(len(rows), bytes)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	metrics.InsertThrottleHistogram.WithLabelValues(l.table).Observe(delay.Seconds())
+	return delay
+}
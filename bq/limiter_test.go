@@ -0,0 +1,79 @@
+package bq_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-lab/go/cloud/bqx"
+
+	"github.com/m-lab/etl/bq"
+	"github.com/m-lab/etl/fake"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	l := bq.NewLimiter("test", 100, 1000)
+	// The buckets start full, with one second of tokens.
+	if d := l.Reserve(100, 1000); d != 0 {
+		t.Error("Should not wait for first second of rows", d)
+	}
+	// Another 50 rows should take about half a second.
+	d := l.Reserve(50, 0)
+	if d < 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Error("Expected about 500 msec delay for rows, got", d)
+	}
+	// The bytes bucket is empty, and the delay is the larger of the two.
+	d = l.Reserve(0, 2000)
+	if d < 1900*time.Millisecond || d > 2000*time.Millisecond {
+		t.Error("Expected about 2 sec delay for bytes, got", d)
+	}
+
+	unlimited := bq.NewLimiter("unlimited", 0, 0)
+	if d := unlimited.Reserve(1000000, 1000000000); d != 0 {
+		t.Error("Unlimited should never wait", d)
+	}
+}
+
+func TestSinkThrottling(t *testing.T) {
+	// Sinks for the same table share a limiter.
+	bq.SetTableLimits(bq.TableID("fake-project", "fake-dataset", "throttled-table"), 1000, 0)
+	pdt := bqx.PDT{Project: "fake-project", Dataset: "fake-dataset", Table: "throttled-table"}
+	u := fake.NewFakeUploader()
+	in1, err := bq.NewColumnPartitionedInserterWithUploader(pdt, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in2, err := bq.NewColumnPartitionedInserterWithUploader(pdt, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make([]interface{}, 1000)
+	for i := range rows {
+		rows[i] = Item{Name: "a", Count: i, Foobar: 11}
+	}
+	start := time.Now()
+	if _, err = in1.Commit(rows, "Throttled"); err != nil {
+		t.Error(err)
+	}
+	if _, err = in2.Commit(rows[:200], "Throttled"); err != nil {
+		t.Error(err)
+	}
+	if time.Since(start) < 150*time.Millisecond {
+		t.Error("Second commit should have been throttled", time.Since(start))
+	}
+	if u.Total != 1200 {
+		t.Error("Should have added 1200 rows", u.Total)
+	}
+}
+
+func TestTableLimiterKey(t *testing.T) {
+	// Tables with the same name in different datasets have separate limiters.
+	a := bq.TableLimiter(bq.TableID("fake-project", "dataset-a", "ndt5"))
+	b := bq.TableLimiter(bq.TableID("fake-project", "dataset-b", "ndt5"))
+	if a == b {
+		t.Error("Tables in different datasets should not share a limiter")
+	}
+	if a != bq.TableLimiter(bq.TableID("fake-project", "dataset-a", "ndt5")) {
+		t.Error("Sinks for the same table should share a limiter")
+	}
+}
@@ -0,0 +1,353 @@
+package bq
+
+// Streaming inserts are subject to a per table quota, which limits how fast
+// the batch service can reprocess data.  The LoadSink avoids the quota by
+// staging rows as JSONL files in GCS, and loading each file into a table
+// partition with a single load job.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+
+	"github.com/m-lab/go/cloud/bqx"
+
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/factory"
+	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/row"
+	"github.com/m-lab/etl/storage"
+)
+
+const (
+	// DefaultLoadWindow is how long rows are staged before they are loaded.
+	// Load jobs are limited to 1500 per table per day, so each table should
+	// average at most one load per minute.
+	DefaultLoadWindow = 10 * time.Minute
+
+	// loadRetries limits the number of attempts for each load job.
+	loadRetries = 4
+)
+
+// Loader runs BigQuery load jobs.
+type Loader interface {
+	// Load appends the newline delimited JSON rows in the GCS object to the
+	// table, which may include a partition decorator.
+	Load(ctx context.Context, uri string, table bqx.PDT) error
+}
+
+// bqLoader implements Loader using a bigquery.Client.
+type bqLoader struct {
+	client *bigquery.Client
+}
+
+// NewLoader returns a Loader that runs load jobs using the client.
+func NewLoader(client *bigquery.Client) Loader {
+	return &bqLoader{client: client}
+}
+
+// Load implements Loader.Load.
+func (l *bqLoader) Load(ctx context.Context, uri string, table bqx.PDT) error {
+	ref := bigquery.NewGCSReference(uri)
+	ref.SourceFormat = bigquery.JSON
+	loader := l.client.DatasetInProject(table.Project, table.Dataset).Table(table.Table).LoaderFrom(ref)
+	loader.WriteDisposition = bigquery.WriteAppend
+	loader.CreateDisposition = bigquery.CreateNever
+	job, err := loader.Run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// LoadSink implements row.Sink by staging rows in GCS, and loading them into
+// a single table partition with load jobs.  Rows are loaded when the load
+// window expires after the first row is staged, or when Flush is called.
+// It is THREAD-SAFE.
+//
+// NOTE: Commit reports rows as committed once they are staged.  Tasks should
+// use the sinks from LoadSinkFactory, which implement task.Finisher, so that
+// a task completes only after its rows are loaded, and fails if the load
+// fails.  The staged file of a failed load is left in GCS.
+type LoadSink struct {
+	client stiface.Client
+	loader Loader
+	bucket string
+	prefix string  // Object name prefix for staged files.
+	table  bqx.PDT // Destination table, with partition decorator.
+	window time.Duration
+
+	lock   sync.Mutex // Protects all fields below.
+	writer *storage.RowWriter
+	object string
+	staged int
+	timer  *time.Timer
+	batch  *loadBatch
+}
+
+// loadBatch tracks the load of the rows staged in a single object.
+type loadBatch struct {
+	done chan struct{} // Closed when the load completes.
+	err  error         // The result of the load, once done is closed.
+}
+
+// NewLoadSink creates a LoadSink that stages rows in the bucket, and loads
+// them into the partition of the table for the date.  If window is zero,
+// rows are only loaded by Flush.
+func NewLoadSink(client stiface.Client, loader Loader, bucket, prefix string,
+	table bqx.PDT, date time.Time, window time.Duration) *LoadSink {
+	table.Table += "$" + date.Format("20060102")
+	return &LoadSink{client: client, loader: loader, bucket: bucket, prefix: prefix,
+		table: table, window: window}
+}
+
+// toValues converts rows that implement bigquery.ValueSaver to maps, so that
+// the staged JSON uses the BigQuery column names.
+func toValues(rows []interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(rows))
+	for i := range rows {
+		saver, ok := rows[i].(bigquery.ValueSaver)
+		if !ok {
+			values[i] = rows[i]
+			continue
+		}
+		v, _, err := saver.Save()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// open starts a new staging object.  Caller must hold the lock.
+func (ls *LoadSink) open() error {
+	// Objects are named <prefix><dataset>/<table>/<date>/<time>-<random>.jsonl
+	ls.object = fmt.Sprintf("%s%s/%s/%s-%016x.jsonl", ls.prefix, ls.table.Dataset,
+		strings.Replace(ls.table.Table, "$", "/", 1),
+		time.Now().UTC().Format("20060102T150405.000000Z"), rand.Uint64())
+	w, err := storage.NewRowWriter(context.Background(), ls.client, ls.bucket, ls.object)
+	if err != nil {
+		return err
+	}
+	ls.writer = w
+	ls.batch = &loadBatch{done: make(chan struct{})}
+	if ls.window > 0 {
+		ls.timer = time.AfterFunc(ls.window, func() {
+			if err := ls.Flush(); err != nil {
+				log.Println(err)
+			}
+		})
+	}
+	return nil
+}
+
+// Commit implements row.Sink.  It stages the rows, and returns the number of
+// rows staged.
+func (ls *LoadSink) Commit(rows []interface{}, label string) (int, error) {
+	n, _, err := ls.commit(rows, label)
+	return n, err
+}
+
+// commit stages the rows, and returns the batch they will be loaded with.
+func (ls *LoadSink) commit(rows []interface{}, label string) (int, *loadBatch, error) {
+	if len(rows) == 0 {
+		return 0, nil, nil
+	}
+	values, err := toValues(rows)
+	if err != nil {
+		return 0, nil, err
+	}
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	if ls.writer == nil {
+		if err := ls.open(); err != nil {
+			metrics.BackendFailureCount.WithLabelValues(label, "stage failed").Inc()
+			return 0, nil, err
+		}
+	}
+	if err := ls.writer.Commit(values, label); err != nil {
+		metrics.BackendFailureCount.WithLabelValues(label, "stage failed").Inc()
+		return 0, nil, err
+	}
+	ls.staged += len(rows)
+	return len(rows), ls.batch, nil
+}
+
+// Flush loads all staged rows.  It blocks until the load job completes.
+func (ls *LoadSink) Flush() error {
+	ls.lock.Lock()
+	w, object, staged, batch := ls.writer, ls.object, ls.staged, ls.batch
+	if ls.timer != nil {
+		ls.timer.Stop()
+	}
+	ls.writer, ls.object, ls.staged, ls.timer, ls.batch = nil, "", 0, nil, nil
+	ls.lock.Unlock()
+
+	if w == nil {
+		return nil
+	}
+	label := ls.table.Dataset + "." + ls.table.Table
+	err := w.Close()
+	if err != nil {
+		metrics.LoadJobCount.WithLabelValues(label, "stage failed").Inc()
+		metrics.LoadJobRowCount.WithLabelValues(label, "stage failed").Add(float64(staged))
+	} else {
+		err = ls.load(label, "gs://"+ls.bucket+"/"+object, staged)
+	}
+	batch.err = err
+	close(batch.done)
+	return err
+}
+
+// load runs the load job, retrying with backoff.
+func (ls *LoadSink) load(label, uri string, rows int) error {
+	start := time.Now()
+	var err error
+	backoff := time.Second
+	for i := 0; i < loadRetries; i++ {
+		if i > 0 {
+			metrics.LoadJobCount.WithLabelValues(label, "retry").Inc()
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = ls.loader.Load(context.Background(), uri, ls.table)
+		if err == nil {
+			metrics.LoadJobCount.WithLabelValues(label, "ok").Inc()
+			metrics.LoadJobRowCount.WithLabelValues(label, "ok").Add(float64(rows))
+			metrics.InsertionHistogram.WithLabelValues(
+				label, "load").Observe(time.Since(start).Seconds())
+			return nil
+		}
+		log.Printf("Load of %s into %s failed: %v", uri, label, err)
+	}
+	metrics.LoadJobCount.WithLabelValues(label, "failed").Inc()
+	metrics.LoadJobRowCount.WithLabelValues(label, "failed").Add(float64(rows))
+	return err
+}
+
+//======================================================================
+// LoadSinkFactory implements factory.SinkFactory based on load jobs.
+//======================================================================
+
+// LoadSinkFactory provides a LoadSink for each table partition, which is
+// shared by all tasks for that partition.  Flush should be called before
+// shutdown, to load the rows staged since the last load window.
+// It is THREAD-SAFE.
+type LoadSinkFactory struct {
+	client stiface.Client
+	loader Loader
+	bucket string
+	prefix string
+	window time.Duration
+
+	lock  sync.Mutex
+	sinks map[string]*LoadSink
+}
+
+// NewLoadSinkFactory creates a LoadSinkFactory that stages rows in the
+// bucket, with object names starting with prefix.
+func NewLoadSinkFactory(client stiface.Client, loader Loader, bucket, prefix string, window time.Duration) *LoadSinkFactory {
+	return &LoadSinkFactory{client: client, loader: loader, bucket: bucket, prefix: prefix,
+		window: window, sinks: make(map[string]*LoadSink)}
+}
+
+// Get implements factory.SinkFactory.
+func (sf *LoadSinkFactory) Get(ctx context.Context, path etl.DataPath) (row.Sink, etl.ProcessingError) {
+	date, err := time.Parse("20060102", path.PackedDate)
+	if err != nil {
+		return nil, factory.NewError(path.DataType, "PackedDate",
+			http.StatusBadRequest, err)
+	}
+	dataType := path.GetDataType()
+	pdt := bqx.PDT{Project: dataType.BigqueryProject(), Dataset: dataType.Dataset(), Table: dataType.Table()}
+	key := fmt.Sprintf("%s.%s.%s$%s", pdt.Project, pdt.Dataset, pdt.Table, path.PackedDate)
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sink, ok := sf.sinks[key]
+	if !ok {
+		sink = NewLoadSink(sf.client, sf.loader, sf.bucket, sf.prefix, pdt, date, sf.window)
+		sf.sinks[key] = sink
+	}
+	return &loadTask{sink: sink}, nil
+}
+
+// loadTask implements row.Sink and task.Finisher for a single task, using
+// the LoadSink shared with other tasks for the same partition.
+// It is THREAD-SAFE.
+type loadTask struct {
+	sink *LoadSink
+
+	lock    sync.Mutex
+	batches []*loadBatch // Batches containing rows from this task.
+}
+
+// Commit implements row.Sink.
+func (lt *loadTask) Commit(rows []interface{}, label string) (int, error) {
+	n, batch, err := lt.sink.commit(rows, label)
+	if batch != nil {
+		lt.lock.Lock()
+		if len(lt.batches) == 0 || lt.batches[len(lt.batches)-1] != batch {
+			lt.batches = append(lt.batches, batch)
+		}
+		lt.lock.Unlock()
+	}
+	return n, err
+}
+
+// Finish implements task.Finisher.  It waits until the task's rows have been
+// loaded, and returns the first load error.  If there is no load window, the
+// rows are loaded immediately.  The rows are shared with other tasks, so they
+// can't be discarded if the task failed, but there is no need to wait for
+// them.
+func (lt *loadTask) Finish(taskErr error) error {
+	if taskErr != nil {
+		return nil
+	}
+	lt.lock.Lock()
+	batches := lt.batches
+	lt.lock.Unlock()
+	if len(batches) > 0 && lt.sink.window == 0 {
+		if err := lt.sink.Flush(); err != nil {
+			return err
+		}
+	}
+	for _, b := range batches {
+		<-b.done
+		if b.err != nil {
+			return b.err
+		}
+	}
+	return nil
+}
+
+// Flush loads the rows staged by all sinks, and returns the last error.
+func (sf *LoadSinkFactory) Flush() error {
+	sf.lock.Lock()
+	sinks := make([]*LoadSink, 0, len(sf.sinks))
+	for _, s := range sf.sinks {
+		sinks = append(sinks, s)
+	}
+	sf.lock.Unlock()
+
+	var err error
+	for _, s := range sinks {
+		if e := s.Flush(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package bq_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	fgs "github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+
+	"github.com/m-lab/go/cloud/bqx"
+
+	"github.com/m-lab/etl/bq"
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/row"
+	"github.com/m-lab/etl/task"
+)
+
+// fakeLoader records the load jobs, and fails them with err.
+type fakeLoader struct {
+	lock  sync.Mutex
+	uris  []string
+	table bqx.PDT
+	err   error
+}
+
+func (fl *fakeLoader) Load(ctx context.Context, uri string, table bqx.PDT) error {
+	fl.lock.Lock()
+	defer fl.lock.Unlock()
+	fl.uris = append(fl.uris, uri)
+	fl.table = table
+	return fl.err
+}
+
+func (fl *fakeLoader) loads() []string {
+	fl.lock.Lock()
+	defer fl.lock.Unlock()
+	return append([]string{}, fl.uris...)
+}
+
+// savedRow uses a different column name than its field name.
+type savedRow struct {
+	Name string
+}
+
+func (r *savedRow) Save() (map[string]bigquery.Value, string, error) {
+	return map[string]bigquery.Value{"name": r.Name}, "", nil
+}
+
+func TestLoadSink(t *testing.T) {
+	server := fgs.NewServer([]fgs.Object{})
+	defer server.Stop()
+	server.CreateBucket("staging-bucket")
+	c := server.Client()
+
+	loader := &fakeLoader{}
+	date := time.Date(2020, 3, 18, 0, 0, 0, 0, time.UTC)
+	sink := bq.NewLoadSink(stiface.AdaptClient(c), loader, "staging-bucket", "rows/",
+		bqx.PDT{Project: "mlab-sandbox", Dataset: "raw_ndt", Table: "ndt7"}, date, 0)
+
+	n, err := sink.Commit([]interface{}{&savedRow{"foo"}, bq.MapSaver{"name": "bar"}}, "ndt7")
+	if err != nil || n != 2 {
+		t.Fatal("Commit failed:", n, err)
+	}
+	n, err = sink.Commit([]interface{}{&savedRow{"baz"}}, "ndt7")
+	if err != nil || n != 1 {
+		t.Fatal("Commit failed:", n, err)
+	}
+	if len(loader.loads()) != 0 {
+		t.Fatal("Should not load before Flush")
+	}
+
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	uris := loader.loads()
+	if len(uris) != 1 {
+		t.Fatal("Expected one load, got", uris)
+	}
+	if loader.table.Table != "ndt7$20200318" {
+		t.Error("Wrong table:", loader.table)
+	}
+	prefix := "gs://staging-bucket/rows/raw_ndt/ndt7/20200318/"
+	if !strings.HasPrefix(uris[0], prefix) || !strings.HasSuffix(uris[0], ".jsonl") {
+		t.Error("Unexpected staging object", uris[0])
+	}
+
+	r, err := c.Bucket("staging-bucket").Object(strings.TrimPrefix(uris[0], "gs://staging-bucket/")).NewReader(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"name":"foo"}
+{"name":"bar"}
+{"name":"baz"}
+`
+	if string(data) != expect {
+		t.Errorf("Staged %q, want %q", data, expect)
+	}
+
+	// Nothing more to load.
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(loader.loads()) != 1 {
+		t.Error("Empty Flush should not load")
+	}
+}
+
+func TestLoadSinkWindow(t *testing.T) {
+	server := fgs.NewServer([]fgs.Object{})
+	defer server.Stop()
+	server.CreateBucket("staging-bucket")
+
+	loader := &fakeLoader{}
+	sink := bq.NewLoadSink(stiface.AdaptClient(server.Client()), loader, "staging-bucket", "",
+		bqx.PDT{Project: "mlab-sandbox", Dataset: "raw_ndt", Table: "ndt7"}, time.Now(), 10*time.Millisecond)
+	if _, err := sink.Commit([]interface{}{&savedRow{"foo"}}, "ndt7"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for time.Since(start) < 5*time.Second && len(loader.loads()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(loader.loads()) != 1 {
+		t.Error("Rows should be loaded when the window expires")
+	}
+}
+
+func TestLoadSinkFactory(t *testing.T) {
+	server := fgs.NewServer([]fgs.Object{})
+	defer server.Stop()
+	server.CreateBucket("staging-bucket")
+
+	loader := &fakeLoader{}
+	f := bq.NewLoadSinkFactory(stiface.AdaptClient(server.Client()), loader, "staging-bucket", "", time.Hour)
+	dp, err := etl.ValidateTestPath(
+		"gs://archive-mlab-sandbox/ndt/ndt7/2020/03/18/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, pErr := f.Get(context.Background(), dp)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	s2, _ := f.Get(context.Background(), dp)
+	dp.PackedDate = "20200319"
+	s3, _ := f.Get(context.Background(), dp)
+	for _, s := range []row.Sink{s1, s2, s3} {
+		if _, err := s.Commit([]interface{}{&savedRow{"foo"}}, "ndt7"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tasks wait until their rows are loaded.
+	finished := make(chan error)
+	go func() {
+		finished <- s1.(task.Finisher).Finish(nil)
+	}()
+	select {
+	case <-finished:
+		t.Fatal("Finish should wait for the load")
+	case <-time.After(10 * time.Millisecond):
+	}
+	// Tasks for the same partition share a load.
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-finished; err != nil {
+		t.Error("Finish() =", err)
+	}
+	if len(loader.loads()) != 2 {
+		t.Error("Expected a load for each partition, got", loader.loads())
+	}
+
+	dp.PackedDate = "bad-date"
+	if _, pErr := f.Get(context.Background(), dp); pErr == nil {
+		t.Error("Expected error for bad date")
+	}
+}
+
+func TestLoadSinkFactoryLoadError(t *testing.T) {
+	server := fgs.NewServer([]fgs.Object{})
+	defer server.Stop()
+	server.CreateBucket("staging-bucket")
+
+	loader := &fakeLoader{err: errors.New("load failed")}
+	f := bq.NewLoadSinkFactory(stiface.AdaptClient(server.Client()), loader, "staging-bucket", "", 0)
+	dp, err := etl.ValidateTestPath(
+		"gs://archive-mlab-sandbox/ndt/ndt7/2020/03/18/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := f.Get(context.Background(), dp)
+	if _, err := s.Commit([]interface{}{&savedRow{"foo"}}, "ndt7"); err != nil {
+		t.Fatal(err)
+	}
+	// Without a load window, Finish loads the rows, and reports the failure.
+	if err := s.(task.Finisher).Finish(nil); err != loader.err {
+		t.Error("Finish() =", err)
+	}
+}
@@ -0,0 +1,463 @@
+//go:build writeapi
+// +build writeapi
+
+package bq
+
+// The StreamSink writes rows with the BigQuery Storage Write API, which has
+// much higher throughput than tabledata.insertAll.  Each task writes to its
+// own stream, and with a pending stream, the rows only become visible when
+// the stream is committed at the end of a successful task.  This gives
+// exactly-once semantics for a task, even if the task is retried.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/m-lab/go/cloud/bqx"
+
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/row"
+	"github.com/m-lab/etl/schema"
+)
+
+// Errors that may be returned by StreamSink functions.
+var (
+	ErrUnknownColumn    = errors.New("row has column not in schema")
+	ErrStreamIncomplete = errors.New("stream has failed appends")
+	ErrCommitFailed     = errors.New("stream commit failed")
+)
+
+// appendTimeout limits the time for each append to a stream.
+const appendTimeout = 2 * time.Minute
+
+// WriteClient creates and commits Storage Write API streams.  It is
+// satisfied by the client returned from NewWriteClient, and by fakes in tests.
+type WriteClient interface {
+	// NewStream creates a stream for the table.  Rows appended to a pending
+	// stream are visible only after the stream is committed.  Rows appended to
+	// a committed stream are visible immediately.
+	NewStream(ctx context.Context, table bqx.PDT, pending bool, descriptor *descriptorpb.DescriptorProto) (WriteStream, error)
+	// Commit atomically commits finalized pending streams for the table.
+	Commit(ctx context.Context, table bqx.PDT, streams ...string) error
+}
+
+// WriteStream is a single Storage Write API stream.
+type WriteStream interface {
+	// Name returns the fully qualified stream name.
+	Name() string
+	// Append appends serialized rows to the stream.  The offset must be the
+	// number of rows already appended, so that retried appends are not
+	// duplicated.
+	Append(ctx context.Context, rows [][]byte, offset int64) error
+	// Finalize prevents further appends, and returns the number of rows.
+	Finalize(ctx context.Context) (int64, error)
+	// Close releases the resources used by the stream.
+	Close() error
+}
+
+// managedClient implements WriteClient using the managedwriter package.
+type managedClient struct {
+	client *managedwriter.Client
+}
+
+// NewWriteClient returns a WriteClient for the Storage Write API.
+func NewWriteClient(ctx context.Context, project string) (WriteClient, error) {
+	client, err := managedwriter.NewClient(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return &managedClient{client: client}, nil
+}
+
+// NewStream implements WriteClient.NewStream.
+func (mc *managedClient) NewStream(ctx context.Context, table bqx.PDT, pending bool, descriptor *descriptorpb.DescriptorProto) (WriteStream, error) {
+	streamType := managedwriter.CommittedStream
+	if pending {
+		streamType = managedwriter.PendingStream
+	}
+	ms, err := mc.client.NewManagedStream(ctx,
+		managedwriter.WithDestinationTable(
+			managedwriter.TableParentFromParts(table.Project, table.Dataset, table.Table)),
+		managedwriter.WithType(streamType),
+		managedwriter.WithSchemaDescriptor(descriptor))
+	if err != nil {
+		return nil, err
+	}
+	return &managedStream{ms: ms}, nil
+}
+
+// Commit implements WriteClient.Commit.
+func (mc *managedClient) Commit(ctx context.Context, table bqx.PDT, streams ...string) error {
+	resp, err := mc.client.BatchCommitWriteStreams(ctx, &storagepb.BatchCommitWriteStreamsRequest{
+		Parent:       managedwriter.TableParentFromParts(table.Project, table.Dataset, table.Table),
+		WriteStreams: streams,
+	})
+	if err != nil {
+		return err
+	}
+	if errs := resp.GetStreamErrors(); len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrCommitFailed, errs[0].GetErrorMessage())
+	}
+	return nil
+}
+
+// managedStream implements WriteStream using a managedwriter.ManagedStream.
+type managedStream struct {
+	ms *managedwriter.ManagedStream
+}
+
+func (s *managedStream) Name() string {
+	return s.ms.StreamName()
+}
+
+func (s *managedStream) Append(ctx context.Context, rows [][]byte, offset int64) error {
+	result, err := s.ms.AppendRows(ctx, rows, managedwriter.WithOffset(offset))
+	if err != nil {
+		return err
+	}
+	_, err = result.GetResult(ctx)
+	return err
+}
+
+func (s *managedStream) Finalize(ctx context.Context) (int64, error) {
+	return s.ms.Finalize(ctx)
+}
+
+func (s *managedStream) Close() error {
+	return s.ms.Close()
+}
+
+//======================================================================
+// Conversion of rows to protocol buffers.
+//======================================================================
+
+// rowEncoder serializes rows as protocol buffer messages, using a descriptor
+// derived from the table schema.
+type rowEncoder struct {
+	schema     bigquery.Schema
+	md         protoreflect.MessageDescriptor
+	descriptor *descriptorpb.DescriptorProto // Self contained form of md.
+}
+
+func newRowEncoder(s bigquery.Schema) (*rowEncoder, error) {
+	ts, err := adapt.BQSchemaToStorageTableSchema(s)
+	if err != nil {
+		return nil, err
+	}
+	d, err := adapt.StorageSchemaToProto2Descriptor(ts, "root")
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%w: descriptor is not a message", schema.ErrNoSchema)
+	}
+	descriptor, err := adapt.NormalizeDescriptor(md)
+	if err != nil {
+		return nil, err
+	}
+	return &rowEncoder{schema: s, md: md, descriptor: descriptor}, nil
+}
+
+// encode returns the serialized message for the row.
+func (e *rowEncoder) encode(r interface{}) ([]byte, error) {
+	values, err := schema.Values(e.schema, r)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(e.md)
+	if err := setFields(msg, e.schema, values); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+// setFields sets the message fields from the row values.
+func setFields(msg *dynamicpb.Message, s bigquery.Schema, values map[string]bigquery.Value) error {
+	fields := msg.Descriptor().Fields()
+	for name, v := range values {
+		if v == nil {
+			continue
+		}
+		f := fieldSchema(s, name)
+		fd := fields.ByName(protoreflect.Name(name))
+		if fd == nil {
+			// Column names are case insensitive.
+			fd = fields.ByName(protoreflect.Name(strings.ToLower(name)))
+		}
+		if f == nil || fd == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownColumn, name)
+		}
+		if !fd.IsList() {
+			pv, err := fieldValue(fd, f, v)
+			if err != nil {
+				return err
+			}
+			msg.Set(fd, pv)
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice {
+			return fmt.Errorf("%w: %T for repeated %s", schema.ErrUnsupportedValue, v, fd.FullName())
+		}
+		list := msg.Mutable(fd).List()
+		for i := 0; i < rv.Len(); i++ {
+			pv, err := fieldValue(fd, f, rv.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+			list.Append(pv)
+		}
+	}
+	return nil
+}
+
+// fieldSchema returns the schema of the named column, or nil.  Column names
+// are case insensitive.
+func fieldSchema(s bigquery.Schema, name string) *bigquery.FieldSchema {
+	for _, f := range s {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// fieldValue converts a single value, or element of a repeated value, to the
+// representation used by the Storage Write API for the column.
+func fieldValue(fd protoreflect.FieldDescriptor, f *bigquery.FieldSchema, v bigquery.Value) (protoreflect.Value, error) {
+	if f.Type == bigquery.RecordFieldType {
+		if values, ok := v.(map[string]bigquery.Value); ok && fd.Kind() == protoreflect.MessageKind {
+			msg := dynamicpb.NewMessage(fd.Message())
+			if err := setFields(msg, f.Schema, values); err != nil {
+				return protoreflect.Value{}, err
+			}
+			return protoreflect.ValueOfMessage(msg), nil
+		}
+		return protoreflect.Value{}, fmt.Errorf("%w: %T for %s", schema.ErrUnsupportedValue, v, fd.FullName())
+	}
+	v, err := schema.ColumnValue(f, v)
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	rv := reflect.ValueOf(v)
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if rv.Kind() == reflect.Bool {
+			return protoreflect.ValueOfBool(rv.Bool()), nil
+		}
+	case protoreflect.Int64Kind:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return protoreflect.ValueOfInt64(rv.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return protoreflect.ValueOfInt64(int64(rv.Uint())), nil
+		}
+	case protoreflect.Int32Kind:
+		if rv.Kind() == reflect.Int32 {
+			return protoreflect.ValueOfInt32(int32(rv.Int())), nil
+		}
+	case protoreflect.DoubleKind:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return protoreflect.ValueOfFloat64(rv.Float()), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return protoreflect.ValueOfFloat64(float64(rv.Int())), nil
+		}
+	case protoreflect.StringKind:
+		if rv.Kind() == reflect.String {
+			return protoreflect.ValueOfString(rv.String()), nil
+		}
+		if s, ok := v.(fmt.Stringer); ok {
+			return protoreflect.ValueOfString(s.String()), nil
+		}
+	case protoreflect.BytesKind:
+		if b, ok := v.([]byte); ok {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+	}
+	return protoreflect.Value{}, fmt.Errorf("%w: %T for %s", schema.ErrUnsupportedValue, v, fd.FullName())
+}
+
+//======================================================================
+// StreamSink implements row.Sink using the Storage Write API.
+//======================================================================
+
+// StreamSink implements row.Sink by appending rows to a single Storage Write
+// API stream.  It should be used for a single task, and implements
+// task.Finisher, so that a pending stream is committed only if the task
+// succeeds.  The stream is created by the first Commit, using the schema of
+// the first row.
+// It is THREAD-SAFE.
+//
+// NOTE: Rows in a committed stream are visible as soon as they are appended,
+// so they are not removed if the task later fails.
+// NOTE: Row types must provide a schema, so MapSaver rows are not supported.
+type StreamSink struct {
+	client  WriteClient
+	table   bqx.PDT
+	pending bool
+
+	lock    sync.Mutex // Protects all fields below.
+	encoder *rowEncoder
+	stream  WriteStream
+	offset  int64 // Number of rows appended.
+	failed  int   // Number of rows that failed to append.
+	err     error // First append error.
+}
+
+// NewStreamSink creates a StreamSink that writes to the table, using a
+// pending stream if pending is true, or a committed stream otherwise.
+func NewStreamSink(client WriteClient, table bqx.PDT, pending bool) *StreamSink {
+	return &StreamSink{client: client, table: table, pending: pending}
+}
+
+// open creates the stream.  Caller must hold the lock.
+func (ss *StreamSink) open(ctx context.Context, first interface{}) error {
+	s, err := schema.Of(first)
+	if err != nil {
+		return err
+	}
+	ss.encoder, err = newRowEncoder(s)
+	if err != nil {
+		return err
+	}
+	ss.stream, err = ss.client.NewStream(ctx, ss.table, ss.pending, ss.encoder.descriptor)
+	return err
+}
+
+// Commit implements row.Sink.  It appends the rows to the stream, and returns
+// the number of rows appended.
+func (ss *StreamSink) Commit(rows []interface{}, label string) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), appendTimeout)
+	defer cancel()
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	err := ss.append(ctx, rows)
+	if err != nil {
+		metrics.BackendFailureCount.WithLabelValues(label, "append failed").Inc()
+		ss.failed += len(rows)
+		if ss.err == nil {
+			ss.err = err
+		}
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// append encodes the rows and appends them.  Caller must hold the lock.
+func (ss *StreamSink) append(ctx context.Context, rows []interface{}) error {
+	if ss.stream == nil {
+		if err := ss.open(ctx, rows[0]); err != nil {
+			return err
+		}
+	}
+	data := make([][]byte, len(rows))
+	for i := range rows {
+		var err error
+		data[i], err = ss.encoder.encode(rows[i])
+		if err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	if err := ss.stream.Append(ctx, data, ss.offset); err != nil {
+		return err
+	}
+	metrics.InsertionHistogram.WithLabelValues(
+		ss.table.Table, "append").Observe(time.Since(start).Seconds())
+	ss.offset += int64(len(rows))
+	return nil
+}
+
+// Finish implements task.Finisher.  It finalizes the stream, and if the
+// stream is pending, commits the rows if taskErr is nil and every append
+// succeeded, or discards them otherwise.
+func (ss *StreamSink) Finish(taskErr error) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if ss.stream == nil {
+		if ss.err != nil {
+			// Nothing was appended, but some rows were lost.
+			return fmt.Errorf("%w: %v", ErrStreamIncomplete, ss.err)
+		}
+		return nil
+	}
+	stream := ss.stream
+	ss.stream = nil
+	defer stream.Close()
+
+	status, err := ss.finish(stream, taskErr)
+	label := ss.table.Dataset + "." + ss.table.Table
+	metrics.WriteStreamCount.WithLabelValues(label, status).Inc()
+	metrics.WriteStreamRowCount.WithLabelValues(label, status).Add(float64(ss.offset))
+	return err
+}
+
+// finish finalizes and commits the stream, and returns the resulting status.
+func (ss *StreamSink) finish(stream WriteStream, taskErr error) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), appendTimeout)
+	defer cancel()
+	if _, err := stream.Finalize(ctx); err != nil {
+		return "failed", err
+	}
+	switch {
+	case !ss.pending && ss.err != nil:
+		// Some rows are already visible, but the rest are lost.
+		return "incomplete", fmt.Errorf("%w: %d rows: %v", ErrStreamIncomplete, ss.failed, ss.err)
+	case !ss.pending:
+		return "committed", nil
+	case taskErr != nil:
+		return "discarded", nil
+	case ss.err != nil:
+		return "discarded", fmt.Errorf("%w: %d rows: %v", ErrStreamIncomplete, ss.failed, ss.err)
+	}
+	if err := ss.client.Commit(ctx, ss.table, stream.Name()); err != nil {
+		log.Printf("Commit of %s failed: %v", stream.Name(), err)
+		return "failed", err
+	}
+	return "committed", nil
+}
+
+//======================================================================
+// StreamSinkFactory implements factory.SinkFactory based on StreamSink.
+//======================================================================
+
+// StreamSinkFactory provides a new StreamSink for each task.
+type StreamSinkFactory struct {
+	client  WriteClient
+	pending bool
+}
+
+// NewStreamSinkFactory creates a StreamSinkFactory that uses pending streams
+// if pending is true, or committed streams otherwise.
+func NewStreamSinkFactory(client WriteClient, pending bool) *StreamSinkFactory {
+	return &StreamSinkFactory{client: client, pending: pending}
+}
+
+// Get implements factory.SinkFactory.
+func (sf *StreamSinkFactory) Get(ctx context.Context, path etl.DataPath) (row.Sink, etl.ProcessingError) {
+	dataType := path.GetDataType()
+	pdt := bqx.PDT{Project: dataType.BigqueryProject(), Dataset: dataType.Dataset(), Table: dataType.Table()}
+	return NewStreamSink(sf.client, pdt, sf.pending), nil
+}
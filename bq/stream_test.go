@@ -0,0 +1,276 @@
+//go:build writeapi
+// +build writeapi
+
+package bq_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/m-lab/go/cloud/bqx"
+
+	"github.com/m-lab/etl/bq"
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/schema"
+	"github.com/m-lab/etl/task"
+)
+
+// fakeWriteService is a local stand-in for the Storage Write API.  It decodes
+// appended rows with the stream's descriptor, and makes them visible in the
+// table as the real service would.
+type fakeWriteService struct {
+	lock      sync.Mutex
+	streams   map[string]*fakeStream
+	tables    map[string][]*dynamicpb.Message // Visible rows.
+	appendErr error
+}
+
+func newFakeWriteService() *fakeWriteService {
+	return &fakeWriteService{streams: map[string]*fakeStream{},
+		tables: map[string][]*dynamicpb.Message{}}
+}
+
+func (fs *fakeWriteService) rows(table bqx.PDT) []*dynamicpb.Message {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return fs.tables[table.Table]
+}
+
+func (fs *fakeWriteService) NewStream(ctx context.Context, table bqx.PDT, pending bool, descriptor *descriptorpb.DescriptorProto) (bq.WriteStream, error) {
+	// The descriptor must be self contained.
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("fake.proto"),
+		Syntax:      proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{descriptor},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	s := &fakeStream{svc: fs, name: fmt.Sprintf("%s/streams/%d", table.Table, len(fs.streams)),
+		table: table.Table, pending: pending, md: fd.Messages().Get(0)}
+	fs.streams[s.name] = s
+	return s, nil
+}
+
+func (fs *fakeWriteService) Commit(ctx context.Context, table bqx.PDT, streams ...string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	for _, name := range streams {
+		s, ok := fs.streams[name]
+		if !ok || !s.pending || !s.finalized || s.table != table.Table {
+			return fmt.Errorf("%w: %s", bq.ErrCommitFailed, name)
+		}
+	}
+	for _, name := range streams {
+		s := fs.streams[name]
+		fs.tables[s.table] = append(fs.tables[s.table], s.rows...)
+	}
+	return nil
+}
+
+type fakeStream struct {
+	svc       *fakeWriteService
+	name      string
+	table     string
+	pending   bool
+	md        protoreflect.MessageDescriptor
+	rows      []*dynamicpb.Message
+	finalized bool
+}
+
+func (s *fakeStream) Name() string {
+	return s.name
+}
+
+func (s *fakeStream) Append(ctx context.Context, rows [][]byte, offset int64) error {
+	s.svc.lock.Lock()
+	defer s.svc.lock.Unlock()
+	if s.svc.appendErr != nil {
+		return s.svc.appendErr
+	}
+	if s.finalized || offset != int64(len(s.rows)) {
+		return errors.New("invalid append")
+	}
+	for _, b := range rows {
+		m := dynamicpb.NewMessage(s.md)
+		if err := proto.Unmarshal(b, m); err != nil {
+			return err
+		}
+		s.rows = append(s.rows, m)
+		if !s.pending {
+			s.svc.tables[s.table] = append(s.svc.tables[s.table], m)
+		}
+	}
+	return nil
+}
+
+func (s *fakeStream) Finalize(ctx context.Context) (int64, error) {
+	s.svc.lock.Lock()
+	defer s.svc.lock.Unlock()
+	s.finalized = true
+	return int64(len(s.rows)), nil
+}
+
+func (s *fakeStream) Close() error {
+	return nil
+}
+
+type streamServer struct {
+	Site string
+}
+
+type streamRow struct {
+	Name   string
+	Count  int64
+	Time   time.Time
+	Date   civil.Date
+	Tags   []string
+	Server streamServer
+}
+
+// field returns the value of a field of the message.
+func field(m protoreflect.Message, name string) protoreflect.Value {
+	return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name)))
+}
+
+var streamTable = bqx.PDT{Project: "mlab-sandbox", Dataset: "raw_ndt", Table: "ndt7"}
+
+func TestStreamSink(t *testing.T) {
+	svc := newFakeWriteService()
+	sink := bq.NewStreamSink(svc, streamTable, true)
+	var _ task.Finisher = sink
+
+	ts := time.Date(2020, 3, 18, 1, 2, 3, 0, time.UTC)
+	row := &streamRow{Name: "foo", Count: 7, Time: ts, Date: civil.DateOf(ts),
+		Tags: []string{"a", "b"}, Server: streamServer{Site: "lga03"}}
+	n, err := sink.Commit([]interface{}{row, &streamRow{Name: "bar"}}, "ndt7")
+	if err != nil || n != 2 {
+		t.Fatal("Commit failed:", n, err)
+	}
+	n, err = sink.Commit([]interface{}{&streamRow{Name: "baz"}}, "ndt7")
+	if err != nil || n != 1 {
+		t.Fatal("Commit failed:", n, err)
+	}
+	if len(svc.rows(streamTable)) != 0 {
+		t.Fatal("Pending rows should not be visible before Finish")
+	}
+
+	if err := sink.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	rows := svc.rows(streamTable)
+	if len(rows) != 3 {
+		t.Fatal("Expected 3 rows, got", len(rows))
+	}
+	m := rows[0]
+	if field(m, "Name").String() != "foo" || field(m, "Count").Int() != 7 {
+		t.Error("Wrong scalar values:", m)
+	}
+	if field(m, "Time").Int() != ts.UnixNano()/1000 {
+		t.Error("TIMESTAMP should be microseconds:", field(m, "Time"))
+	}
+	if field(m, "Date").Int() != 18339 {
+		t.Error("DATE should be days since epoch:", field(m, "Date"))
+	}
+	tags := field(m, "Tags").List()
+	if tags.Len() != 2 || tags.Get(1).String() != "b" {
+		t.Error("Wrong repeated values:", m)
+	}
+	if field(field(m, "Server").Message(), "Site").String() != "lga03" {
+		t.Error("Wrong nested values:", m)
+	}
+	if field(rows[2], "Name").String() != "baz" {
+		t.Error("Rows out of order:", rows)
+	}
+}
+
+func TestStreamSinkFailedTask(t *testing.T) {
+	svc := newFakeWriteService()
+	sink := bq.NewStreamSink(svc, streamTable, true)
+	if _, err := sink.Commit([]interface{}{&streamRow{Name: "foo"}}, "ndt7"); err != nil {
+		t.Fatal(err)
+	}
+	// Rows from a failed task are discarded, so that a retry is not duplicated.
+	if err := sink.Finish(errors.New("task failed")); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.rows(streamTable)) != 0 {
+		t.Error("Rows from a failed task should be discarded")
+	}
+}
+
+func TestStreamSinkFailedAppend(t *testing.T) {
+	svc := newFakeWriteService()
+	sink := bq.NewStreamSink(svc, streamTable, true)
+	if _, err := sink.Commit([]interface{}{&streamRow{Name: "foo"}}, "ndt7"); err != nil {
+		t.Fatal(err)
+	}
+	svc.appendErr = errors.New("append failed")
+	if n, err := sink.Commit([]interface{}{&streamRow{Name: "bar"}}, "ndt7"); err == nil || n != 0 {
+		t.Fatal("Expected append error:", n, err)
+	}
+	// The stream must not be committed if any rows were lost.
+	if err := sink.Finish(nil); !errors.Is(err, bq.ErrStreamIncomplete) {
+		t.Error("Expected ErrStreamIncomplete, got", err)
+	}
+	if len(svc.rows(streamTable)) != 0 {
+		t.Error("Incomplete stream should be discarded")
+	}
+}
+
+func TestStreamSinkCommitted(t *testing.T) {
+	svc := newFakeWriteService()
+	sink := bq.NewStreamSink(svc, streamTable, false)
+	if _, err := sink.Commit([]interface{}{&streamRow{Name: "foo"}}, "ndt7"); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.rows(streamTable)) != 1 {
+		t.Error("Committed stream rows should be visible immediately")
+	}
+	if err := sink.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.rows(streamTable)) != 1 {
+		t.Error("Expected 1 row")
+	}
+}
+
+func TestStreamSinkBadRow(t *testing.T) {
+	sink := bq.NewStreamSink(newFakeWriteService(), streamTable, true)
+	if _, err := sink.Commit([]interface{}{bq.MapSaver{"name": "foo"}}, "ndt7"); !errors.Is(err, schema.ErrNoSchema) {
+		t.Error("Expected ErrNoSchema, got", err)
+	}
+}
+
+func TestStreamSinkFactory(t *testing.T) {
+	f := bq.NewStreamSinkFactory(newFakeWriteService(), true)
+	dp, err := etl.ValidateTestPath(
+		"gs://archive-mlab-sandbox/ndt/ndt7/2020/03/18/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, pErr := f.Get(context.Background(), dp)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	s2, _ := f.Get(context.Background(), dp)
+	if s1 == s2 {
+		t.Error("Each task should have its own sink")
+	}
+	if _, ok := s1.(task.Finisher); !ok {
+		t.Error("Sink should be a task.Finisher")
+	}
+}
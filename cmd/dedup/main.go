@@ -0,0 +1,72 @@
+package main
+
+// This command removes duplicate rows from the partitions of a table, e.g.
+// after a date range has been reprocessed by the batch service.
+//
+// Examples:
+//  go run ./cmd/dedup -project=mlab-sandbox -dataset=raw_ndt -type=ndt7 \
+//      -start=2020-03-01 -end=2020-03-31 -dry_run
+//  go run ./cmd/dedup -project=mlab-sandbox -dataset=batch -type=tcpinfo \
+//      -start=2020-03-01
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+
+	"github.com/m-lab/go/cloud/bqx"
+	"github.com/m-lab/go/flagx"
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/dedup"
+)
+
+var (
+	project   = flag.String("project", "", "GCP project containing the table.")
+	dataset   = flag.String("dataset", "", "Dataset containing the table.")
+	tableType = flag.String("type", "", "Row type of the table (ndt, ndt5, ndt7, annotation, tcpinfo, traceroute).")
+	table     = flag.String("table", "", "Table to deduplicate.  Defaults to the -type.")
+	start     = flag.String("start", "", "First partition date to deduplicate, as YYYY-MM-DD.")
+	end       = flag.String("end", "", "Last partition date to deduplicate, as YYYY-MM-DD.  Defaults to -start.")
+	dryRun    = flag.Bool("dry_run", false, "Report duplicate counts without changing any tables.")
+)
+
+func main() {
+	flag.Parse()
+	flagx.ArgsFromEnv(flag.CommandLine)
+
+	if *project == "" || *dataset == "" || *tableType == "" || *start == "" {
+		log.Fatal("Must specify -project, -dataset, -type and -start")
+	}
+	if *table == "" {
+		*table = *tableType
+	}
+	if *end == "" {
+		*end = *start
+	}
+	startDate, err := time.Parse("2006-01-02", *start)
+	rtx.Must(err, "Invalid -start")
+	endDate, err := time.Parse("2006-01-02", *end)
+	rtx.Must(err, "Invalid -end")
+
+	ctx := context.Background()
+	client, err := bigquery.NewClient(ctx, *project)
+	rtx.Must(err, "NewClient")
+
+	pdt := bqx.PDT{Project: *project, Dataset: *dataset, Table: *table}
+	d, err := dedup.NewDeduper(dedup.NewBigQuery(client), pdt, *tableType, *dryRun)
+	rtx.Must(err, "NewDeduper")
+
+	reports, err := d.Range(ctx, startDate, endDate)
+	var before, after int64
+	for _, r := range reports {
+		before += r.Before
+		after += r.After
+	}
+	log.Printf("%v: %d partitions, %d rows, %d duplicates, %d remaining (dry run: %v)",
+		pdt, len(reports), before, before-after, after, *dryRun)
+	rtx.Must(err, "Dedup failed")
+}
@@ -0,0 +1,22 @@
+//go:build cloudtasks
+// +build cloudtasks
+
+package main
+
+import (
+	"context"
+	"io"
+
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
+
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/enqueue"
+)
+
+// newCloudTasks returns a Cloud Tasks backend, and the client to close.
+func newCloudTasks(ctx context.Context) (enqueue.Backend, io.Closer) {
+	client, err := cloudtasks.NewClient(ctx)
+	rtx.Must(err, "cloudtasks.NewClient")
+	return enqueue.NewCloudTasks(client, *project, *location, *workerURL), client
+}
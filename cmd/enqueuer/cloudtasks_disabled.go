@@ -0,0 +1,19 @@
+//go:build !cloudtasks
+// +build !cloudtasks
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/m-lab/etl/enqueue"
+)
+
+// newCloudTasks fails, because the enqueuer was built without the Cloud
+// Tasks client.
+func newCloudTasks(ctx context.Context) (enqueue.Backend, io.Closer) {
+	log.Fatal("-backend=cloudtasks requires an enqueuer built with -tags cloudtasks")
+	return nil, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+// This command runs the enqueuer service, which replaces the App Engine
+// queue_pusher.  It accepts /receiver requests with a (possibly base64
+// encoded) archive filename, and adds a task for the file to the queue for
+// its datatype.  With -backend=pubsub, each queue is a topic, which should
+// have a push subscription to the etl_worker /notification handler.
+//
+// Examples:
+//  go run ./cmd/enqueuer -backend=memory -worker_url=http://localhost:8080
+//  go run -tags cloudtasks ./cmd/enqueuer -backend=cloudtasks -project=mlab-sandbox \
+//      -location=us-central1 -worker_url=https://etl-worker.example.com
+//  go run ./cmd/enqueuer -backend=pubsub -project=mlab-sandbox
+//
+// cmd/enqueuer/Dockerfile builds an image with the Cloud Tasks backend.
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/m-lab/go/flagx"
+	"github.com/m-lab/go/prometheusx"
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/enqueue"
+)
+
+var (
+	listenAddr = flag.String("listen", ":8080", "Address to serve /receiver requests on.")
+	backend    = flag.String("backend", "memory", "Queue backend: cloudtasks, pubsub, or memory.  cloudtasks requires -tags cloudtasks.")
+	project    = flag.String("project", "", "GCP project containing the queues or topics.")
+	location   = flag.String("location", "us-central1", "Cloud Tasks location of the queues.")
+	workerURL  = flag.String("worker_url", "", "Base URL of the etl_worker that handles tasks.  Optional for -backend=memory.")
+	queues     = flag.String("queues", "", "Comma separated datatype=queue pairs.  Defaults to the standard ETL queues.")
+)
+
+func init() {
+	// Always prepend the filename and line number.
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+}
+
+func main() {
+	flag.Parse()
+	flagx.ArgsFromEnv(flag.CommandLine)
+
+	queueMap := enqueue.DefaultQueues
+	if *queues != "" {
+		var err error
+		queueMap, err = enqueue.ParseQueues(*queues)
+		rtx.Must(err, "Invalid -queues")
+	}
+
+	ctx := context.Background()
+	var b enqueue.Backend
+	switch *backend {
+	case "cloudtasks":
+		if *project == "" || *workerURL == "" {
+			log.Fatal("Must specify -project and -worker_url for -backend=cloudtasks")
+		}
+		ct, closer := newCloudTasks(ctx)
+		defer closer.Close()
+		b = ct
+	case "pubsub":
+		if *project == "" {
+			log.Fatal("Must specify -project for -backend=pubsub")
+		}
+		client, err := pubsub.NewClient(ctx, *project)
+		rtx.Must(err, "pubsub.NewClient")
+		defer client.Close()
+		ps := enqueue.NewPubSub(client)
+		defer ps.Close()
+		b = ps
+	case "memory":
+		mq := enqueue.NewMemoryQueue(*workerURL)
+		defer mq.Close()
+		b = mq
+	default:
+		log.Fatal("Unknown -backend: ", *backend)
+	}
+
+	prometheusx.MustStartPrometheus(":9090")
+
+	log.Println("Serving", *backend, "enqueuer on", *listenAddr)
+	log.Println(http.ListenAndServe(*listenAddr, enqueue.NewHandler(enqueue.NewReceiver(b, queueMap))))
+}
@@ -9,12 +9,16 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	gcs "cloud.google.com/go/storage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/m-lab/go/prometheusx"
@@ -25,6 +29,8 @@ import (
 	"github.com/m-lab/etl/etl"
 	"github.com/m-lab/etl/factory"
 	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/parser"
+	"github.com/m-lab/etl/row"
 	"github.com/m-lab/etl/storage"
 	"github.com/m-lab/etl/task"
 	"github.com/m-lab/etl/worker"
@@ -242,7 +248,11 @@ func (r *runnable) Run() error {
 	metrics.DurationHistogram.WithLabelValues(
 		dp.DataType, http.StatusText(statusCode)).Observe(
 		time.Since(start).Seconds())
-	return err
+	if pErr != nil {
+		// Returning the ProcessingError allows retries of transient failures.
+		return pErr
+	}
+	return nil
 }
 
 func (r *runnable) Info() string {
@@ -250,17 +260,156 @@ func (r *runnable) Info() string {
 	return r.Name
 }
 
+// sinkFactory is shared by all tasks, so that load job sinks can batch rows
+// from many tasks.
+var sinkFactory factory.SinkFactory = bq.NewSinkFactory()
+
+// setupLoadSinks replaces the sinkFactory with one that uses load jobs, if
+// a staging bucket is specified.
+func setupLoadSinks() {
+	if *loadBucket == "" {
+		return
+	}
+	c, err := storage.GetStorageClient(true)
+	rtx.Must(err, "Could not create storage client")
+	client, err := bq.GetClient(os.Getenv("GCLOUD_PROJECT"))
+	rtx.Must(err, "Could not create bigquery client")
+	log.Println("Staging rows for load jobs in", *loadBucket)
+	lsf := bq.NewLoadSinkFactory(stiface.AdaptClient(c), bq.NewLoader(client),
+		*loadBucket, *loadPrefix, *loadWindow)
+	sinkFactory = lsf
+
+	// Load the rows staged since the last load window before exiting.
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+		<-sig
+		log.Println("Loading staged rows before shutdown")
+		mainCancel()
+		if err := lsf.Flush(); err != nil {
+			log.Println("Final load failed:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
+
+// setupWriteSinks replaces the sinkFactory with one that uses the Storage
+// Write API, if a stream type is specified.
+func setupWriteSinks() {
+	switch *writeStream {
+	case "":
+		return
+	case "pending", "committed":
+	default:
+		log.Fatalf("Invalid -write_stream %q", *writeStream)
+	}
+	if *loadBucket != "" {
+		log.Fatal("Cannot use both -load_bucket and -write_stream")
+	}
+	log.Println("Writing rows with", *writeStream, "streams")
+	sinkFactory = newStreamSinkFactory(*writeStream == "pending")
+}
+
+// setupParquetSinks replaces the sinkFactory with one that writes Parquet
+// files, if an output location is specified.
+func setupParquetSinks() {
+	if *parquetOutput == "" {
+		return
+	}
+	if *loadBucket != "" || *writeStream != "" {
+		log.Fatal("Cannot use -parquet_output with -load_bucket or -write_stream")
+	}
+	var out storage.Output
+	if strings.HasPrefix(*parquetOutput, "gs://") {
+		c, err := storage.GetStorageClient(true)
+		rtx.Must(err, "Could not create storage client")
+		out = storage.NewGCSOutput(stiface.AdaptClient(c), strings.TrimPrefix(*parquetOutput, "gs://"))
+	} else {
+		out = storage.NewDirOutput(*parquetOutput)
+	}
+	log.Println("Writing Parquet files to", *parquetOutput)
+	sinkFactory = storage.NewParquetSinkFactory(out, *parquetRowGroupSize, *parquetFileSize)
+}
+
+// setupPrivacy applies the privacy policy, if one is specified, to rows from
+// all parsers.
+func setupPrivacy() {
+	if *privacyPolicy == "" {
+		return
+	}
+	policy, err := row.LoadPrivacyPolicy(*privacyPolicy)
+	rtx.Must(err, "Could not load privacy policy")
+	log.Println("Applying privacy policy", policy.Version, "to", policy.DataTypes)
+	metrics.PrivacyPolicy.WithLabelValues(policy.Version).Set(1)
+	parser.SetPrivacyPolicy(policy)
+	sinkFactory = factory.NewPrivacySinkFactory(sinkFactory, policy)
+}
+
+// prefetchOptions returns the read-ahead options for prefetching sources.
+// Entries larger than a task reads are skipped, and with a memory budget,
+// each task buffers at most its share of the budget.
+func prefetchOptions() storage.PrefetchOptions {
+	opts := storage.DefaultPrefetchOptions
+	opts.MaxEntrySize = task.DefaultMaxFileSize
+	if *memoryBudgetMB > 0 && *maxActiveWorkers > 0 {
+		share := *memoryBudgetMB * 1024 * 1024 / int64(*maxActiveWorkers)
+		if share < opts.MaxEntrySize {
+			opts.MaxBuffered = share
+		}
+	}
+	return opts
+}
+
+// newTaskFactory creates a task factory that reads archives with the client.
+func newTaskFactory(c *gcs.Client) task.Factory {
+	source := storage.GCSSourceFactory(c)
+	if *gcsPrefetch {
+		source = storage.GCSPrefetchSourceFactory(c, prefetchOptions())
+	}
+	return &worker.StandardTaskFactory{
+		Annotator: factory.DefaultAnnotatorFactory(),
+		Sink:      sinkFactory,
+		Source:    source,
+	}
+}
+
 func toRunnable(obj *gcs.ObjectAttrs) active.Runnable {
 	c, err := storage.GetStorageClient(false)
 	if err != nil {
 		return nil // TODO add an error?
 	}
-	taskFactory := worker.StandardTaskFactory{
-		Annotator: factory.DefaultAnnotatorFactory(),
-		Sink:      bq.NewSinkFactory(),
-		Source:    storage.GCSSourceFactory(c),
+	return &runnable{newTaskFactory(c), *obj}
+}
+
+// setupNotifications serves GCS notifications pushed by Pub/Sub at
+// /notification, if enabled.
+func setupNotifications() {
+	if !*notifications {
+		return
 	}
-	return &runnable{&taskFactory, *obj}
+	types := []etl.DataType{}
+	if *notificationTypes != "" {
+		for _, t := range strings.Split(*notificationTypes, ",") {
+			types = append(types, etl.DataType(t))
+		}
+	}
+	c, err := storage.GetStorageClient(false)
+	rtx.Must(err, "Could not create storage client")
+	nh := worker.NewNotificationHandler(newTaskFactory(c), types...)
+	log.Println("Serving GCS notifications for", types)
+	http.HandleFunc("/notification", metrics.DurationHandler("notification",
+		func(rwr http.ResponseWriter, rq *http.Request) {
+			// Throttled requests are redelivered by Pub/Sub.
+			if shouldThrottle() {
+				metrics.NotificationCount.WithLabelValues("unknown", "TooManyRequests").Inc()
+				rwr.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprintf(rwr, `{"message": "Too many tasks."}`)
+				return
+			}
+			defer decrementInFlight()
+			nh.ServeHTTP(rwr, rq)
+		}))
 }
 
 func mustGardenerAPI(ctx context.Context, jobServer string) *active.GardenerAPI {
@@ -273,6 +422,92 @@ func mustGardenerAPI(ctx context.Context, jobServer string) *active.GardenerAPI
 
 var mainCtx, mainCancel = context.WithCancel(context.Background())
 
+var (
+	minActiveWorkers = flag.Int("min_active_workers", 10, "Minimum concurrent tasks when processing gardener jobs.")
+	maxActiveWorkers = flag.Int("max_active_workers", 120, "Maximum concurrent tasks when processing gardener jobs.")
+	adjustPeriod     = flag.Duration("worker_adjust_period", 30*time.Second, "How often to adjust the concurrent task limit.")
+	memoryBudgetMB   = flag.Int64("memory_budget_mb", 0, "Estimated memory budget for concurrent tasks, or 0 for no limit.")
+	gcsPrefetch      = flag.Bool("gcs_prefetch", false, "Read archives with parallel ranged reads ahead of the parser.")
+
+	// Flags for loading rows with load jobs instead of streaming inserts.
+	loadBucket = flag.String("load_bucket", "", "GCS bucket for staging rows for BigQuery load jobs.  If empty, rows are streamed.")
+	loadPrefix = flag.String("load_prefix", "staging/", "Object name prefix for staged rows.")
+	loadWindow = flag.Duration("load_window", bq.DefaultLoadWindow, "How long rows are staged before they are loaded.")
+
+	// Flag for writing rows with the Storage Write API instead of streaming inserts.
+	writeStream = flag.String("write_stream", "", "Storage Write API stream type, \"pending\" to commit each task's rows only when the task succeeds, or \"committed\".  If empty, rows are streamed with insertAll.  Requires a worker built with -tags writeapi.")
+
+	// Flags for writing Parquet files instead of BigQuery rows.
+	parquetOutput       = flag.String("parquet_output", "", "Local directory or gs://bucket for Parquet files.  If empty, rows are written to BigQuery.")
+	parquetRowGroupSize = flag.Int64("parquet_row_group_size", storage.DefaultRowGroupSize, "Bytes of rows buffered for each Parquet row group.")
+	parquetFileSize     = flag.Int64("parquet_file_size", storage.DefaultMaxParquetFileSize, "Size at which a new Parquet file is started.")
+
+	// Flags for processing GCS notifications pushed by Pub/Sub.
+	notifications     = flag.Bool("notifications", false, "Process GCS OBJECT_FINALIZE notifications pushed by Pub/Sub to /notification.")
+	notificationTypes = flag.String("notification_types", "", "Comma separated datatypes to process from notifications.  If empty, all valid datatypes are processed.")
+
+	// Flag for filtering rows before they leave the parser.
+	privacyPolicy = flag.String("privacy_policy", "", "JSON file with the privacy policy applied to parsed rows.  If empty, rows are not filtered.")
+
+	// Flags for the local tracker, used when GARDENER_HOST is not set.
+	localJobsFile    = flag.String("local_jobs", "", "JSON file listing jobs for the local tracker.")
+	localJobSpecs    jobSpecs
+	localStateFile   = flag.String("local_state", "", "File for saving local tracker progress.")
+	localTrackerAddr = flag.String("local_tracker_addr", "localhost:8081", "Address to serve the local tracker on.")
+)
+
+func init() {
+	flag.Var(&localJobSpecs, "local_job", "Job for the local tracker, as bucket,experiment,datatype,start[,end]. May be repeated.")
+}
+
+// jobSpecs implements flag.Value for a repeated job spec flag.
+type jobSpecs []string
+
+func (js *jobSpecs) String() string {
+	return fmt.Sprint(*js)
+}
+
+func (js *jobSpecs) Set(spec string) error {
+	*js = append(*js, spec)
+	return nil
+}
+
+// mustLocalTracker creates a LocalTracker from the local tracker flags, or
+// returns nil if no jobs are configured.
+func mustLocalTracker() *active.LocalTracker {
+	configs := []active.JobConfig{}
+	if *localJobsFile != "" {
+		var err error
+		configs, err = active.LoadJobConfigs(*localJobsFile)
+		rtx.Must(err, "Could not load local jobs")
+	}
+	for _, spec := range localJobSpecs {
+		jc, err := active.ParseJobSpec(spec)
+		rtx.Must(err, "Bad local job")
+		configs = append(configs, jc)
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+	lt, err := active.NewLocalTracker(configs, *localStateFile)
+	rtx.Must(err, "Could not create local tracker")
+	return lt
+}
+
+// startActive starts processing jobs from the gardener API.
+func startActive(gapi *active.GardenerAPI) {
+	minPollingInterval := 10 * time.Second
+	if *memoryBudgetMB > 0 {
+		gapi.LimitMemory(active.NewMemoryTokenSource(*memoryBudgetMB*1024*1024, nil))
+	}
+	// The number of concurrent tasks adapts to backend errors.
+	tokens := active.NewAdaptiveTokenSource(*minActiveWorkers, *maxActiveWorkers,
+		active.DefaultErrorSignals()...)
+	go tokens.Run(mainCtx, *adjustPeriod)
+	// Note that this does not currently track duration metric.
+	go gapi.Poll(mainCtx, toRunnable, tokens, minPollingInterval)
+}
+
 func main() {
 	defer mainCancel()
 	flag.Parse()
@@ -289,6 +524,11 @@ func main() {
 	runtime.SetBlockProfileRate(1000000) // One event per msec.
 
 	setMaxInFlight()
+	setupLoadSinks()
+	setupWriteSinks()
+	setupParquetSinks()
+	setupPrivacy()
+	setupNotifications()
 
 	// We also setup another prometheus handler on a non-standard path. This
 	// path name will be accessible through the AppEngine service address,
@@ -298,11 +538,14 @@ func main() {
 	gardener := os.Getenv("GARDENER_HOST")
 	if len(gardener) > 0 {
 		log.Println("Using", gardener)
-		maxWorkers := 120
-		minPollingInterval := 10 * time.Second
-		gapi := mustGardenerAPI(mainCtx, gardener)
-		// Note that this does not currently track duration metric.
-		go gapi.Poll(mainCtx, toRunnable, maxWorkers, minPollingInterval)
+		startActive(mustGardenerAPI(mainCtx, gardener))
+	} else if lt := mustLocalTracker(); lt != nil {
+		log.Println("Using local tracker")
+		// The local tracker is served on its own port, and job status is
+		// available at /status.  It is listening before polling starts.
+		base, _, err := lt.Serve(*localTrackerAddr)
+		rtx.Must(err, "Could not serve local tracker")
+		startActive(active.NewGardenerAPI(base, active.MustStorageClient(mainCtx)))
 	} else {
 		log.Println("GARDENER_HOST not specified or empty")
 	}
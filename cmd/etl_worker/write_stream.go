@@ -0,0 +1,25 @@
+//go:build writeapi
+// +build writeapi
+
+package main
+
+// The Storage Write API client needs a newer toolchain than the rest of the
+// worker, so it is only built with -tags writeapi.
+
+import (
+	"context"
+	"os"
+
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/bq"
+	"github.com/m-lab/etl/factory"
+)
+
+// newStreamSinkFactory returns a SinkFactory that writes rows with pending or
+// committed Storage Write API streams.
+func newStreamSinkFactory(pending bool) factory.SinkFactory {
+	client, err := bq.NewWriteClient(context.Background(), os.Getenv("GCLOUD_PROJECT"))
+	rtx.Must(err, "Could not create write client")
+	return bq.NewStreamSinkFactory(client, pending)
+}
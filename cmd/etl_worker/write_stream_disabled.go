@@ -0,0 +1,17 @@
+//go:build !writeapi
+// +build !writeapi
+
+package main
+
+import (
+	"log"
+
+	"github.com/m-lab/etl/factory"
+)
+
+// newStreamSinkFactory fails, because the worker was built without the
+// Storage Write API client.
+func newStreamSinkFactory(pending bool) factory.SinkFactory {
+	log.Fatal("-write_stream requires a worker built with -tags writeapi")
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/m-lab/etl/web100"
+)
+
+// gzipMagic is the two byte header at the start of every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// readSnaplog reads the named file, decompressing it if it is gzipped.
+func readSnaplog(filename string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(content, gzipMagic) {
+		return content, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// rowSaver implements web100.Saver, collecting the values of one snapshot.
+type rowSaver map[string]interface{}
+
+func (r rowSaver) SetInt64(name string, value int64)   { r[name] = value }
+func (r rowSaver) SetString(name string, value string) { r[name] = value }
+func (r rowSaver) SetBool(name string, value bool)     { r[name] = value }
+
+// rowWriter writes one snapshot at a time in a particular output format.
+type rowWriter interface {
+	Write(snapNum int, row rowSaver) error
+	Flush() error
+}
+
+// csvWriter writes a header line, followed by one line per snapshot.  Fields
+// missing from a row (e.g. unchanged fields when exporting deltas) are empty.
+type csvWriter struct {
+	w      *csv.Writer
+	fields []string
+	record []string
+}
+
+func newCSVWriter(w io.Writer, fields []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), fields: fields,
+		record: make([]string, len(fields)+1)}
+	header := append([]string{"snapshot_num"}, fields...)
+	return cw, cw.w.Write(header)
+}
+
+func (cw *csvWriter) Write(snapNum int, row rowSaver) error {
+	cw.record[0] = strconv.Itoa(snapNum)
+	for i, name := range cw.fields {
+		v, ok := row[name]
+		if ok {
+			cw.record[i+1] = fmt.Sprint(v)
+		} else {
+			cw.record[i+1] = ""
+		}
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonlWriter writes one JSON object per line, containing only the selected
+// fields present in each row.
+type jsonlWriter struct {
+	enc    *json.Encoder
+	fields []string
+}
+
+func (jw *jsonlWriter) Write(snapNum int, row rowSaver) error {
+	out := make(map[string]interface{}, len(jw.fields)+1)
+	out["snapshot_num"] = snapNum
+	for _, name := range jw.fields {
+		if v, ok := row[name]; ok {
+			out[name] = v
+		}
+	}
+	return jw.enc.Encode(out)
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return nil
+}
+
+// selectFields checks that every requested field exists in the snaplog.  If
+// none are requested, all snapshot fields are returned.
+func selectFields(snaplog *web100.SnapLog, requested []string) ([]string, error) {
+	all := snaplog.FieldNames()
+	if len(requested) == 0 {
+		return all, nil
+	}
+	known := make(map[string]bool, len(all))
+	for _, name := range all {
+		known[name] = true
+	}
+	for _, name := range requested {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown web100 field: %q", name)
+		}
+	}
+	return requested, nil
+}
+
+// export writes every snapshot in snaplog to w, as "csv" or "jsonl".  If
+// deltas is true, each row after the first contains only the fields that
+// changed since the previous snapshot.
+func export(w io.Writer, snaplog *web100.SnapLog, format string, fields []string, deltas bool) error {
+	fields, err := selectFields(snaplog, fields)
+	if err != nil {
+		return err
+	}
+
+	var rw rowWriter
+	switch format {
+	case "csv":
+		rw, err = newCSVWriter(w, fields)
+		if err != nil {
+			return err
+		}
+	case "jsonl":
+		rw = &jsonlWriter{enc: json.NewEncoder(w), fields: fields}
+	default:
+		return fmt.Errorf("unknown format: %q", format)
+	}
+
+	var prev web100.Snapshot
+	row := make(rowSaver, len(fields))
+	for i := 0; i < snaplog.SnapCount(); i++ {
+		snap, err := snaplog.Snapshot(i)
+		if err != nil {
+			return err
+		}
+		for k := range row {
+			delete(row, k)
+		}
+		if deltas {
+			err = snap.SnapshotDeltas(&prev, row)
+		} else {
+			err = snap.SnapshotValues(row)
+		}
+		if err != nil {
+			return err
+		}
+		if err = rw.Write(i, row); err != nil {
+			return err
+		}
+		prev = snap
+	}
+	return rw.Flush()
+}
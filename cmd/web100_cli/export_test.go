@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/m-lab/etl/web100"
+)
+
+const testSnaplog = "../../parser/testdata/20170509T13:45:13.590210000Z_eb.measurementlab.net:44160.s2c_snaplog"
+
+func mustSnaplog(t *testing.T, filename string) *web100.SnapLog {
+	content, err := readSnaplog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaplog, err := web100.NewSnapLog(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snaplog.ValidateSnapshots(); err != nil {
+		t.Fatal(err)
+	}
+	return snaplog
+}
+
+func TestExportCSV(t *testing.T) {
+	snaplog := mustSnaplog(t, testSnaplog)
+	buf := bytes.Buffer{}
+	err := export(&buf, snaplog, "csv", []string{"CurCwnd", "SmoothedRTT"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != snaplog.SnapCount()+1 {
+		t.Fatal("Expected", snaplog.SnapCount()+1, "records, got", len(records))
+	}
+	if records[0][0] != "snapshot_num" || records[0][1] != "CurCwnd" || records[0][2] != "SmoothedRTT" {
+		t.Error("Bad header", records[0])
+	}
+	for _, r := range records[1:] {
+		if r[1] == "" || r[2] == "" {
+			t.Fatal("Missing values", r)
+		}
+	}
+}
+
+func TestExportJSONLDeltas(t *testing.T) {
+	snaplog := mustSnaplog(t, testSnaplog)
+	buf := bytes.Buffer{}
+	err := export(&buf, snaplog, "jsonl", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for ; scanner.Scan(); lines++ {
+		row := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		// The first row has all fields, later rows have only changes.
+		if lines == 0 && len(row) != len(snaplog.FieldNames())+1 {
+			t.Error("First row should have all fields", len(row))
+		}
+		if lines > 0 && len(row) > len(snaplog.FieldNames()) {
+			t.Error("Delta row has too many fields", len(row))
+		}
+	}
+	if lines != snaplog.SnapCount() {
+		t.Error("Expected", snaplog.SnapCount(), "lines, got", lines)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	snaplog := mustSnaplog(t, testSnaplog)
+	buf := bytes.Buffer{}
+	if err := export(&buf, snaplog, "csv", []string{"NoSuchField"}, false); err == nil {
+		t.Error("Should fail for unknown field")
+	}
+	if err := export(&buf, snaplog, "xml", nil, false); err == nil {
+		t.Error("Should fail for unknown format")
+	}
+}
+
+func TestReadGzipSnaplog(t *testing.T) {
+	raw, err := ioutil.ReadFile(testSnaplog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir, err := ioutil.TempDir("", "web100_cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	gz := bytes.Buffer{}
+	zw := gzip.NewWriter(&gz)
+	zw.Write(raw)
+	zw.Close()
+	fn := path.Join(tmpdir, "test.s2c_snaplog.gz")
+	if err := ioutil.WriteFile(fn, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := readSnaplog(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, raw) {
+		t.Error("Decompressed content does not match")
+	}
+}
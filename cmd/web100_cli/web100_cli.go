@@ -1,14 +1,23 @@
 // web100_cli provides a simple CLI interface to web100 functions.
+//
+// By default it prints the values from the last snapshot and the connection
+// spec.  With -format=csv or -format=jsonl, it exports every snapshot as a
+// time series, e.g. for plotting congestion window evolution.  Gzipped
+// snaplogs are decompressed automatically.
 package main
 
-// example:
-// go build cmd/web100_cli/web100_cli.go
+// examples:
+// go build ./cmd/web100_cli
 // ./web100_cli -filename parser/testdata/20170509T13\:45\:13.590210000Z_eb.measurementlab.net\:44160.s2c_snaplog
+// ./web100_cli -format=csv -fields=Duration,CurCwnd,SmoothedRTT -filename foo.s2c_snaplog.gz > cwnd.csv
+// ./web100_cli -format=jsonl -deltas -filename foo.s2c_snaplog > deltas.jsonl
 import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"log"
+	"os"
+	"strings"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/m-lab/etl/schema"
@@ -18,6 +27,9 @@ import (
 var (
 	filename = flag.String("filename", "", "Trace filename.")
 	tcpKis   = flag.String("tcp-kis", "tcp-kis.txt", "tcp-kis.txt filename.")
+	format   = flag.String("format", "summary", "Output format: summary, csv, or jsonl.")
+	fields   = flag.String("fields", "", "Comma separated list of snapshot fields to export. Defaults to all fields.")
+	deltas   = flag.Bool("deltas", false, "Export only the fields that changed since the previous snapshot.")
 )
 
 func prettyPrint(results map[string]bigquery.Value) {
@@ -30,27 +42,39 @@ func prettyPrint(results map[string]bigquery.Value) {
 
 func main() {
 	flag.Parse()
-	fmt.Println(*filename)
 
-	content, err := ioutil.ReadFile(*filename)
+	content, err := readSnaplog(*filename)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 
 	snaplog, err := web100.NewSnapLog(content)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 
 	err = snaplog.ValidateSnapshots()
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
+	}
+
+	if *format != "summary" {
+		var selected []string
+		if *fields != "" {
+			selected = strings.Split(*fields, ",")
+		}
+		err = export(os.Stdout, snaplog, *format, selected, *deltas)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
+	fmt.Println(*filename)
 	last := snaplog.SnapCount() - 1
 	snap, err := snaplog.Snapshot(last)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 
 	snapValues := schema.EmptySnap()
@@ -0,0 +1,87 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+
+	"github.com/m-lab/go/cloud/bqx"
+)
+
+// ErrNoRows is returned by Count if the query returns no rows.
+var ErrNoRows = errors.New("query returned no rows")
+
+// bqClient implements BigQuery using a bigquery.Client.
+type bqClient struct {
+	client *bigquery.Client
+}
+
+// NewBigQuery returns a BigQuery that runs jobs using the client.
+func NewBigQuery(client *bigquery.Client) BigQuery {
+	return &bqClient{client: client}
+}
+
+func (bq *bqClient) table(pdt bqx.PDT) *bigquery.Table {
+	return bq.client.DatasetInProject(pdt.Project, pdt.Dataset).Table(pdt.Table)
+}
+
+// wait waits for the job to complete, and returns the job error, if any.
+func wait(ctx context.Context, job *bigquery.Job) error {
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// Count implements BigQuery.Count.
+func (bq *bqClient) Count(ctx context.Context, sql string) (int64, error) {
+	it, err := bq.client.Query(sql).Read(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var row []bigquery.Value
+	err = it.Next(&row)
+	if err == iterator.Done || (err == nil && len(row) == 0) {
+		return 0, ErrNoRows
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, ok := row[0].(int64)
+	if !ok {
+		return 0, ErrNoRows
+	}
+	return n, nil
+}
+
+// QueryToTable implements BigQuery.QueryToTable.
+func (bq *bqClient) QueryToTable(ctx context.Context, sql string, dst bqx.PDT) error {
+	q := bq.client.Query(sql)
+	q.Dst = bq.table(dst)
+	q.WriteDisposition = bigquery.WriteTruncate
+	q.CreateDisposition = bigquery.CreateIfNeeded
+	job, err := q.Run(ctx)
+	if err != nil {
+		return err
+	}
+	return wait(ctx, job)
+}
+
+// CopyTable implements BigQuery.CopyTable.
+func (bq *bqClient) CopyTable(ctx context.Context, src, dst bqx.PDT) error {
+	copier := bq.table(dst).CopierFrom(bq.table(src))
+	copier.WriteDisposition = bigquery.WriteTruncate
+	job, err := copier.Run(ctx)
+	if err != nil {
+		return err
+	}
+	return wait(ctx, job)
+}
+
+// DeleteTable implements BigQuery.DeleteTable.
+func (bq *bqClient) DeleteTable(ctx context.Context, table bqx.PDT) error {
+	return bq.table(table).Delete(ctx)
+}
@@ -0,0 +1,235 @@
+// Package dedup removes duplicate rows from table partitions, e.g. after a
+// date has been reprocessed by the batch service, which appends to the
+// existing partitions.
+//
+// For each partition, the deduplicated rows are written to a staging table,
+// and the staging table is then copied over the partition, which replaces
+// the partition atomically.  Rows appended to the partition after the staging
+// query runs are lost by the copy, so partitions that are still being
+// written, such as a date that is being reprocessed, should not be
+// deduplicated.  As a safeguard, the partition is counted again before the
+// copy, and left alone if it has grown, but this only narrows the window.
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/m-lab/go/cloud/bqx"
+)
+
+// Errors that may be returned by Deduper functions.
+var (
+	ErrUnknownType  = errors.New("unknown table type")
+	ErrInvalidRange = errors.New("invalid date range")
+	ErrRowsLost     = errors.New("dedup would remove every row")
+	ErrRowsAppended = errors.New("rows were appended to the partition during dedup")
+)
+
+// Spec describes how rows of a table type are deduplicated.
+// All fields are SQL expressions in terms of the table's columns.
+type Spec struct {
+	Key string // The natural key of a row.
+	// The parse time.  The most recently parsed row is kept.  Parser versions
+	// are not used, since they are release URLs that don't sort as strings.
+	ParseTime string
+
+	// PartitionField is the column the table is partitioned on, or empty for
+	// tables partitioned by ingestion time.
+	PartitionField string
+}
+
+// Specs contains the Spec for each known table type.
+var Specs = map[string]Spec{
+	"ndt":        {Key: "test_id", ParseTime: "parse_time"},
+	"ndt5":       {Key: "test_id", ParseTime: "ParseInfo.ParseTime"},
+	"ndt7":       {Key: "id", ParseTime: "parser.Time", PartitionField: "date"},
+	"annotation": {Key: "id", ParseTime: "parser.Time", PartitionField: "date"},
+	"tcpinfo":    {Key: "UUID", ParseTime: "ParseInfo.ParseTime"},
+	// Older traceroute tests have no UUID, so the test file is used instead.
+	"traceroute": {Key: "CONCAT(Parseinfo.TaskFileName, Parseinfo.Filename)",
+		ParseTime: "Parseinfo.ParseTime"},
+}
+
+// BigQuery is the subset of BigQuery operations needed by the Deduper.
+// It is satisfied by the client returned from NewBigQuery, and by fakes in tests.
+type BigQuery interface {
+	// Count runs a query that returns a single integer value.
+	Count(ctx context.Context, sql string) (int64, error)
+	// QueryToTable runs the query, replacing the contents of dst with the results.
+	QueryToTable(ctx context.Context, sql string, dst bqx.PDT) error
+	// CopyTable replaces the contents of dst, which may be a partition, with src.
+	CopyTable(ctx context.Context, src, dst bqx.PDT) error
+	// DeleteTable deletes the table.
+	DeleteTable(ctx context.Context, table bqx.PDT) error
+}
+
+// Report summarizes the deduplication of a single partition.
+type Report struct {
+	Partition civil.Date
+	Before    int64 // Rows in the partition before deduplication.
+	After     int64 // Rows in the partition after deduplication.
+	DryRun    bool  // If true, the partition was not changed.
+}
+
+// Removed returns the number of duplicate rows removed.
+func (r Report) Removed() int64 {
+	return r.Before - r.After
+}
+
+func (r Report) String() string {
+	action := "removed"
+	if r.DryRun {
+		action = "would remove"
+	}
+	return fmt.Sprintf("%s: %d rows, %s %d duplicates, leaving %d",
+		r.Partition, r.Before, action, r.Removed(), r.After)
+}
+
+// Deduper removes duplicate rows from partitions of a single table.
+type Deduper struct {
+	bq     BigQuery
+	table  bqx.PDT
+	spec   Spec
+	dryRun bool
+}
+
+// NewDeduper creates a Deduper for the table, which contains rows of the
+// given type, e.g. "ndt7".  If dryRun is true, the Deduper only reports the
+// number of duplicates, and does not change any tables.
+func NewDeduper(bq BigQuery, table bqx.PDT, tableType string, dryRun bool) (*Deduper, error) {
+	spec, ok := Specs[tableType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, tableType)
+	}
+	return &Deduper{bq: bq, table: table, spec: spec, dryRun: dryRun}, nil
+}
+
+// partitionFilter returns the WHERE clause that selects the partition.
+func (d *Deduper) partitionFilter(date time.Time) string {
+	if d.spec.PartitionField == "" {
+		return fmt.Sprintf(`_PARTITIONTIME = TIMESTAMP("%s")`, date.Format("2006-01-02"))
+	}
+	return fmt.Sprintf(`%s = "%s"`, d.spec.PartitionField, date.Format("2006-01-02"))
+}
+
+// key returns an expression for the key that never groups rows with a
+// missing key, so that those rows are all kept.
+func (d *Deduper) key() string {
+	return fmt.Sprintf(`IFNULL(NULLIF(%s, ""), GENERATE_UUID())`, d.spec.Key)
+}
+
+func (d *Deduper) source() string {
+	return fmt.Sprintf("`%s.%s.%s`", d.table.Project, d.table.Dataset, d.table.Table)
+}
+
+// CountQuery returns the query that counts the rows in the partition.
+func (d *Deduper) CountQuery(date time.Time) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", d.source(), d.partitionFilter(date))
+}
+
+// DistinctQuery returns the query that counts the distinct keys in the
+// partition, plus the rows without a key, which is the number of rows after
+// deduplication.
+func (d *Deduper) DistinctQuery(date time.Time) string {
+	return fmt.Sprintf(`SELECT COUNT(DISTINCT NULLIF(%s, "")) + COUNTIF(IFNULL(%s, "") = "") FROM %s WHERE %s`,
+		d.spec.Key, d.spec.Key, d.source(), d.partitionFilter(date))
+}
+
+// DedupQuery returns the query that selects the most recently parsed row for
+// each key in the partition.  Rows without a key are all kept.
+func (d *Deduper) DedupQuery(date time.Time) string {
+	return fmt.Sprintf(`SELECT * EXCEPT (row_number)
+FROM (
+  SELECT *, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s DESC) row_number
+  FROM %s
+  WHERE %s
+)
+WHERE row_number = 1`,
+		d.key(), d.spec.ParseTime, d.source(), d.partitionFilter(date))
+}
+
+// staging returns the staging table for the partition.
+func (d *Deduper) staging(date time.Time) bqx.PDT {
+	return bqx.PDT{Project: d.table.Project, Dataset: d.table.Dataset,
+		Table: d.table.Table + "_dedup_" + date.Format("20060102")}
+}
+
+// partition returns the partition of the table, using a partition decorator.
+func (d *Deduper) partition(date time.Time) bqx.PDT {
+	return bqx.PDT{Project: d.table.Project, Dataset: d.table.Dataset,
+		Table: d.table.Table + "$" + date.Format("20060102")}
+}
+
+// Partition deduplicates the partition for a single date.
+func (d *Deduper) Partition(ctx context.Context, date time.Time) (Report, error) {
+	report := Report{Partition: civil.DateOf(date), DryRun: d.dryRun}
+	var err error
+	report.Before, err = d.bq.Count(ctx, d.CountQuery(date))
+	if err != nil {
+		return report, err
+	}
+	if d.dryRun {
+		report.After, err = d.bq.Count(ctx, d.DistinctQuery(date))
+		return report, err
+	}
+	if report.Before == 0 {
+		return report, nil
+	}
+
+	staging := d.staging(date)
+	defer func() {
+		if err := d.bq.DeleteTable(ctx, staging); err != nil {
+			log.Println("Failed to delete", staging, err)
+		}
+	}()
+	err = d.bq.QueryToTable(ctx, d.DedupQuery(date), staging)
+	if err != nil {
+		return report, err
+	}
+	report.After, err = d.bq.Count(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM `%s.%s.%s`", staging.Project, staging.Dataset, staging.Table))
+	if err != nil {
+		return report, err
+	}
+	// An empty staging table would wipe the partition, so something is wrong.
+	if report.After == 0 {
+		return report, ErrRowsLost
+	}
+	if report.After == report.Before {
+		// Nothing to remove, so leave the partition alone.
+		return report, nil
+	}
+	// The copy would drop any rows appended since the staging query.
+	current, err := d.bq.Count(ctx, d.CountQuery(date))
+	if err != nil {
+		return report, err
+	}
+	if current != report.Before {
+		return report, ErrRowsAppended
+	}
+	err = d.bq.CopyTable(ctx, staging, d.partition(date))
+	return report, err
+}
+
+// Range deduplicates each partition from start to end, inclusive, returning
+// a report for each partition processed.  It stops at the first error.
+func (d *Deduper) Range(ctx context.Context, start, end time.Time) ([]Report, error) {
+	if end.Before(start) {
+		return nil, ErrInvalidRange
+	}
+	reports := []Report{}
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		report, err := d.Partition(ctx, date)
+		if err != nil {
+			return reports, fmt.Errorf("%s: %w", date.Format("2006-01-02"), err)
+		}
+		log.Println(d.table.Table, report)
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
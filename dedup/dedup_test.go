@@ -0,0 +1,193 @@
+package dedup_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-lab/go/cloud/bqx"
+
+	"github.com/m-lab/etl/dedup"
+)
+
+// fakeBQ implements dedup.BigQuery, recording the jobs it is asked to run.
+type fakeBQ struct {
+	before, distinct, staged int64 // Results for the count queries.
+	appended                 int64 // Rows appended after the first count.
+	queryErr                 error
+
+	counted bool
+
+	calls []string
+}
+
+func (f *fakeBQ) Count(ctx context.Context, sql string) (int64, error) {
+	switch {
+	case strings.Contains(sql, "_dedup_"):
+		f.calls = append(f.calls, "count staging")
+		return f.staged, nil
+	case strings.Contains(sql, "DISTINCT"):
+		f.calls = append(f.calls, "count distinct")
+		return f.distinct, nil
+	default:
+		f.calls = append(f.calls, "count")
+		if f.counted {
+			return f.before + f.appended, nil
+		}
+		f.counted = true
+		return f.before, nil
+	}
+}
+
+func (f *fakeBQ) QueryToTable(ctx context.Context, sql string, dst bqx.PDT) error {
+	f.calls = append(f.calls, "query "+dst.Table)
+	return f.queryErr
+}
+
+func (f *fakeBQ) CopyTable(ctx context.Context, src, dst bqx.PDT) error {
+	f.calls = append(f.calls, "copy "+src.Table+" "+dst.Table)
+	return nil
+}
+
+func (f *fakeBQ) DeleteTable(ctx context.Context, table bqx.PDT) error {
+	f.calls = append(f.calls, "delete "+table.Table)
+	return nil
+}
+
+var pdt = bqx.PDT{Project: "mlab-sandbox", Dataset: "raw_ndt", Table: "ndt7"}
+
+func TestDeduper_Partition(t *testing.T) {
+	date := time.Date(2020, 3, 18, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		fake    fakeBQ
+		dryRun  bool
+		want    []string
+		removed int64
+		wantErr error
+	}{
+		{
+			name:    "dry-run",
+			fake:    fakeBQ{before: 10, distinct: 7},
+			dryRun:  true,
+			want:    []string{"count", "count distinct"},
+			removed: 3,
+		},
+		{
+			name: "swap",
+			fake: fakeBQ{before: 10, staged: 7},
+			want: []string{"count", "query ndt7_dedup_20200318", "count staging", "count",
+				"copy ndt7_dedup_20200318 ndt7$20200318", "delete ndt7_dedup_20200318"},
+			removed: 3,
+		},
+		{
+			name: "appended",
+			fake: fakeBQ{before: 10, staged: 7, appended: 1},
+			want: []string{"count", "query ndt7_dedup_20200318", "count staging", "count",
+				"delete ndt7_dedup_20200318"},
+			removed: 3,
+			wantErr: dedup.ErrRowsAppended,
+		},
+		{
+			name: "no-duplicates",
+			fake: fakeBQ{before: 10, staged: 10},
+			want: []string{"count", "query ndt7_dedup_20200318", "count staging",
+				"delete ndt7_dedup_20200318"},
+		},
+		{
+			name: "empty-partition",
+			fake: fakeBQ{},
+			want: []string{"count"},
+		},
+		{
+			name: "empty-staging",
+			fake: fakeBQ{before: 10},
+			want: []string{"count", "query ndt7_dedup_20200318", "count staging",
+				"delete ndt7_dedup_20200318"},
+			removed: 10,
+			wantErr: dedup.ErrRowsLost,
+		},
+		{
+			name: "query-error",
+			fake: fakeBQ{before: 10, queryErr: errors.New("query failed")},
+			want: []string{"count", "query ndt7_dedup_20200318",
+				"delete ndt7_dedup_20200318"},
+			removed: 10,
+			wantErr: errors.New("query failed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := dedup.NewDeduper(&tt.fake, pdt, "ndt7", tt.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := d.Partition(context.Background(), date)
+			if (err == nil) != (tt.wantErr == nil) || (err != nil && err.Error() != tt.wantErr.Error()) {
+				t.Errorf("Partition() error = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Join(tt.fake.calls, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Partition() calls = %q, want %q", tt.fake.calls, tt.want)
+			}
+			if report.Removed() != tt.removed || report.DryRun != tt.dryRun {
+				t.Errorf("Partition() report = %v", report)
+			}
+		})
+	}
+}
+
+func TestDeduper_Range(t *testing.T) {
+	fake := &fakeBQ{before: 10, distinct: 8}
+	d, err := dedup.NewDeduper(fake, pdt, "ndt7", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC)
+	reports, err := d.Range(context.Background(), start, start.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 || reports[2].Partition.String() != "2020-03-01" {
+		t.Errorf("Range() = %v", reports)
+	}
+
+	_, err = d.Range(context.Background(), start, start.AddDate(0, 0, -1))
+	if err != dedup.ErrInvalidRange {
+		t.Error("Expected ErrInvalidRange, got", err)
+	}
+}
+
+func TestDeduper_Queries(t *testing.T) {
+	date := time.Date(2020, 3, 18, 0, 0, 0, 0, time.UTC)
+	_, err := dedup.NewDeduper(&fakeBQ{}, pdt, "nosuchtype", false)
+	if !errors.Is(err, dedup.ErrUnknownType) {
+		t.Error("Expected ErrUnknownType, got", err)
+	}
+
+	ndt7, err := dedup.NewDeduper(&fakeBQ{}, pdt, "ndt7", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := ndt7.DedupQuery(date)
+	for _, want := range []string{
+		"FROM `mlab-sandbox.raw_ndt.ndt7`",
+		`PARTITION BY IFNULL(NULLIF(id, ""), GENERATE_UUID())`,
+		"ORDER BY parser.Time DESC)",
+		`WHERE date = "2020-03-18"`,
+	} {
+		if !strings.Contains(q, want) {
+			t.Errorf("DedupQuery() missing %q:\n%s", want, q)
+		}
+	}
+
+	tcpinfo, err := dedup.NewDeduper(&fakeBQ{}, pdt, "tcpinfo", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `WHERE _PARTITIONTIME = TIMESTAMP("2020-03-18")`
+	if q := tcpinfo.CountQuery(date); !strings.HasSuffix(q, want) {
+		t.Errorf("CountQuery() = %q, want suffix %q", q, want)
+	}
+}
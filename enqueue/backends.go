@@ -0,0 +1,178 @@
+package enqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// ErrNotGCSObject is returned by PubSub.Add for a filename that is not a
+// gs:// uri.
+var ErrNotGCSObject = errors.New("filename is not a GCS object")
+
+// workerPath is the path of the etl_worker task handler.
+const workerPath = "/worker"
+
+// workerBody returns the form encoded body of a worker request.
+func workerBody(filename string) string {
+	return url.Values{"filename": []string{filename}}.Encode()
+}
+
+//======================================================================
+// Pub/Sub
+//======================================================================
+
+// PubSub implements Backend by publishing a message for each task to the
+// topic with the queue's name.  The messages have the same attributes and
+// JSON_API_V1 payload as GCS OBJECT_FINALIZE notifications, so that they are
+// processed by a push subscription to the etl_worker /notification handler.
+// It is THREAD-SAFE.
+type PubSub struct {
+	client *pubsub.Client
+
+	lock   sync.Mutex
+	topics map[string]*pubsub.Topic
+}
+
+// NewPubSub creates a PubSub backend.
+func NewPubSub(client *pubsub.Client) *PubSub {
+	return &PubSub{client: client, topics: map[string]*pubsub.Topic{}}
+}
+
+func (ps *PubSub) topic(queue string) *pubsub.Topic {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	t, ok := ps.topics[queue]
+	if !ok {
+		t = ps.client.Topic(queue)
+		ps.topics[queue] = t
+	}
+	return t
+}
+
+// Add implements Backend.Add.  It blocks until the message is published.
+// The filename must be a gs:// uri.
+func (ps *PubSub) Add(ctx context.Context, queue, filename string) error {
+	parts := strings.SplitN(strings.TrimPrefix(filename, "gs://"), "/", 2)
+	if !strings.HasPrefix(filename, "gs://") || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("%w: %s", ErrNotGCSObject, filename)
+	}
+	data, err := json.Marshal(map[string]string{"bucket": parts[0], "name": parts[1]})
+	if err != nil {
+		return err
+	}
+	result := ps.topic(queue).Publish(ctx, &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"eventType":     "OBJECT_FINALIZE",
+			"payloadFormat": "JSON_API_V1",
+			"bucketId":      parts[0],
+			"objectId":      parts[1],
+		},
+	})
+	_, err = result.Get(ctx)
+	return err
+}
+
+// Close stops all topics, after sending any pending messages.
+func (ps *PubSub) Close() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	for _, t := range ps.topics {
+		t.Stop()
+	}
+	ps.topics = map[string]*pubsub.Topic{}
+}
+
+//======================================================================
+// In-memory queue
+//======================================================================
+
+// memoryQueueSize limits the number of undelivered tasks in each queue.
+const memoryQueueSize = 1000
+
+// MemoryQueue implements Backend with in-memory queues, for development and
+// tests.  If a worker URL is given, tasks in each queue are posted to the
+// worker one at a time.  Failed tasks are logged, but not retried.
+// It is THREAD-SAFE.
+type MemoryQueue struct {
+	workerURL string
+	client    *http.Client
+
+	lock   sync.Mutex
+	tasks  map[string][]string    // All tasks added to each queue.
+	queues map[string]chan string // Undelivered tasks for each queue.
+	wg     sync.WaitGroup
+}
+
+// NewMemoryQueue creates a MemoryQueue.  If workerURL is empty, tasks are
+// only recorded.
+func NewMemoryQueue(workerURL string) *MemoryQueue {
+	return &MemoryQueue{workerURL: workerURL, client: &http.Client{},
+		tasks: map[string][]string{}, queues: map[string]chan string{}}
+}
+
+// Add implements Backend.Add.
+func (mq *MemoryQueue) Add(ctx context.Context, queue, filename string) error {
+	mq.lock.Lock()
+	defer mq.lock.Unlock()
+	if mq.workerURL != "" {
+		ch, ok := mq.queues[queue]
+		if !ok {
+			ch = make(chan string, memoryQueueSize)
+			mq.queues[queue] = ch
+			mq.wg.Add(1)
+			go mq.deliver(queue, ch)
+		}
+		select {
+		case ch <- filename:
+		default:
+			return ErrQueueFull
+		}
+	}
+	mq.tasks[queue] = append(mq.tasks[queue], filename)
+	return nil
+}
+
+// deliver posts each task from the channel to the worker.
+func (mq *MemoryQueue) deliver(queue string, ch chan string) {
+	defer mq.wg.Done()
+	for filename := range ch {
+		resp, err := mq.client.Post(mq.workerURL+workerPath,
+			"application/x-www-form-urlencoded", strings.NewReader(workerBody(filename)))
+		if err != nil {
+			log.Println(queue, filename, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Println(queue, filename, resp.Status)
+		}
+	}
+}
+
+// Tasks returns all tasks added to the queue.
+func (mq *MemoryQueue) Tasks(queue string) []string {
+	mq.lock.Lock()
+	defer mq.lock.Unlock()
+	return append([]string{}, mq.tasks[queue]...)
+}
+
+// Close waits for all tasks to be delivered.
+func (mq *MemoryQueue) Close() {
+	mq.lock.Lock()
+	for _, ch := range mq.queues {
+		close(ch)
+	}
+	mq.queues = map[string]chan string{}
+	mq.lock.Unlock()
+	mq.wg.Wait()
+}
@@ -0,0 +1,56 @@
+//go:build cloudtasks
+// +build cloudtasks
+
+package enqueue
+
+// The Cloud Tasks client needs a newer toolchain than the rest of the
+// enqueuer, so it is only built with -tags cloudtasks.
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	gax "github.com/googleapis/gax-go/v2"
+)
+
+// TaskCreator is the subset of the Cloud Tasks client used by CloudTasks.
+// It is satisfied by *cloudtasks.Client, and by fakes in tests.
+type TaskCreator interface {
+	CreateTask(ctx context.Context, req *cloudtaskspb.CreateTaskRequest, opts ...gax.CallOption) (*cloudtaskspb.Task, error)
+}
+
+// CloudTasks implements Backend with Cloud Tasks HTTP target tasks, which
+// POST the filename to the worker, like App Engine push queue tasks.
+type CloudTasks struct {
+	client    TaskCreator
+	parent    string // e.g. projects/mlab-sandbox/locations/us-central1
+	workerURL string
+}
+
+// NewCloudTasks creates a CloudTasks backend for queues in the project and
+// location, with tasks that are sent to the worker at workerURL.
+func NewCloudTasks(client TaskCreator, project, location, workerURL string) *CloudTasks {
+	return &CloudTasks{client: client,
+		parent:    fmt.Sprintf("projects/%s/locations/%s", project, location),
+		workerURL: workerURL}
+}
+
+// Add implements Backend.Add.
+func (ct *CloudTasks) Add(ctx context.Context, queue, filename string) error {
+	req := &cloudtaskspb.CreateTaskRequest{
+		Parent: ct.parent + "/queues/" + queue,
+		Task: &cloudtaskspb.Task{
+			MessageType: &cloudtaskspb.Task_HttpRequest{
+				HttpRequest: &cloudtaskspb.HttpRequest{
+					HttpMethod: cloudtaskspb.HttpMethod_POST,
+					Url:        ct.workerURL + workerPath,
+					Headers:    map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+					Body:       []byte(workerBody(filename)),
+				},
+			},
+		},
+	}
+	_, err := ct.client.CreateTask(ctx, req)
+	return err
+}
@@ -0,0 +1,47 @@
+//go:build cloudtasks
+// +build cloudtasks
+
+package enqueue_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	gax "github.com/googleapis/gax-go/v2"
+
+	"github.com/m-lab/etl/enqueue"
+)
+
+type fakeTaskCreator struct {
+	reqs []*cloudtaskspb.CreateTaskRequest
+}
+
+func (f *fakeTaskCreator) CreateTask(ctx context.Context, req *cloudtaskspb.CreateTaskRequest, opts ...gax.CallOption) (*cloudtaskspb.Task, error) {
+	f.reqs = append(f.reqs, req)
+	return req.Task, nil
+}
+
+func TestCloudTasks(t *testing.T) {
+	fake := &fakeTaskCreator{}
+	ct := enqueue.NewCloudTasks(fake, "mlab-sandbox", "us-central1", "https://worker.example.com")
+	if err := ct.Add(context.Background(), "etl-ndt-queue", testFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.reqs) != 1 {
+		t.Fatal("Expected one task, got", len(fake.reqs))
+	}
+	req := fake.reqs[0]
+	if req.Parent != "projects/mlab-sandbox/locations/us-central1/queues/etl-ndt-queue" {
+		t.Error("Wrong parent:", req.Parent)
+	}
+	hr := req.Task.GetHttpRequest()
+	if hr.Url != "https://worker.example.com/worker" || hr.HttpMethod != cloudtaskspb.HttpMethod_POST {
+		t.Error("Wrong request:", hr.HttpMethod, hr.Url)
+	}
+	v, err := url.ParseQuery(string(hr.Body))
+	if err != nil || v.Get("filename") != testFile {
+		t.Error("Wrong body:", string(hr.Body), err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package enqueue provides a service that accepts archive filenames over
+// HTTP, and adds a task for each one to the queue for its datatype.  It
+// replaces the App Engine queue_pusher, and can push to Cloud Tasks,
+// Pub/Sub, or an in-memory queue for development.
+package enqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/m-lab/etl/etl"
+)
+
+// Errors that may be returned by enqueue functions.
+var (
+	ErrInvalidQueues = errors.New("invalid queue specification")
+	ErrQueueFull     = errors.New("queue is full")
+)
+
+const defaultMessage = "<html><body>This is not the app you're looking for.</body></html>"
+
+// DefaultQueues maps each datatype to its daily pipeline queue.
+var DefaultQueues = map[etl.DataType]string{
+	etl.NDT: "etl-ndt-queue",
+	etl.SS:  "etl-sidestream-queue",
+	etl.PT:  "etl-traceroute-queue",
+	etl.SW:  "etl-disco-queue",
+}
+
+// Backend adds tasks to named queues.
+type Backend interface {
+	// Add adds a task to the queue, to process the archive filename, a
+	// gs:// URI.
+	Add(ctx context.Context, queue, filename string) error
+}
+
+// ParseQueues parses a comma separated list of datatype=queue pairs, e.g.
+// "ndt=etl-ndt-queue,sidestream=etl-sidestream-queue".
+func ParseQueues(s string) (map[etl.DataType]string, error) {
+	queues := map[etl.DataType]string{}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidQueues, kv)
+		}
+		queues[etl.DataType(parts[0])] = parts[1]
+	}
+	return queues, nil
+}
+
+// Receiver handles /receiver requests, which have a filename parameter, and
+// an optional queue parameter.  If the queue is not specified, the task is
+// added to the queue for the datatype of the file.  If the test-bypass
+// parameter is set, the request is validated, but no task is added.
+type Receiver struct {
+	Backend Backend
+	Queues  map[etl.DataType]string // Queue for each datatype.
+}
+
+// NewReceiver creates a Receiver that adds tasks to the backend.
+func NewReceiver(backend Backend, queues map[etl.DataType]string) *Receiver {
+	return &Receiver{Backend: backend, Queues: queues}
+}
+
+// isDirectQueueNameOK disallows any queue name that is an automatic queue
+// target.
+func (rcv *Receiver) isDirectQueueNameOK(name string) bool {
+	for _, value := range rcv.Queues {
+		if value == name {
+			return false
+		}
+	}
+	return true
+}
+
+// ServeHTTP implements http.Handler.
+func (rcv *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filename := r.FormValue("filename")
+	if filename == "" {
+		http.Error(w, `{"message": "No filename provided"}`, http.StatusBadRequest)
+		return
+	}
+
+	decodedFilename, err := etl.GetFilename(filename)
+	if err != nil {
+		http.Error(w, `{"message": "Could not base64decode filename"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Validate filename.
+	fnData, err := etl.ValidateTestPath(decodedFilename)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"message": "Invalid filename."}`)
+		return
+	}
+
+	// Determine correct queue based on parameter or file name.
+	var ok bool
+	queuename := r.FormValue("queue")
+	if queuename != "" {
+		ok = rcv.isDirectQueueNameOK(queuename)
+	} else {
+		queuename, ok = rcv.Queues[fnData.GetDataType()]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"message": "Invalid queuename."}`)
+		return
+	}
+
+	// Skip queuing if bypass for test.
+	if r.FormValue("test-bypass") != "" {
+		return
+	}
+	if err := rcv.Backend.Add(r.Context(), queuename, decodedFilename); err != nil {
+		log.Println(queuename, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// defaultHandler handles the root path.
+func defaultHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"message": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	fmt.Fprintf(w, defaultMessage)
+}
+
+// NewHandler returns a handler for the service, with the receiver at
+// /receiver.
+func NewHandler(rcv *Receiver) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", defaultHandler)
+	mux.Handle("/receiver", rcv)
+	return mux
+}
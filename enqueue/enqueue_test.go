@@ -0,0 +1,247 @@
+package enqueue_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	"github.com/m-lab/etl/enqueue"
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/worker"
+)
+
+const testFile = `gs://m-lab-sandbox/ndt/2016/01/26/20160126T000000Z-mlab1-prg01-ndt-0007.tgz`
+
+func TestReceiver(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte(testFile))
+	tests := []struct {
+		name     string
+		filename string
+		queue    string
+		bypass   bool
+		status   int
+		want     string // Queue that should receive the task.
+	}{
+		{name: "missing", status: http.StatusBadRequest},
+		{
+			// This will fail GetFilename, which tries to base64 decode if it doesn't start with gs://
+			name:     "not-base64",
+			filename: "x" + testFile,
+			status:   http.StatusBadRequest,
+		},
+		{
+			name:     "invalid-name",
+			filename: `gs://m-lab-sandbox/ndt/2016/01/26/20160126T000000Z-mlab1-prg1-ndt-0007.tar.gz`,
+			status:   http.StatusBadRequest,
+		},
+		{name: "ok", filename: testFile, status: http.StatusOK, want: "etl-ndt-queue"},
+		{name: "base64", filename: encoded, status: http.StatusOK, want: "etl-ndt-queue"},
+		{name: "bypass", filename: testFile, bypass: true, status: http.StatusOK},
+		{name: "direct", filename: testFile, queue: "etl-ndt-batch_0", status: http.StatusOK, want: "etl-ndt-batch_0"},
+		{
+			// Should fail, because this is a daily pipeline queue.
+			name:     "direct-daily",
+			filename: testFile,
+			queue:    "etl-sidestream-queue",
+			status:   http.StatusBadRequest,
+		},
+		{
+			name:     "no-queue-for-type",
+			filename: `gs://m-lab-sandbox/ndt/ndt7/2020/03/18/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt.tgz`,
+			status:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mq := enqueue.NewMemoryQueue("")
+			srv := httptest.NewServer(enqueue.NewHandler(enqueue.NewReceiver(mq, enqueue.DefaultQueues)))
+			defer srv.Close()
+
+			v := url.Values{}
+			if tt.filename != "" {
+				v.Set("filename", tt.filename)
+			}
+			if tt.queue != "" {
+				v.Set("queue", tt.queue)
+			}
+			if tt.bypass {
+				v.Set("test-bypass", "true")
+			}
+			resp, err := http.Get(srv.URL + "/receiver?" + v.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.want == "" {
+				for _, q := range append([]string{tt.queue}, "etl-ndt-queue") {
+					if tasks := mq.Tasks(q); len(tasks) != 0 {
+						t.Error("Unexpected tasks:", tasks)
+					}
+				}
+				return
+			}
+			// Backends always receive the decoded filename.
+			if tasks := mq.Tasks(tt.want); !reflect.DeepEqual(tasks, []string{testFile}) {
+				t.Errorf("Tasks(%s) = %v", tt.want, tasks)
+			}
+		})
+	}
+}
+
+type failingBackend struct{}
+
+func (failingBackend) Add(ctx context.Context, queue, filename string) error {
+	return errors.New("add failed")
+}
+
+func TestReceiverBackendError(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/receiver?filename="+testFile, nil)
+	enqueue.NewReceiver(failingBackend{}, enqueue.DefaultQueues).ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Error("Expected 500, got", w.Code)
+	}
+}
+
+func TestParseQueues(t *testing.T) {
+	queues, err := enqueue.ParseQueues("ndt=etl-ndt-queue,tcpinfo=etl-tcpinfo-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[etl.DataType]string{etl.NDT: "etl-ndt-queue", etl.TCPINFO: "etl-tcpinfo-queue"}
+	if !reflect.DeepEqual(queues, want) {
+		t.Error("ParseQueues() =", queues)
+	}
+	for _, bad := range []string{"", "ndt", "ndt=", "=etl-ndt-queue", "ndt=q,"} {
+		if _, err := enqueue.ParseQueues(bad); !errors.Is(err, enqueue.ErrInvalidQueues) {
+			t.Errorf("ParseQueues(%q) error = %v", bad, err)
+		}
+	}
+}
+
+func TestMemoryQueueDelivery(t *testing.T) {
+	var lock sync.Mutex
+	received := []string{}
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/worker" || r.Method != http.MethodPost {
+			t.Error("Unexpected request:", r.Method, r.URL)
+		}
+		lock.Lock()
+		received = append(received, r.FormValue("filename"))
+		lock.Unlock()
+	}))
+	defer worker.Close()
+
+	mq := enqueue.NewMemoryQueue(worker.URL)
+	files := []string{"a", "b", "c"}
+	for _, f := range files {
+		if err := mq.Add(context.Background(), "etl-ndt-queue", f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mq.Close()
+	if !reflect.DeepEqual(received, files) {
+		t.Error("Worker received", received)
+	}
+}
+
+// pushBody returns the body of a Pub/Sub push request for the message.
+func pushBody(t *testing.T, attrs map[string]string, data []byte) []byte {
+	var req struct {
+		Message struct {
+			Attributes map[string]string `json:"attributes"`
+			Data       []byte            `json:"data"`
+			MessageID  string            `json:"messageId"`
+		} `json:"message"`
+	}
+	req.Message.Attributes = attrs
+	req.Message.Data = data
+	req.Message.MessageID = "1"
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	srv := pstest.NewServer()
+	defer srv.Close()
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := pubsub.NewClient(ctx, "mlab-sandbox", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.CreateTopic(ctx, "etl-ndt-queue"); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := enqueue.NewPubSub(client)
+	defer ps.Close()
+	if err := ps.Add(ctx, "etl-ndt-queue", testFile); err != nil {
+		t.Fatal(err)
+	}
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatal("Expected one message, got", len(msgs))
+	}
+	// The worker's notification handler must accept the message.
+	n, err := worker.DecodeNotification(pushBody(t, msgs[0].Attributes, msgs[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.EventType != worker.ObjectFinalize || n.Path() != testFile {
+		t.Error("Wrong notification:", n)
+	}
+	// The notification payload has the same object.
+	n, err = worker.DecodeNotification(pushBody(t,
+		map[string]string{"eventType": worker.ObjectFinalize}, msgs[0].Data))
+	if err != nil || n.Path() != testFile {
+		t.Error("Wrong payload:", string(msgs[0].Data), err)
+	}
+	if err := ps.Add(ctx, "etl-ndt-queue", "not-a-gcs-uri"); !errors.Is(err, enqueue.ErrNotGCSObject) {
+		t.Error("Expected ErrNotGCSObject, got", err)
+	}
+	// The topic must exist.
+	if err := ps.Add(ctx, "no-such-topic", testFile); err == nil {
+		t.Error("Expected error for missing topic")
+	}
+
+	// The Cloud Function sends base64 encoded filenames to the receiver.
+	w := httptest.NewRecorder()
+	encoded := base64.StdEncoding.EncodeToString([]byte(testFile))
+	r := httptest.NewRequest("GET", "/receiver?filename="+url.QueryEscape(encoded), nil)
+	enqueue.NewReceiver(ps, enqueue.DefaultQueues).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("Expected 200, got", w.Code, w.Body.String())
+	}
+	msgs = srv.Messages()
+	if len(msgs) != 2 {
+		t.Fatal("Expected two messages, got", len(msgs))
+	}
+	n, err = worker.DecodeNotification(pushBody(t, msgs[1].Attributes, msgs[1].Data))
+	if err != nil || n.Path() != testFile {
+		t.Error("Wrong notification:", n, err)
+	}
+}
@@ -54,7 +54,7 @@ const mlabNSiteNN = `-(mlab\d)-([a-z]{3}\d[0-9t])-`
 
 // This parses the experiment name, optional -NNNN sequence number, and optional -e (for old embargoed files)
 const expNNNNE = `([a-z-]+)(?:-(\d{4}))?(-e)?`
-const suffix = `(\.tar|\.tar.gz|\.tgz)$`
+const suffix = `(\.tar|\.tar.gz|\.tgz|\.tar\.zst|\.tzst|\.tar\.bz2|\.tbz2|\.tar\.xz|\.txz)$`
 
 // These are here to facilitate use across queue-pusher and parsing components.
 var (
@@ -72,8 +72,16 @@ var (
 	sitePattern     = regexp.MustCompile(type2 + mlabNSiteNN)
 
 	justSitePattern = regexp.MustCompile(`.*` + mlabNSiteNN + `.*`)
+
+	archivePattern = regexp.MustCompile(suffix)
 )
 
+// IsArchive returns true if the filename has one of the supported archive
+// suffixes.  The compression itself is detected from the archive content.
+func IsArchive(fn string) bool {
+	return archivePattern.MatchString(fn)
+}
+
 // DataPath breaks out the components of a task filename.
 type DataPath struct {
 	URI string // The full URI
@@ -221,6 +229,17 @@ func (dt DataType) BQBufferSize() int {
 	return dataTypeToBQBufferSize[dt]
 }
 
+// ExpansionFactor returns the approximate ratio of the memory used while
+// parsing an archive of this type to its compressed size.  Unknown types
+// return 1.
+func (dt DataType) ExpansionFactor() float64 {
+	f, ok := dataTypeToExpansionFactor[dt]
+	if !ok {
+		return 1
+	}
+	return f
+}
+
 // These constants enumerate the different data types.
 // TODO - use camelcase.
 const (
@@ -281,6 +300,20 @@ var (
 	}
 	// There is also a mapping of data types to queue names in
 	// queue_pusher.go
+
+	// Map from data type to the approximate ratio of the memory used while
+	// parsing an archive to its compressed size.
+	// TODO - this should be loaded from a config.
+	dataTypeToExpansionFactor = map[DataType]float64{
+		ANNOTATION: 3,
+		NDT:        10, // gzipped snaplogs, and rows with deltas.
+		SS:         5,
+		PT:         5,
+		SW:         5,
+		TCPINFO:    8, // zstd compressed, and large rows.
+		NDT5:       3,
+		NDT7:       3,
+	}
 )
 
 /*******************************************************************************
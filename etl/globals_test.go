@@ -111,6 +111,21 @@ func TestValidateTestPath(t *testing.T) {
 				"archive-mlab-oti", "ndt", "traceroute", "2019/06/20", "20190620", "224809", "traceroute", "mlab1", "den06", "ndt", "", "", ".tgz",
 			},
 		},
+		{
+			name:     "pusher-tcpinfo-zstd",
+			path:     `gs://pusher-mlab-staging/ndt/tcpinfo/2019/05/25/20190525T020001.697396Z-tcpinfo-mlab4-ord01-ndt.tar.zst`,
+			wantType: etl.TCPINFO,
+			want: etl.DataPath{
+				`gs://pusher-mlab-staging/ndt/tcpinfo/2019/05/25/20190525T020001.697396Z-tcpinfo-mlab4-ord01-ndt.tar.zst`,
+				"pusher-mlab-staging", "ndt", "tcpinfo", "2019/05/25", "20190525", "020001", "tcpinfo", "mlab4", "ord01", "ndt", "", "", ".tar.zst",
+			},
+		},
+		{
+			name:     "error-zip-extension",
+			path:     `gs://pusher-mlab-staging/ndt/tcpinfo/2019/05/25/20190525T020001.697396Z-tcpinfo-mlab4-ord01-ndt.zip`,
+			wantErr:  true,
+			wantType: "invalid",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -3,6 +3,7 @@ package factory
 
 import (
 	"context"
+	"net/http"
 
 	v2 "github.com/m-lab/annotation-service/api/v2"
 
@@ -67,3 +68,59 @@ func (ann *defaultAnnotatorFactory) Get(ctx context.Context, dp etl.DataPath) (v
 func DefaultAnnotatorFactory() AnnotatorFactory {
 	return &defaultAnnotatorFactory{}
 }
+
+// FanOutChild names a SinkFactory that provides one child of a fan-out sink.
+type FanOutChild struct {
+	Name    string
+	Factory SinkFactory
+}
+
+type fanOutSinkFactory struct {
+	mode     row.FanOutMode
+	children []FanOutChild
+}
+
+// Get implements SinkFactory.Get
+func (sf *fanOutSinkFactory) Get(ctx context.Context, dp etl.DataPath) (row.Sink, etl.ProcessingError) {
+	children := make([]row.Child, 0, len(sf.children))
+	for _, c := range sf.children {
+		sink, err := c.Factory.Get(ctx, dp)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, row.Child{Name: c.Name, Sink: sink})
+	}
+	fo, err := row.NewFanOut(sf.mode, children...)
+	if err != nil {
+		return nil, NewError(dp.DataType, "FanOutSink", http.StatusInternalServerError, err)
+	}
+	return fo, nil
+}
+
+// NewFanOutSinkFactory returns a SinkFactory that provides FanOut sinks,
+// with a child from each of the factories.  The first child is the primary.
+func NewFanOutSinkFactory(mode row.FanOutMode, children ...FanOutChild) SinkFactory {
+	return &fanOutSinkFactory{mode: mode, children: children}
+}
+
+type privacySinkFactory struct {
+	inner  SinkFactory
+	policy *row.PrivacyPolicy
+}
+
+// Get implements SinkFactory.Get
+func (sf *privacySinkFactory) Get(ctx context.Context, dp etl.DataPath) (row.Sink, etl.ProcessingError) {
+	sink, err := sf.inner.Get(ctx, dp)
+	if err != nil || !sf.policy.AppliesTo(dp.DataType) {
+		return sink, err
+	}
+	return row.NewFilter(sink, sf.policy, dp.Site), nil
+}
+
+// NewPrivacySinkFactory returns a SinkFactory that wraps the inner factory's
+// sinks in a row.Filter, for datatypes covered by the privacy policy.  The
+// inner factory may be a fan-out factory, but the privacy factory may not be
+// one of a fan-out factory's children.
+func NewPrivacySinkFactory(inner SinkFactory, policy *row.PrivacyPolicy) SinkFactory {
+	return &privacySinkFactory{inner: inner, policy: policy}
+}
@@ -50,6 +50,14 @@ var (
 			Help: "Release tag from repo build",
 		}, []string{"value"})
 
+	// PrivacyPolicy records the version of the privacy policy applied to
+	// parsed rows, if any.
+	PrivacyPolicy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "etl_privacy_policy",
+			Help: "Version of the privacy policy applied to parsed rows",
+		}, []string{"value"})
+
 	// NumCPU makes the number of cpus available for prometheus calculations.
 	NumCPU = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -349,6 +357,21 @@ var (
 		[]string{"table", "filetype", "kind"},
 	)
 
+	// SalvagedTestCount counts the tests whose snapshot logs were corrupted
+	// or truncated, but which were saved by keeping only the valid snapshots.
+	//
+	// Provides metrics:
+	//   etl_salvaged_test_count{table, filetype}
+	// Example usage:
+	//   metrics.SalvagedTestCount.WithLabelValues(TableName(), "s2c").Inc()
+	SalvagedTestCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_salvaged_test_count",
+			Help: "Tests with corrupted snapshot logs saved by keeping only valid snapshots.",
+		},
+		[]string{"table", "filetype"},
+	)
+
 	// ErrorCount counts the all errors that result in test loss.
 	//
 	// Provides metrics:
@@ -396,6 +419,100 @@ var (
 		[]string{"table", "phase", "retries", "status"},
 	)
 
+	// LoadJobCount counts BigQuery load jobs, and the rows they load.
+	//
+	// Provides metrics:
+	//   etl_load_job_count{table, status}
+	//   etl_load_job_row_count{table, status}
+	// Example usage:
+	//   metrics.LoadJobCount.WithLabelValues(table, "ok").Inc()
+	//   metrics.LoadJobRowCount.WithLabelValues(table, "ok").Add(rows)
+	LoadJobCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_load_job_count",
+			Help: "Number of BigQuery load jobs, by status.",
+		},
+		// ndt7/tcpinfo, ok/retry/failed/stage failed
+		[]string{"table", "status"},
+	)
+	LoadJobRowCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_load_job_row_count",
+			Help: "Number of rows in BigQuery load jobs, by status.",
+		},
+		[]string{"table", "status"},
+	)
+
+	// WriteStreamCount counts Storage Write API streams, and the rows they
+	// contain, by final status.
+	//
+	// Provides metrics:
+	//   etl_write_stream_count{table, status}
+	//   etl_write_stream_row_count{table, status}
+	// Example usage:
+	//   metrics.WriteStreamCount.WithLabelValues(table, "committed").Inc()
+	//   metrics.WriteStreamRowCount.WithLabelValues(table, "committed").Add(rows)
+	WriteStreamCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_write_stream_count",
+			Help: "Number of BigQuery write streams, by status.",
+		},
+		// ndt7/tcpinfo, committed/discarded/incomplete/failed
+		[]string{"table", "status"},
+	)
+	WriteStreamRowCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_write_stream_row_count",
+			Help: "Number of rows in BigQuery write streams, by status.",
+		},
+		[]string{"table", "status"},
+	)
+
+	// FanOutRowCount counts the rows committed to each child of a fan-out sink.
+	//
+	// Provides metrics:
+	//   etl_fanout_row_count{table, child, status}
+	// Example usage:
+	//   metrics.FanOutRowCount.WithLabelValues(table, "sandbox", "ok").Add(rows)
+	FanOutRowCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_fanout_row_count",
+			Help: "Number of rows committed to each child of a fan-out sink, by status.",
+		},
+		// ndt7/tcpinfo, child name, ok/failed/dropped
+		[]string{"table", "child", "status"},
+	)
+
+	// NotificationCount counts the GCS notifications received by the worker.
+	//
+	// Provides metrics:
+	//   etl_notification_count{datatype, status}
+	// Example usage:
+	//   metrics.NotificationCount.WithLabelValues("ndt5", "ok").Inc()
+	NotificationCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_notification_count",
+			Help: "Number of GCS notifications received, by status.",
+		},
+		// ndt5/tcpinfo, ok/Retry/Failed/Duplicate/IgnoredDataType/...
+		[]string{"datatype", "status"},
+	)
+
+	// PrivacyRowCount counts the rows filtered by a privacy policy.
+	//
+	// Provides metrics:
+	//   etl_privacy_row_count{table, status}
+	// Example usage:
+	//   metrics.PrivacyRowCount.WithLabelValues("ndt5", "dropped").Inc()
+	PrivacyRowCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "etl_privacy_row_count",
+			Help: "Number of rows filtered by the privacy policy, by status.",
+		},
+		// ndt5/tcpinfo, kept/dropped/dropped_site/not_redactable
+		[]string{"table", "status"},
+	)
+
 	// TODO(dev): bytes/row - generalize this metric for any file type.
 	//
 	// RowSizeHistogram provides a histogram of bq row json sizes.  It is intended primarily for
@@ -505,6 +622,30 @@ var (
 		[]string{"table", "status"},
 	)
 
+	// InsertThrottleHistogram provides a histogram of the time spent waiting
+	// for the per table insert rate limiters.  The sum is the total time spent
+	// throttled.
+	//
+	// Provides metrics:
+	//   etl_insert_throttle_time_seconds_bucket{table="...", le="..."}
+	//   ...
+	//   etl_insert_throttle_time_seconds_sum{table="..."}
+	//   etl_insert_throttle_time_seconds_count{table="..."}
+	// Usage example:
+	//   metrics.InsertThrottleHistogram.WithLabelValues(
+	//           "ndt_20170601").Observe(delay.Seconds())
+	InsertThrottleHistogram = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "etl_insert_throttle_time_seconds",
+			Help: "Time spent waiting for insert rate limits.",
+			Buckets: []float64{
+				0, 0.001, 0.003, 0.01, 0.03, 0.1, 0.2, 0.5, 1.0, 2.0,
+				5.0, 10.0, 20.0, 50.0, 100.0, math.Inf(+1),
+			},
+		},
+		[]string{"table"},
+	)
+
 	// DurationHistogram provides a histogram of worker processing times. The buckets should use
 	// periods that are intuitive for people.
 	//
@@ -535,7 +676,9 @@ var (
 	)
 
 	// FileSizeHistogram provides a histogram of source file sizes. The bucket
-	// sizes should cover a wide range of input file sizes.
+	// sizes should cover a wide range of input file sizes.  Compressed files
+	// are observed twice: once with their compressed size, with status
+	// "compressed", and once with their uncompressed size.
 	//
 	// Example usage:
 	//   metrics.FileSizeHistogram.WithLabelValues(
@@ -198,12 +198,28 @@ func (buf *RowBuffer) Annotate(metricLabel string) error {
 type Base struct {
 	etl.Inserter
 	RowBuffer
+	policy *row.PrivacyPolicy // If not nil, applied to rows before they are inserted.
 }
 
 // NewBase creates a new parser.Base.  This will generally be embedded in a type specific parser.
 func NewBase(ins etl.Inserter, bufSize int, ann v2as.Annotator) *Base {
 	buf := RowBuffer{bufSize, make([]interface{}, 0, bufSize), ann}
-	return &Base{ins, buf}
+	return &Base{Inserter: ins, RowBuffer: buf}
+}
+
+// TakeRows returns all rows in the buffer that pass the privacy policy, if
+// any, and clears the buffer.
+// Not thread-safe.  Should only be called by owning thread.
+func (pb *Base) TakeRows() []interface{} {
+	rows := pb.RowBuffer.TakeRows()
+	if pb.policy == nil {
+		return rows
+	}
+	kept, _, err := pb.policy.Apply(rows, pb.TableBase())
+	if err != nil {
+		log.Println(pb.TableBase(), err)
+	}
+	return kept
 }
 
 // TaskError return the task level error, based on failed rows, or any other criteria.
@@ -73,6 +73,7 @@ func (dp *DiscoParser) ParseAndInsert(meta map[string]bigquery.Value, testName s
 			TestID:        testName,
 			ParseTime:     time.Now(),
 			ParserVersion: Version(),
+			Index:         rowCount,
 			// TODO: original archive "log_time" is unknown.
 		}
 		tmp := schema.SwitchStats{}
@@ -33,6 +33,7 @@ import (
 	"github.com/m-lab/etl/annotation"
 	"github.com/m-lab/etl/etl"
 	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/row"
 	"github.com/m-lab/etl/schema"
 	"github.com/m-lab/etl/web100"
 	"github.com/prometheus/client_golang/prometheus"
@@ -44,8 +45,25 @@ var (
 	// NDTEstimateBW flag indicates if we should run BW estimation code
 	// and annotate rows.
 	NDTEstimateBW, _ = strconv.ParseBool(os.Getenv("NDT_ESTIMATE_BW"))
+	// NDTSalvageSnapshots flag indicates if corrupted or truncated snaplogs
+	// should be salvaged by keeping the valid snapshots before the corruption.
+	NDTSalvageSnapshots, _ = strconv.ParseBool(os.Getenv("NDT_SALVAGE_SNAPSHOTS"))
+	// NDTDeltaStrategy selects which snapshots are used for deltas, when
+	// deltas are not omitted.  See ParseDeltaStrategy.
+	NDTDeltaStrategy = deltaStrategyFromEnv("NDT_DELTA_STRATEGY")
 )
 
+// deltaStrategyFromEnv parses the delta strategy in the environment variable.
+// An invalid strategy is fatal, since it would otherwise drop or distort
+// every NDT row.
+func deltaStrategyFromEnv(name string) DeltaStrategy {
+	strategy, err := ParseDeltaStrategy(os.Getenv(name))
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return strategy
+}
+
 const (
 	// Some snaplogs are very large, and we don't want to parse the entire
 	// snaplog, when there is no value.  However, although the nominal test
@@ -159,7 +177,9 @@ func NewNDTParser(ins etl.Inserter, annotator ...v2as.Annotator) *NDTParser {
 		ann = v2as.GetAnnotator(annotation.BatchURL)
 	}
 
-	return &NDTParser{Base: *NewBase(ins, bufSize, ann)}
+	n := &NDTParser{Base: *NewBase(ins, bufSize, ann)}
+	n.policy = PrivacyPolicy(etl.NDT)
+	return n
 }
 
 // These functions implement the etl.Parser interface.
@@ -404,9 +424,20 @@ func (n *NDTParser) getDeltas(snaplog *web100.SnapLog, testType string) ([]schem
 	if NDTOmitDeltas {
 		return deltas, deltaFieldCount
 	}
+	limit := snaplog.SnapCount()
+	if limit > maxNumSnapshots {
+		limit = maxNumSnapshots
+	}
+	indices, err := NDTDeltaStrategy.Indices(snaplog, limit)
+	if err != nil {
+		metrics.ErrorCount.WithLabelValues(
+			n.TableName(), testType, "delta strategy failure").Inc()
+		log.Printf("Delta strategy %s failed: %v\n", NDTDeltaStrategy, err)
+		return nil, 0
+	}
 	snapshotCount := 0
 	last := &web100.Snapshot{}
-	for count := 0; count < snaplog.SnapCount() && count < maxNumSnapshots; count++ {
+	for _, count := range indices {
 		snap, err := snaplog.Snapshot(count)
 		if err != nil {
 			// TODO - refine label and maybe write a log?
@@ -494,6 +525,27 @@ func (n *NDTParser) getAndInsertValues(test *fileInfoAndData, testType string) {
 		valid = false
 	}
 
+	salvaged := 0
+	if !valid && NDTSalvageSnapshots {
+		// Keep only the snapshots before the corruption, so that a
+		// corrupted snapshot in the middle doesn't cause the whole test
+		// to be dropped.  If nothing can be salvaged, the snaplog is
+		// left unchanged, and parsed as it would be without salvaging.
+		kept, dropped, salvageErr := snaplog.Salvage()
+		switch {
+		case salvageErr != nil:
+			metrics.WarningCount.WithLabelValues(
+				n.TableName(), testType, "unsalvageable snaplog").Inc()
+			log.Printf("Unable to salvage snaplog for %s, when processing: %s (%s)\n",
+				test.fn, n.taskFileName, salvageErr)
+		case dropped > 0:
+			log.Printf("Salvaged %d snapshots (dropped %d) for %s, when processing: %s\n",
+				kept, dropped, test.fn, n.taskFileName)
+			metrics.SalvagedTestCount.WithLabelValues(n.TableName(), testType).Inc()
+			salvaged = kept
+		}
+	}
+
 	var deltas []schema.Web100ValueMap
 	deltaFieldCount := 0
 	deltas, deltaFieldCount = n.getDeltas(snaplog, testType)
@@ -541,6 +593,10 @@ func (n *NDTParser) getAndInsertValues(test *fileInfoAndData, testType string) {
 	if !valid {
 		results["anomalies"].(schema.Web100ValueMap)["snaplog_error"] = true
 	}
+	if salvaged > 0 {
+		results["anomalies"].(schema.Web100ValueMap)["truncated"] = true
+		results["anomalies"].(schema.Web100ValueMap)["salvaged_snaps"] = salvaged
+	}
 
 	if NDTEstimateBW {
 		// This is not terribly useful as is.  Intended as a place holder for code
@@ -614,7 +670,7 @@ func (n *NDTParser) getAndInsertValues(test *fileInfoAndData, testType string) {
 	// TODO - estimate the size of the json (or fields) to allow more rows per request,
 	// but avoid going over the 10MB limit.
 	// Add row to buffer, possibly flushing buffer if it is full.
-	ndtTest := NDTTest{results}
+	ndtTest := NDTTest{results, row.InsertID(n.taskFileName, test.fn, 0)}
 	err = n.Base.AddRow(ndtTest)
 	if err == etl.ErrBufferFull {
 		// Ignore annotation errors.  They are counted and logged elsewhere.
@@ -728,6 +784,13 @@ func (n *NDTParser) fixValues(r schema.Web100ValueMap) {
 // NDTTest is a wrapper for Web100ValueMap that implements Annotatable.
 type NDTTest struct {
 	schema.Web100ValueMap
+	insertID string
+}
+
+// Save implements bigquery.ValueSaver, providing an insert ID derived from
+// the task file and snaplog, so that retried tasks are deduplicated.
+func (ndt NDTTest) Save() (map[string]bigquery.Value, string, error) {
+	return ndt.Web100ValueMap, ndt.insertID, nil
 }
 
 // Only valid on top level
@@ -779,6 +842,38 @@ func (ndt NDTTest) GetServerIP() string {
 	return ip
 }
 
+// truncateIP truncates the IP at the path in the map, if it is present.
+func truncateIP(vm schema.Web100ValueMap, p *row.PrivacyPolicy, path ...string) {
+	m := vm.GetMap(path[:len(path)-1])
+	key := path[len(path)-1]
+	if ip, ok := m[key].(string); ok {
+		m[key] = p.TruncateIP(ip)
+	}
+}
+
+// Redact implements row.Redactable.  The legacy NDT schema has no ParseInfo,
+// so the policy version is not recorded.
+func (ndt NDTTest) Redact(p *row.PrivacyPolicy) bool {
+	connSpec := ndt.getConnSpec()
+	clientIP, _ := connSpec["client_ip"].(string)
+	serverIP, _ := connSpec["server_ip"].(string)
+	if p.DropIP(clientIP) || p.DropIP(serverIP) {
+		return false
+	}
+	truncateIP(ndt.Web100ValueMap, p, "connection_spec", "client_ip")
+	truncateIP(ndt.Web100ValueMap, p, "web100_log_entry", "connection_spec", "remote_ip")
+	truncateIP(ndt.Web100ValueMap, p, "web100_log_entry", "snap", "RemAddress")
+	if deltas, ok := ndt.GetMap([]string{"web100_log_entry"})["deltas"].([]schema.Web100ValueMap); ok {
+		for _, d := range deltas {
+			truncateIP(d, p, "RemAddress")
+		}
+	}
+	if hn, ok := connSpec["client_hostname"].(string); ok && p.Hostname(hn) == "" {
+		delete(connSpec, "client_hostname")
+	}
+	return true
+}
+
 // CopyStructToMap takes a POINTER to an arbitrary SIMPLE struct and copies
 // it's fields into a value map. It will also make fields entirely
 // lower case, for convienece when working with exported structs. Also,
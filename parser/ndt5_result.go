@@ -85,9 +85,10 @@ func (dp *NDT5ResultParser) ParseAndInsert(meta map[string]bigquery.Value, testN
 	rdr := bytes.NewReader(test)
 	dec := json.NewDecoder(rdr)
 
-	for dec.More() {
+	for index := 0; dec.More(); index++ {
 		stats := schema.NDT5ResultRow{
 			TestID: testName,
+			Index:  index,
 			ParseInfo: &schema.ParseInfoV0{
 				TaskFileName:  meta["filename"].(string),
 				ParseTime:     time.Now(),
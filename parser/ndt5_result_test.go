@@ -1,13 +1,19 @@
 package parser_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"strings"
 	"testing"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/m-lab/etl/bq"
+	"github.com/m-lab/etl/fake"
 	"github.com/m-lab/etl/parser"
+	"github.com/m-lab/etl/row"
 	"github.com/m-lab/etl/schema"
+	"github.com/m-lab/go/cloud/bqx"
+	"github.com/m-lab/ndt-server/metadata"
 )
 
 func TestNDT5ResultParser_ParseAndInsert(t *testing.T) {
@@ -98,3 +104,99 @@ func TestNDT5ResultParser_IsParsable(t *testing.T) {
 		})
 	}
 }
+
+// parseNDT5Task parses the NDT5 test files as a single task, using a real sink
+// with a fake uploader, and returns the insert IDs of the uploaded rows.
+func parseNDT5Task(t *testing.T, testNames ...string) []string {
+	uploader := fake.NewFakeUploader()
+	sink, err := bq.NewColumnPartitionedInserterWithUploader(
+		bqx.PDT{Project: "mlab-sandbox", Dataset: "dataset", Table: "ndt5"}, uploader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := parser.NewNDT5ResultParser(sink, "test", "_suffix", &fakeAnnotator{})
+	meta := map[string]bigquery.Value{
+		"filename": "gs://mlab-test-bucket/ndt/ndt5/2019/08/22/ndt_ndt5_2019_08_22_20190822T194819.568936Z-ndt5-mlab1-lga0t-ndt.tgz",
+	}
+	for _, testName := range testNames {
+		resultData, err := ioutil.ReadFile(`testdata/NDT5Result/` + testName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.ParseAndInsert(meta, testName, resultData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := n.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, r := range uploader.Rows {
+		ids = append(ids, r.InsertID)
+	}
+	return ids
+}
+
+func TestNDT5ResultInsertIDs(t *testing.T) {
+	testNames := []string{
+		`ndt-5hkck_1566219987_000000000000017D.json`,
+		`ndt-vscqp_1565987984_000000000001A1C2.json`,
+	}
+	first := parseNDT5Task(t, testNames...)
+	if len(first) != 2 {
+		t.Fatal("Expected 2 rows, got", len(first))
+	}
+	if first[0] == "" || first[0] == first[1] {
+		t.Error("Insert IDs should be unique and non-empty:", first)
+	}
+
+	// A retry of the same task should produce the same IDs.
+	retry := parseNDT5Task(t, testNames...)
+	if strings.Join(retry, ",") != strings.Join(first, ",") {
+		t.Errorf("Insert IDs changed on retry: %v != %v", retry, first)
+	}
+}
+
+func TestNDT5ResultRow_Redact(t *testing.T) {
+	p, err := row.ParsePrivacyPolicy([]byte(redactPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins := newInMemorySink()
+	n := parser.NewNDT5ResultParser(ins, "test", "_suffix", &fakeAnnotator{})
+	testName := `ndt-5hkck_1566219987_000000000000017D.json`
+	resultData, err := ioutil.ReadFile(`testdata/NDT5Result/` + testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := map[string]bigquery.Value{"filename": "gs://mlab-test-bucket/ndt/ndt5/2019/08/22/foo.tgz"}
+	if err := n.ParseAndInsert(meta, testName, resultData); err != nil {
+		t.Fatal(err)
+	}
+	n.Flush()
+	r := ins.data[0].(*schema.NDT5ResultRow)
+	// Clients may report their hostname in the metadata.
+	ctl := r.Result.Control
+	ctl.ClientMetadata = append(ctl.ClientMetadata,
+		metadata.NameValue{Name: "client.hostname", Value: "host.example.com"})
+
+	if !r.Redact(p) {
+		t.Fatal("Redact() dropped row")
+	}
+	j, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"2620:0:1003:416:1397:3d80:43ba:2cea", "host.example.com"} {
+		if strings.Contains(string(j), s) {
+			t.Errorf("Redacted row contains %q", s)
+		}
+	}
+	if r.Result.ClientIP != "127.0.0.0" || r.Result.C2S.ClientIP != "2620:0:1003::" ||
+		r.Result.S2C.ClientIP != "2620:0:1003::" || r.Result.C2S.ServerIP != "2001:1900:2100:2d::75" {
+		t.Errorf("Redact() = %+v, %+v, %+v", r.Result, r.Result.C2S, r.Result.S2C)
+	}
+	if len(ctl.ClientMetadata) != 1 || ctl.ClientMetadata[0].Value != "NDTjs" {
+		t.Error("Redact() metadata =", ctl.ClientMetadata)
+	}
+}
@@ -1,6 +1,7 @@
 package parser_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -10,8 +11,11 @@ import (
 	"github.com/go-test/deep"
 
 	"github.com/m-lab/etl/parser"
+	"github.com/m-lab/etl/row"
 	"github.com/m-lab/etl/schema"
 	"github.com/m-lab/go/pretty"
+	"github.com/m-lab/ndt-server/metadata"
+	"github.com/m-lab/ndt-server/ndt7/model"
 )
 
 func TestNDT7ResultParser_ParseAndInsert(t *testing.T) {
@@ -165,3 +169,57 @@ func TestNDT7ResultParser_IsParsable(t *testing.T) {
 		})
 	}
 }
+
+const redactPolicy = `{"version": "test-1", "datatypes": ["ndt5", "ndt7"],
+	"ipv4_prefix": 24, "ipv6_prefix": 48, "strip_hostnames": true}`
+
+func TestNDT7ResultRow_Redact(t *testing.T) {
+	p, err := row.ParsePrivacyPolicy([]byte(redactPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins := newInMemorySink()
+	n := parser.NewNDT7ResultParser(ins, "test", "_suffix", &fakeAnnotator{})
+	testName := `ndt7-download-20200318T000657.568382877Z.ndt-knwp4_1583603744_000000000000590E.json`
+	resultData, err := ioutil.ReadFile(`testdata/NDT7Result/` + testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := map[string]bigquery.Value{"filename": "gs://mlab-test-bucket/ndt/ndt7/2020/03/18/foo.tgz"}
+	if err := n.ParseAndInsert(meta, testName, resultData); err != nil {
+		t.Fatal(err)
+	}
+	n.Flush()
+	r := ins.data[0].(*schema.NDT7ResultRow)
+	// The archived measurements don't include connection info or a hostname,
+	// so add them as newer clients would report them.
+	dl := r.Raw.Download
+	dl.ServerMeasurements[0].ConnectionInfo = &model.ConnectionInfo{
+		Client: "86.188.171.234:32805", Server: "203.5.76.165:443"}
+	dl.ClientMetadata = append(dl.ClientMetadata,
+		metadata.NameValue{Name: "client_hostname", Value: "host.example.com"},
+		metadata.NameValue{Name: "client_ip", Value: "86.188.171.234"})
+	nmd := len(dl.ClientMetadata)
+
+	if !r.Redact(p) {
+		t.Fatal("Redact() dropped row")
+	}
+	j, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"86.188.171.234", "host.example.com"} {
+		if strings.Contains(string(j), s) {
+			t.Errorf("Redacted row contains %q", s)
+		}
+	}
+	if r.Raw.ClientIP != "86.188.171.0" || r.Raw.ServerIP != "203.5.76.165" {
+		t.Errorf("Redact() IPs = %q, %q", r.Raw.ClientIP, r.Raw.ServerIP)
+	}
+	if ci := dl.ServerMeasurements[0].ConnectionInfo; ci.Client != "86.188.171.0:32805" || ci.Server != "203.5.76.165:443" {
+		t.Errorf("Redact() ConnectionInfo = %+v", ci)
+	}
+	if len(dl.ClientMetadata) != nmd-1 {
+		t.Errorf("Redact() kept %d metadata entries, want %d", len(dl.ClientMetadata), nmd-1)
+	}
+}
@@ -0,0 +1,192 @@
+package parser
+
+// This file contains the strategies for choosing which snapshots are used
+// to compute the deltas in NDT web100 rows.  Including every snapshot can
+// exceed the BigQuery row size limits, so deployments may choose a strategy
+// that keeps a smaller but still useful time series.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-lab/etl/web100"
+)
+
+// DeltaStrategy selects the snapshots used to compute NDT web100 deltas.
+type DeltaStrategy interface {
+	// Indices returns the indices of the snapshots to use, in increasing
+	// order, from among the first n snapshots of the snaplog.
+	Indices(snaplog *web100.SnapLog, n int) ([]int, error)
+	String() string
+}
+
+// DefaultChangeFields are the fields used by the "changes" strategy if no
+// fields are specified.
+var DefaultChangeFields = []string{"CongSignals", "CurCwnd", "SmoothedRTT"}
+
+// ErrBadDeltaStrategy is returned when a delta strategy spec can't be parsed.
+var ErrBadDeltaStrategy = errors.New("invalid delta strategy")
+
+// ParseDeltaStrategy parses a delta strategy specification.  Valid specs are:
+//
+//	"" or "all"            - every snapshot (the default).
+//	"interval:<duration>"  - the first snapshot in each interval, e.g. "interval:100ms".
+//	"changes:<f1>,<f2>..." - snapshots where any of the fields changed, e.g.
+//	                         "changes:CongSignals,CurCwnd".  Defaults to DefaultChangeFields.
+//	                         The fields must be web100 variables.
+//	"evenly:<N>"           - at most N evenly spaced snapshots, e.g. "evenly:200".
+//
+// Except for "all", the first and last snapshots are always included.
+func ParseDeltaStrategy(spec string) (DeltaStrategy, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	arg := ""
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+	switch parts[0] {
+	case "", "all":
+		return allSnapshots{}, nil
+	case "interval":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrBadDeltaStrategy, spec)
+		}
+		return intervalSnapshots{interval: d}, nil
+	case "changes":
+		fields := DefaultChangeFields
+		if arg != "" {
+			fields = strings.Split(arg, ",")
+		}
+		for _, f := range fields {
+			if !web100.IsVariable(f) {
+				return nil, fmt.Errorf("%w: unknown web100 variable %q", ErrBadDeltaStrategy, f)
+			}
+		}
+		return changedSnapshots{fields: fields}, nil
+	case "evenly":
+		max, err := strconv.Atoi(arg)
+		if err != nil || max < 2 {
+			return nil, fmt.Errorf("%w: %q", ErrBadDeltaStrategy, spec)
+		}
+		return evenlySpacedSnapshots{max: max}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrBadDeltaStrategy, spec)
+	}
+}
+
+// allSnapshots uses every snapshot.
+type allSnapshots struct{}
+
+func (allSnapshots) Indices(snaplog *web100.SnapLog, n int) ([]int, error) {
+	return sequence(n), nil
+}
+
+func (allSnapshots) String() string {
+	return "all"
+}
+
+// intervalSnapshots uses the first snapshot in each interval, based on the
+// web100 Duration field.
+type intervalSnapshots struct {
+	interval time.Duration
+}
+
+func (s intervalSnapshots) Indices(snaplog *web100.SnapLog, n int) ([]int, error) {
+	if n == 0 {
+		return []int{}, nil
+	}
+	// Duration is the elapsed time in usec since the connection started.
+	durations := snaplog.SliceIntField("Duration", sequence(n))
+	if len(durations) != n {
+		return nil, errors.New("missing Duration field")
+	}
+	usec := s.interval.Microseconds()
+	result := make([]int, 0, 100)
+	next := int64(0)
+	for i, d := range durations {
+		if i == 0 || d >= next {
+			result = append(result, i)
+			next = d - d%usec + usec
+		}
+	}
+	return withLast(result, n), nil
+}
+
+func (s intervalSnapshots) String() string {
+	return "interval:" + s.interval.String()
+}
+
+// changedSnapshots uses the snapshots where any of the fields changed.
+type changedSnapshots struct {
+	fields []string
+}
+
+func (s changedSnapshots) Indices(snaplog *web100.SnapLog, n int) ([]int, error) {
+	if n == 0 {
+		return []int{}, nil
+	}
+	keep := map[int]bool{0: true}
+	for _, f := range s.fields {
+		changes, err := snaplog.ChangeIndices(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		for _, i := range changes {
+			if i < n {
+				keep[i] = true
+			}
+		}
+	}
+	result := make([]int, 0, len(keep)+1)
+	for i := range keep {
+		result = append(result, i)
+	}
+	sort.Ints(result)
+	return withLast(result, n), nil
+}
+
+func (s changedSnapshots) String() string {
+	return "changes:" + strings.Join(s.fields, ",")
+}
+
+// evenlySpacedSnapshots uses at most max snapshots, evenly spaced between
+// the first and the last.
+type evenlySpacedSnapshots struct {
+	max int
+}
+
+func (s evenlySpacedSnapshots) Indices(snaplog *web100.SnapLog, n int) ([]int, error) {
+	if n <= s.max {
+		return sequence(n), nil
+	}
+	result := make([]int, s.max)
+	for i := range result {
+		result[i] = i * (n - 1) / (s.max - 1)
+	}
+	return result, nil
+}
+
+func (s evenlySpacedSnapshots) String() string {
+	return "evenly:" + strconv.Itoa(s.max)
+}
+
+// sequence returns the indices 0 through n-1.
+func sequence(n int) []int {
+	result := make([]int, n)
+	for i := range result {
+		result[i] = i
+	}
+	return result
+}
+
+// withLast appends the last index, n-1, if it is not already included.
+func withLast(indices []int, n int) []int {
+	if len(indices) == 0 || indices[len(indices)-1] != n-1 {
+		indices = append(indices, n-1)
+	}
+	return indices
+}
@@ -0,0 +1,122 @@
+package parser_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/m-lab/etl/parser"
+	"github.com/m-lab/etl/web100"
+)
+
+func TestParseDeltaStrategy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "", want: "all"},
+		{spec: "all", want: "all"},
+		{spec: "interval:100ms", want: "interval:100ms"},
+		{spec: "changes", want: "changes:CongSignals,CurCwnd,SmoothedRTT"},
+		{spec: "changes:CurCwnd", want: "changes:CurCwnd"},
+		{spec: "changes:CongestionSignals", want: "changes:CongestionSignals"},
+		{spec: "changes:CurCwnd,NoSuchField", wantErr: true},
+		{spec: "evenly:200", want: "evenly:200"},
+		{spec: "interval:foo", wantErr: true},
+		{spec: "interval:-1s", wantErr: true},
+		{spec: "evenly:1", wantErr: true},
+		{spec: "evenly", wantErr: true},
+		{spec: "random", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parser.ParseDeltaStrategy(tt.spec)
+		if tt.wantErr {
+			if !errors.Is(err, parser.ErrBadDeltaStrategy) {
+				t.Errorf("ParseDeltaStrategy(%q) error = %v, want ErrBadDeltaStrategy", tt.spec, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDeltaStrategy(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseDeltaStrategy(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func checkIndices(t *testing.T, name string, indices []int, n int) {
+	if len(indices) == 0 {
+		t.Fatal(name, "returned no indices")
+	}
+	if indices[0] != 0 || indices[len(indices)-1] != n-1 {
+		t.Error(name, "should include first and last snapshots", indices[0], indices[len(indices)-1])
+	}
+	for i := 1; i < len(indices); i++ {
+		if indices[i] <= indices[i-1] {
+			t.Fatal(name, "indices not increasing at", i, indices[i-1], indices[i])
+		}
+	}
+}
+
+func TestDeltaStrategyIndices(t *testing.T) {
+	s2cName := `20170509T13:45:13.590210000Z_eb.measurementlab.net:44160.s2c_snaplog`
+	s2cData, err := ioutil.ReadFile(`testdata/` + s2cName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaplog, err := web100.NewSnapLog(s2cData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := snaplog.SnapCount()
+
+	all, _ := parser.ParseDeltaStrategy("all")
+	indices, err := all.Indices(snaplog, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIndices(t, "all", indices, n)
+	if len(indices) != n {
+		t.Error("all should include every snapshot", len(indices), n)
+	}
+
+	evenly, _ := parser.ParseDeltaStrategy("evenly:100")
+	indices, err = evenly.Indices(snaplog, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIndices(t, "evenly", indices, n)
+	if len(indices) != 100 {
+		t.Error("evenly should return 100 snapshots", len(indices))
+	}
+
+	// The test is about 10 seconds long, so there should be about 10 intervals.
+	interval, _ := parser.ParseDeltaStrategy("interval:1s")
+	indices, err = interval.Indices(snaplog, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIndices(t, "interval", indices, n)
+	if len(indices) < 5 || len(indices) > 20 {
+		t.Error("Unexpected number of interval snapshots", len(indices))
+	}
+
+	changes, _ := parser.ParseDeltaStrategy("changes")
+	indices, err = changes.Indices(snaplog, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIndices(t, "changes", indices, n)
+	if len(indices) >= n {
+		t.Error("changes should omit some snapshots", len(indices), n)
+	}
+
+	// The legacy snaplog field name should also work.
+	legacy, _ := parser.ParseDeltaStrategy("changes:CongestionSignals")
+	if _, err = legacy.Indices(snaplog, n); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,6 +1,7 @@
 package parser_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"github.com/m-lab/etl/parser"
 	"github.com/m-lab/etl/row"
 	"github.com/m-lab/etl/schema"
+	"github.com/m-lab/etl/web100"
 )
 
 func assertNDTTestIsAnnotatable(r parser.NDTTest) {
@@ -211,6 +213,159 @@ func TestNDTParser(t *testing.T) {
 	}
 }
 
+func TestNDTParserSalvage(t *testing.T) {
+	parser.NDTSalvageSnapshots = true
+	defer func() { parser.NDTSalvageSnapshots = false }()
+
+	ins := newInMemoryInserter()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"AnnotatorDate":"2018-12-05T00:00:00Z", "Annotations":{}}`)
+	}))
+	defer ts.Close()
+	n := parser.NewNDTParser(ins, v2as.GetAnnotator(ts.URL))
+
+	s2cName := `20170509T13:45:13.590210000Z_eb.measurementlab.net:44160.s2c_snaplog`
+	s2cData, err := ioutil.ReadFile(`testdata/` + s2cName)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Corrupt the BEGIN_SNAP_DATA marker of snapshot 1000.
+	offset := 0
+	for i := 0; i <= 1000; i++ {
+		next := bytes.Index(s2cData[offset:], []byte(web100.BEGIN_SNAP_DATA))
+		if next < 0 {
+			t.Fatal("Too few snapshots")
+		}
+		offset += next + 1
+	}
+	s2cData[offset] = 'X'
+
+	meta := map[string]bigquery.Value{"filename": "gs://mlab-test-bucket/ndt/2017/06/13/20170613T000000Z-mlab3-vie01-ndt-0186.tgz"}
+	err = n.ParseAndInsert(meta, s2cName+".gz", s2cData)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = n.Flush()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if ins.Accepted() != 1 {
+		t.Fatal("Salvaged test should have been inserted", ins.Accepted())
+	}
+
+	actualValues := ins.data[0].(parser.NDTTest).Web100ValueMap
+	expectedValues := schema.Web100ValueMap{
+		"anomalies": schema.Web100ValueMap{
+			"snaplog_error":  true,
+			"truncated":      true,
+			"salvaged_snaps": 1000,
+		},
+	}
+	if !compare(t, actualValues, expectedValues) {
+		t.Errorf("Missing expected values:")
+		t.Errorf(pretty.Sprint(expectedValues))
+	}
+}
+
+// A snaplog whose only problem is a partial last snapshot should be marked
+// truncated, with the complete snapshots salvaged.
+func TestNDTParserSalvageTruncated(t *testing.T) {
+	parser.NDTSalvageSnapshots = true
+	defer func() { parser.NDTSalvageSnapshots = false }()
+
+	ins := newInMemoryInserter()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"AnnotatorDate":"2018-12-05T00:00:00Z", "Annotations":{}}`)
+	}))
+	defer ts.Close()
+	n := parser.NewNDTParser(ins, v2as.GetAnnotator(ts.URL))
+
+	s2cName := `20170509T13:45:13.590210000Z_eb.measurementlab.net:44160.s2c_snaplog`
+	s2cData, err := ioutil.ReadFile(`testdata/` + s2cName)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	slog, err := web100.NewSnapLog(s2cData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := slog.SnapCount() - 1
+	s2cData = s2cData[:len(s2cData)-10]
+
+	meta := map[string]bigquery.Value{"filename": "gs://mlab-test-bucket/ndt/2017/06/13/20170613T000000Z-mlab3-vie01-ndt-0186.tgz"}
+	err = n.ParseAndInsert(meta, s2cName+".gz", s2cData)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = n.Flush()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if ins.Accepted() != 1 {
+		t.Fatal("Salvaged test should have been inserted", ins.Accepted())
+	}
+
+	actualValues := ins.data[0].(parser.NDTTest).Web100ValueMap
+	expectedValues := schema.Web100ValueMap{
+		"anomalies": schema.Web100ValueMap{
+			"snaplog_error":  true,
+			"truncated":      true,
+			"salvaged_snaps": complete,
+		},
+	}
+	if !compare(t, actualValues, expectedValues) {
+		t.Errorf("Missing expected values:")
+		t.Errorf(pretty.Sprint(expectedValues))
+	}
+}
+
+func TestNDTParserUnsalvageable(t *testing.T) {
+	s2cName := `20170509T13:45:13.590210000Z_eb.measurementlab.net:44160.s2c_snaplog`
+	s2cData, err := ioutil.ReadFile(`testdata/` + s2cName)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Corrupt the BEGIN_SNAP_DATA marker of the first snapshot, so that
+	// nothing can be salvaged.
+	offset := bytes.Index(s2cData, []byte(web100.BEGIN_SNAP_DATA))
+	if offset < 0 {
+		t.Fatal("No snapshots")
+	}
+	s2cData[offset+1] = 'X'
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"AnnotatorDate":"2018-12-05T00:00:00Z", "Annotations":{}}`)
+	}))
+	defer ts.Close()
+	meta := map[string]bigquery.Value{"filename": "gs://mlab-test-bucket/ndt/2017/06/13/20170613T000000Z-mlab3-vie01-ndt-0186.tgz"}
+	parse := func(salvage bool) *inMemoryInserter {
+		parser.NDTSalvageSnapshots = salvage
+		defer func() { parser.NDTSalvageSnapshots = false }()
+		ins := newInMemoryInserter()
+		n := parser.NewNDTParser(ins, v2as.GetAnnotator(ts.URL))
+		if err := n.ParseAndInsert(meta, s2cName+".gz", append([]byte{}, s2cData...)); err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		return ins
+	}
+
+	// A test that can't be salvaged is handled as if salvaging were disabled.
+	want := parse(false)
+	got := parse(true)
+	if got.Accepted() != want.Accepted() {
+		t.Fatalf("Accepted %d tests, want %d", got.Accepted(), want.Accepted())
+	}
+	for _, r := range got.data {
+		anomalies := r.(parser.NDTTest).Web100ValueMap["anomalies"].(schema.Web100ValueMap)
+		if _, ok := anomalies["truncated"]; ok {
+			t.Error("Unsalvaged test should not be marked truncated")
+		}
+	}
+}
+
 func TestNDTTaskError(t *testing.T) {
 	// Load test data.
 	ins := newInMemoryInserter()
@@ -261,6 +416,12 @@ func compare(t *testing.T, actual schema.Web100ValueMap, expected schema.Web100V
 					key, v, act.(int32))
 				match = false
 			}
+		case bool:
+			if act.(bool) != v {
+				t.Logf("Wrong bools for key %q: got %t; want %t",
+					key, v, act.(bool))
+				match = false
+			}
 		case int:
 			if act.(int) != v {
 				t.Logf("Wrong ints for key %q: got %d; want %d",
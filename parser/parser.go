@@ -43,6 +43,23 @@ func Version() string {
 	return gParserVersion
 }
 
+var gPrivacyPolicy *row.PrivacyPolicy
+
+// SetPrivacyPolicy sets the privacy policy applied by parsers created
+// afterwards.  A nil policy disables privacy filtering.
+func SetPrivacyPolicy(p *row.PrivacyPolicy) {
+	gPrivacyPolicy = p
+}
+
+// PrivacyPolicy returns the privacy policy for the datatype, or nil if
+// there is none.
+func PrivacyPolicy(dt etl.DataType) *row.PrivacyPolicy {
+	if gPrivacyPolicy == nil || !gPrivacyPolicy.AppliesTo(string(dt)) {
+		return nil
+	}
+	return gPrivacyPolicy
+}
+
 // NewSinkParser creates an appropriate parser for a given data type.
 // Eventually all datatypes will use this instead of NewParser.
 func NewSinkParser(dt etl.DataType, sink row.Sink, table string, ann api.Annotator) etl.Parser {
@@ -73,6 +90,10 @@ func NewParser(dt etl.DataType, ins etl.Inserter) etl.Parser {
 			log.Println(reflect.TypeOf(ins))
 			return nil
 		}
+		if p := PrivacyPolicy(etl.NDT5); p != nil {
+			// Archives from dropped sites are skipped by the caller.
+			sink = row.NewFilter(sink, p, "")
+		}
 		return NewNDT5ResultParser(sink, ins.TableBase(), ins.TableSuffix(), nil)
 
 	case etl.SS:
@@ -88,6 +109,10 @@ func NewParser(dt etl.DataType, ins etl.Inserter) etl.Parser {
 			log.Println(reflect.TypeOf(ins))
 			return nil
 		}
+		if p := PrivacyPolicy(etl.TCPINFO); p != nil {
+			// Archives from dropped sites are skipped by the caller.
+			sink = row.NewFilter(sink, p, "")
+		}
 		return NewTCPInfoParser(sink, ins.TableBase(), ins.TableSuffix(), nil)
 	default:
 		return nil
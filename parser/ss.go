@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"log"
@@ -8,6 +9,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	v2as "github.com/m-lab/annotation-service/api/v2"
@@ -23,6 +25,43 @@ import (
 
 // Parser for parsing sidestream tests.
 
+// maxSSLineSize is the longest sidestream line that ParseAndInsert will accept.
+// Real lines are under 1KB.
+const maxSSLineSize = 1024 * 1024
+
+// ssLineSplitter is a bufio.SplitFunc state that splits lines like
+// bufio.ScanLines, but skips lines longer than maxSSLineSize instead of
+// failing.  A skipped line is returned as an empty token, with tooLong set,
+// so that line numbers are unchanged.
+type ssLineSplitter struct {
+	skipping bool // Discarding the rest of a long line.
+	tooLong  bool // The last token replaced a long line.
+}
+
+func (s *ssLineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	s.tooLong = false
+	if s.skipping {
+		i := bytes.IndexByte(data, '\n')
+		switch {
+		case i >= 0:
+			s.skipping, s.tooLong = false, true
+			return i + 1, []byte{}, nil
+		case atEOF:
+			s.skipping, s.tooLong = false, true
+			return len(data), []byte{}, nil
+		default:
+			return len(data), nil, nil
+		}
+	}
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if advance == 0 && token == nil && err == nil && len(data) >= maxSSLineSize {
+		// The buffer is full without a newline, so discard the line.
+		s.skipping = true
+		return len(data), nil, nil
+	}
+	return advance, token, err
+}
+
 // SSParser provides a parser implementation for SideStream data.
 type SSParser struct {
 	Base
@@ -59,6 +98,30 @@ func ExtractLogtimeFromFilename(fileName string) (time.Time, error) {
 	return t, nil
 }
 
+var (
+	web100MappingOnce sync.Once
+	web100Mapping     map[string]string
+)
+
+// loadWeb100Mapping loads the tcp-kis.txt definitions once per process.
+func loadWeb100Mapping() map[string]string {
+	web100MappingOnce.Do(func() {
+		data, err := web100.Asset("tcp-kis.txt")
+		if err != nil {
+			// TODO - convert this panic to something else.
+			panic("tcp-kis.txt not found")
+		}
+		b := bytes.NewBuffer(data)
+
+		web100Mapping, err = web100.ParseWeb100Definitions(b)
+		if err != nil {
+			// TODO - convert this panic to something else.
+			panic("tcp-kis.txt not found")
+		}
+	})
+	return web100Mapping
+}
+
 // ParseKHeader parses the first line of SS file, in format "K: cid PollTime LocalAddress LocalPort ... other_web100_variables_separated_by_space"
 func ParseKHeader(header string) ([]string, error) {
 	var varNames []string
@@ -67,18 +130,7 @@ func ParseKHeader(header string) ([]string, error) {
 		return varNames, errors.New("Corrupted header")
 	}
 
-	data, err := web100.Asset("tcp-kis.txt")
-	if err != nil {
-		// TODO - convert this panic to something else.
-		panic("tcp-kis.txt not found")
-	}
-	b := bytes.NewBuffer(data)
-
-	mapping, err := web100.ParseWeb100Definitions(b)
-	if err != nil {
-		// TODO - convert this panic to something else.
-		panic("tcp-kis.txt not found")
-	}
+	mapping := loadWeb100Mapping()
 
 	for index, name := range web100Vars {
 		if index == 0 {
@@ -144,19 +196,52 @@ func PackDataIntoSchema(ssValue map[string]string, logTime time.Time, testName s
 
 // ParseOneLine parses a single line of sidestream data.
 func ParseOneLine(snapshot string, varNames []string) (map[string]string, error) {
-	value := strings.Split(snapshot, " ")
-	ssValue := make(map[string]string)
-	if value[0] != "C:" || len(value) != len(varNames)+1 {
-		log.Printf("corrupted content:")
-		log.Printf(snapshot)
-		return ssValue, errors.New("corrupted content")
-	}
+	ssValue := make(map[string]string, len(varNames))
+	err := parseOneLineInto(snapshot, varNames, ssValue)
+	return ssValue, err
+}
 
-	for index, val := range value[1:] {
+// parseOneLineInto parses a single line of sidestream data into ssValue,
+// which is cleared first so that it can be reused across lines.  It walks
+// the line in place rather than splitting it, to avoid allocating a slice
+// per line.
+func parseOneLineInto(snapshot string, varNames []string, ssValue map[string]string) error {
+	for k := range ssValue {
+		delete(ssValue, k)
+	}
+	rest := snapshot
+	if !strings.HasPrefix(rest, "C: ") {
+		return corruptedLine(snapshot, ssValue)
+	}
+	rest = rest[len("C: "):]
+	for index := 0; ; index++ {
+		if index >= len(varNames) {
+			return corruptedLine(snapshot, ssValue)
+		}
+		val := rest
+		next := strings.IndexByte(rest, ' ')
+		if next >= 0 {
+			val = rest[:next]
+		}
 		// Match value with var_name
 		ssValue[varNames[index]] = val
+		if next < 0 {
+			if index != len(varNames)-1 {
+				return corruptedLine(snapshot, ssValue)
+			}
+			return nil
+		}
+		rest = rest[next+1:]
 	}
-	return ssValue, nil
+}
+
+func corruptedLine(snapshot string, ssValue map[string]string) error {
+	for k := range ssValue {
+		delete(ssValue, k)
+	}
+	log.Printf("corrupted content:")
+	log.Printf(snapshot)
+	return errors.New("corrupted content")
 }
 
 // PopulateSnap fills in the snapshot data.
@@ -233,23 +318,40 @@ func (ss *SSParser) ParseAndInsert(meta map[string]bigquery.Value, testName stri
 	if err != nil {
 		return err
 	}
-	testContent := strings.Split(string(rawContent[:]), "\n")
-	if len(testContent) < 2 {
+	// The header must be followed by at least one newline.
+	if bytes.IndexByte(rawContent, '\n') < 0 {
 		return errors.New("empty test file")
 	}
-	varNames, err := ParseKHeader(testContent[0])
+	// Scan the content line by line, rather than splitting it, so that
+	// large files are not copied into a string and a slice of lines.
+	splitter := &ssLineSplitter{}
+	scanner := bufio.NewScanner(bytes.NewReader(rawContent))
+	scanner.Buffer(make([]byte, 0, 4096), maxSSLineSize)
+	scanner.Split(splitter.split)
+	scanner.Scan()
+	varNames, err := ParseKHeader(scanner.Text())
 	if err != nil {
 		metrics.ErrorCount.WithLabelValues(
 			ss.TableName(), "ss", "corrupted header").Inc()
 		return err
 	}
-	for _, oneLine := range testContent[1:] {
-		oneLine = strings.TrimSuffix(oneLine, "\n")
-
-		if len(oneLine) == 0 {
+	// ssValue is reused for every line.  PackDataIntoSchema copies
+	// everything it needs out of the map.
+	ssValue := make(map[string]string, len(varNames))
+	// line is the line number of the connection, which is used to derive
+	// the row's insert ID.
+	for line := 1; scanner.Scan(); line++ {
+		if splitter.tooLong {
+			metrics.TestCount.WithLabelValues(
+				ss.TableName(), "ss", "line too long").Inc()
+			log.Printf("Skipping line %d of %s longer than %d bytes", line, testName, maxSSLineSize)
 			continue
 		}
-		ssValue, err := ParseOneLine(oneLine, varNames)
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		oneLine := scanner.Text()
+		err := parseOneLineInto(oneLine, varNames, ssValue)
 		if err != nil {
 			metrics.TestCount.WithLabelValues(
 				ss.TableName(), "ss", "corrupted content").Inc()
@@ -279,6 +381,7 @@ func (ss *SSParser) ParseAndInsert(meta map[string]bigquery.Value, testName stri
 
 		ssTest.ParseTime = time.Now() // for map, use string(time.Now().MarshalText())
 		ssTest.ParserVersion = Version()
+		ssTest.Index = line
 		if meta["filename"] != nil {
 			ssTest.TaskFileName = meta["filename"].(string)
 		}
@@ -301,5 +404,10 @@ func (ss *SSParser) ParseAndInsert(meta map[string]bigquery.Value, testName stri
 		}
 		metrics.TestCount.WithLabelValues(ss.TableName(), "ss", "ok").Inc()
 	}
+	if err := scanner.Err(); err != nil {
+		metrics.TestCount.WithLabelValues(
+			ss.TableName(), "ss", "corrupted content").Inc()
+		return err
+	}
 	return nil
 }
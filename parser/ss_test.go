@@ -1,6 +1,7 @@
 package parser_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -131,3 +132,67 @@ func TestSSInserter(t *testing.T) {
 		t.Error("ParserVersion not properly set")
 	}
 }
+
+func TestSSLongLine(t *testing.T) {
+	rawData := makeSSFile(t, 6)
+	// Insert a line longer than the scanner buffer after the header.
+	i := bytes.IndexByte(rawData, '\n') + 1
+	long := append(bytes.Repeat([]byte("C: 1"), 512*1024), '\n')
+	rawData = append(append(append([]byte{}, rawData[:i]...), long...), rawData[i:]...)
+
+	ins := &inMemoryInserter{}
+	p := parser.NewSSParser(ins, &fakeAnnotator{})
+	filename := "20170203T00:00:00Z_ALL0.web100"
+	err := p.ParseAndInsert(map[string]bigquery.Value{"filename": filename}, filename, rawData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if ins.Committed() != 6 {
+		t.Errorf("Expected %d, Got %d.", 6, ins.Committed())
+	}
+}
+
+// makeSSFile builds a sidestream file with the header from the test file and
+// its data lines repeated until there are at least n lines.  Production
+// sidestream files commonly have tens of thousands of lines.
+func makeSSFile(tb testing.TB, n int) []byte {
+	raw, err := ioutil.ReadFile("testdata/20170203T00:00:00Z_ALL0.web100")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	lines := bytes.SplitAfter(bytes.TrimSpace(raw), []byte("\n"))
+	header, body := lines[0], lines[1:]
+	out := bytes.NewBuffer(append([]byte{}, header...))
+	for count := 0; count < n; count += len(body) {
+		for _, l := range body {
+			out.Write(bytes.TrimSuffix(l, []byte("\n")))
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+func BenchmarkSSParseAndInsert(b *testing.B) {
+	os.Setenv("RELEASE_TAG", "foobar")
+	parser.InitParserVersionForTest()
+
+	for _, lines := range []int{6, 1000, 20000} {
+		rawData := makeSSFile(b, lines)
+		filename := "20170203T00:00:00Z_ALL0.web100"
+		meta := map[string]bigquery.Value{"filename": filename}
+		b.Run(fmt.Sprint(lines, "-lines"), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(rawData)))
+			for i := 0; i < b.N; i++ {
+				p := parser.NewSSParser(&inMemoryInserter{}, &fakeAnnotator{})
+				err := p.ParseAndInsert(meta, filename, rawData)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
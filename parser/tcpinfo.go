@@ -22,8 +22,6 @@ import (
 
 	"cloud.google.com/go/bigquery"
 
-	"github.com/valyala/gozstd"
-
 	v2as "github.com/m-lab/annotation-service/api/v2"
 	"github.com/m-lab/tcp-info/netlink"
 	"github.com/m-lab/tcp-info/snapshot"
@@ -40,6 +38,7 @@ type TCPInfoParser struct {
 	*row.Base
 	table  string
 	suffix string
+	policy SnapshotPolicy // Selects the snapshots saved in each row.
 }
 
 // RowsInBuffer returns the count of rows currently in the buffer.
@@ -91,24 +90,13 @@ func (p *TCPInfoParser) Flush() error {
 
 // IsParsable returns the canonical test type and whether to parse data.
 func (p *TCPInfoParser) IsParsable(testName string, data []byte) (string, bool) {
-	if strings.HasSuffix(testName, "jsonl.zst") {
+	// Task normally strips the .zst suffix before type detection.
+	if strings.HasSuffix(testName, ".jsonl") || strings.HasSuffix(testName, "jsonl.zst") {
 		return "tcpinfo", true
 	}
 	return "", false
 }
 
-func thinSnaps(orig []*snapshot.Snapshot) []*snapshot.Snapshot {
-	n := len(orig)
-	out := make([]*snapshot.Snapshot, 0, 1+n/10)
-	for i := 0; i < n; i += 10 {
-		out = append(out, orig[i])
-	}
-	if n%10 != 0 {
-		out = append(out, orig[n-1])
-	}
-	return out
-}
-
 // ParseAndInsert extracts all ArchivalRecords from the rawContent and inserts into a single row.
 // Approximately 15 usec/snapshot.
 func (p *TCPInfoParser) ParseAndInsert(fileMetadata map[string]bigquery.Value, testName string, rawContent []byte) error {
@@ -116,15 +104,7 @@ func (p *TCPInfoParser) ParseAndInsert(fileMetadata map[string]bigquery.Value, t
 	metrics.WorkerState.WithLabelValues(tableName, "tcpinfo").Inc()
 	defer metrics.WorkerState.WithLabelValues(tableName, "tcpinfo").Dec()
 
-	if strings.HasSuffix(testName, "zst") {
-		var err error
-		rawContent, err = gozstd.Decompress(nil, rawContent)
-		if err != nil {
-			metrics.TestCount.WithLabelValues(p.TableName(), "tcpinfo", "zstd error").Inc()
-			return err
-		}
-	}
-
+	// Task has already decompressed the file, within its InflateBudget.
 	// This contains metadata and all snapshots from a single connection.
 	rdr := bytes.NewReader(rawContent)
 	ar := netlink.NewArchiveReader(rdr)
@@ -168,8 +148,11 @@ func (p *TCPInfoParser) ParseAndInsert(fileMetadata map[string]bigquery.Value, t
 	}
 
 	row := schema.TCPRow{}
-	// TODO - restore full snapshots, or implement smarter filtering.
-	row.Snapshots = thinSnaps(snaps)
+	row.Snapshots = p.policy.Filter(snaps)
+	row.SnapshotPolicy = &schema.SnapshotPolicyInfo{
+		Policy:  p.policy.String(),
+		Dropped: int64(len(snaps) - len(row.Snapshots)),
+	}
 	row.FinalSnapshot = snaps[len(snaps)-1]
 	if row.FinalSnapshot.InetDiagMsg != nil {
 		row.SockID = row.FinalSnapshot.InetDiagMsg.ID.GetSockID()
@@ -197,6 +180,7 @@ func (p *TCPInfoParser) ParseAndInsert(fileMetadata map[string]bigquery.Value, t
 
 // NewTCPInfoParser creates a new TCPInfoParser.  Duh.
 // Annotator may be optionally passed in, or will be created if nil.
+// The parser uses the current TCPInfoSnapshotPolicy.
 func NewTCPInfoParser(sink row.Sink, table, suffix string, ann v2as.Annotator) *TCPInfoParser {
 	bufSize := etl.TCPINFO.BQBufferSize()
 	if ann == nil {
@@ -207,5 +191,6 @@ func NewTCPInfoParser(sink row.Sink, table, suffix string, ann v2as.Annotator) *
 		Base:   row.NewBase("tcpinfo", sink, bufSize, ann),
 		table:  table,
 		suffix: suffix,
+		policy: TCPInfoSnapshotPolicy,
 	}
 }
@@ -0,0 +1,256 @@
+package parser
+
+// This file contains the policies for choosing which snapshots are saved in
+// each TCPRow.  A single connection may have thousands of snapshots, and
+// saving all of them can make rows too large for BigQuery.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-lab/tcp-info/snapshot"
+)
+
+// SnapshotPolicy selects the snapshots saved in a TCPRow.
+type SnapshotPolicy interface {
+	// Filter returns the selected snapshots, in their original order.
+	Filter(snaps []*snapshot.Snapshot) []*snapshot.Snapshot
+	String() string
+}
+
+// DefaultSnapshotPolicy keeps every 10th snapshot, and the last snapshot.
+const DefaultSnapshotPolicy = "every:10"
+
+// ErrBadSnapshotPolicy is returned when a snapshot policy spec can't be parsed.
+var ErrBadSnapshotPolicy = errors.New("invalid snapshot policy")
+
+// TCPInfoSnapshotPolicy is the policy used by new TCPInfoParsers.  It is set
+// from the TCPINFO_SNAPSHOT_POLICY environment variable.  See ParseSnapshotPolicy.
+var TCPInfoSnapshotPolicy = snapshotPolicyFromEnv("TCPINFO_SNAPSHOT_POLICY")
+
+// snapshotPolicyFromEnv parses the snapshot policy in the environment
+// variable.  An invalid policy is logged, and the default policy is used
+// instead.
+func snapshotPolicyFromEnv(name string) SnapshotPolicy {
+	policy, err := ParseSnapshotPolicy(os.Getenv(name))
+	if err != nil {
+		log.Printf("%s: %v, using the default", name, err)
+		policy, _ = ParseSnapshotPolicy(DefaultSnapshotPolicy)
+	}
+	return policy
+}
+
+// ParseSnapshotPolicy parses a snapshot policy specification.  Valid specs are:
+//
+//	"all"                 - every snapshot.
+//	"every:<N>"           - every Nth snapshot.  The default is "every:10".
+//	"interval:<duration>" - the first snapshot in each interval, e.g. "interval:100ms".
+//	"changes"             - snapshots where SndCwnd, RTT, or TotalRetrans changed.
+//	"maxbytes:<N>"        - evenly spaced snapshots, limiting the encoded size to about N bytes.
+//
+// Policies may be combined with "+", and are applied left to right, e.g.
+// "changes+maxbytes:5000000".  The "interval", "changes" and "maxbytes"
+// policies always keep the first and last snapshots.
+func ParseSnapshotPolicy(spec string) (SnapshotPolicy, error) {
+	if spec == "" {
+		spec = DefaultSnapshotPolicy
+	}
+	chain := policyChain{}
+	for _, part := range strings.Split(spec, "+") {
+		p, err := parseOnePolicy(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrBadSnapshotPolicy, spec)
+		}
+		chain = append(chain, p)
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return chain, nil
+}
+
+func parseOnePolicy(spec string) (SnapshotPolicy, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	arg := ""
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+	switch parts[0] {
+	case "all":
+		return keepAll{}, nil
+	case "every":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return nil, ErrBadSnapshotPolicy
+		}
+		return everyNth{n: n}, nil
+	case "interval":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return nil, ErrBadSnapshotPolicy
+		}
+		return timeSampled{interval: d}, nil
+	case "changes":
+		return changePoints{}, nil
+	case "maxbytes":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return nil, ErrBadSnapshotPolicy
+		}
+		return sizeCapped{maxBytes: n}, nil
+	default:
+		return nil, ErrBadSnapshotPolicy
+	}
+}
+
+// policyChain applies several policies in order.
+type policyChain []SnapshotPolicy
+
+func (c policyChain) Filter(snaps []*snapshot.Snapshot) []*snapshot.Snapshot {
+	for _, p := range c {
+		snaps = p.Filter(snaps)
+	}
+	return snaps
+}
+
+func (c policyChain) String() string {
+	names := make([]string, len(c))
+	for i := range c {
+		names[i] = c[i].String()
+	}
+	return strings.Join(names, "+")
+}
+
+// keepAll keeps every snapshot.
+type keepAll struct{}
+
+func (keepAll) Filter(snaps []*snapshot.Snapshot) []*snapshot.Snapshot {
+	return snaps
+}
+
+func (keepAll) String() string {
+	return "all"
+}
+
+// everyNth keeps every Nth snapshot, starting with the first, plus the last
+// snapshot if the count is not a multiple of N.  This matches the original
+// fixed thinning of TCPInfo rows.
+type everyNth struct {
+	n int
+}
+
+func (p everyNth) Filter(snaps []*snapshot.Snapshot) []*snapshot.Snapshot {
+	n := len(snaps)
+	out := make([]*snapshot.Snapshot, 0, 1+n/p.n)
+	for i := 0; i < n; i += p.n {
+		out = append(out, snaps[i])
+	}
+	if n%p.n != 0 {
+		out = append(out, snaps[n-1])
+	}
+	return out
+}
+
+func (p everyNth) String() string {
+	return "every:" + strconv.Itoa(p.n)
+}
+
+// timeSampled keeps the first snapshot in each interval, and the last snapshot.
+type timeSampled struct {
+	interval time.Duration
+}
+
+func (p timeSampled) Filter(snaps []*snapshot.Snapshot) []*snapshot.Snapshot {
+	if len(snaps) == 0 {
+		return snaps
+	}
+	out := make([]*snapshot.Snapshot, 0, 100)
+	next := snaps[0].Timestamp
+	for _, s := range snaps {
+		if !s.Timestamp.Before(next) {
+			out = append(out, s)
+			next = s.Timestamp.Truncate(p.interval).Add(p.interval)
+		}
+	}
+	return withLastSnapshot(out, snaps)
+}
+
+func (p timeSampled) String() string {
+	return "interval:" + p.interval.String()
+}
+
+// changePoints keeps the snapshots where the congestion window, the RTT, or
+// the total retransmissions changed, plus the first and last snapshots.
+type changePoints struct{}
+
+func (changePoints) Filter(snaps []*snapshot.Snapshot) []*snapshot.Snapshot {
+	if len(snaps) == 0 {
+		return snaps
+	}
+	out := make([]*snapshot.Snapshot, 0, 100)
+	var last *snapshot.Snapshot
+	for _, s := range snaps {
+		if last == nil || s.TCPInfo == nil || last.TCPInfo == nil ||
+			s.TCPInfo.SndCwnd != last.TCPInfo.SndCwnd ||
+			s.TCPInfo.RTT != last.TCPInfo.RTT ||
+			s.TCPInfo.TotalRetrans != last.TCPInfo.TotalRetrans {
+			out = append(out, s)
+		}
+		last = s
+	}
+	return withLastSnapshot(out, snaps)
+}
+
+func (changePoints) String() string {
+	return "changes"
+}
+
+// sizeCapped keeps evenly spaced snapshots, so that the JSON encoding of the
+// snapshots is no more than about maxBytes.  The size is estimated from the
+// encoding of the last snapshot, to avoid encoding every snapshot.
+type sizeCapped struct {
+	maxBytes int
+}
+
+func (p sizeCapped) Filter(snaps []*snapshot.Snapshot) []*snapshot.Snapshot {
+	n := len(snaps)
+	if n < 3 {
+		return snaps
+	}
+	b, err := json.Marshal(snaps[n-1])
+	if err != nil || len(b) == 0 {
+		return snaps
+	}
+	keep := p.maxBytes / len(b)
+	if keep < 2 {
+		keep = 2
+	}
+	if n <= keep {
+		return snaps
+	}
+	out := make([]*snapshot.Snapshot, keep)
+	for i := range out {
+		out[i] = snaps[i*(n-1)/(keep-1)]
+	}
+	return out
+}
+
+func (p sizeCapped) String() string {
+	return "maxbytes:" + strconv.Itoa(p.maxBytes)
+}
+
+// withLastSnapshot appends the last of all snapshots to out, if it is not
+// already included.
+func withLastSnapshot(out, all []*snapshot.Snapshot) []*snapshot.Snapshot {
+	last := all[len(all)-1]
+	if len(out) == 0 || out[len(out)-1] != last {
+		out = append(out, last)
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package parser_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-lab/tcp-info/snapshot"
+	"github.com/m-lab/tcp-info/tcp"
+
+	"github.com/m-lab/etl/parser"
+)
+
+func TestParseSnapshotPolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "", want: parser.DefaultSnapshotPolicy},
+		{spec: "all", want: "all"},
+		{spec: "every:5", want: "every:5"},
+		{spec: "interval:1s", want: "interval:1s"},
+		{spec: "changes", want: "changes"},
+		{spec: "maxbytes:1000000", want: "maxbytes:1000000"},
+		{spec: "changes+maxbytes:1000", want: "changes+maxbytes:1000"},
+		{spec: "every:0", wantErr: true},
+		{spec: "interval:foo", wantErr: true},
+		{spec: "maxbytes", wantErr: true},
+		{spec: "changes+", wantErr: true},
+		{spec: "random", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parser.ParseSnapshotPolicy(tt.spec)
+		if tt.wantErr {
+			if !errors.Is(err, parser.ErrBadSnapshotPolicy) {
+				t.Errorf("ParseSnapshotPolicy(%q) error = %v, want ErrBadSnapshotPolicy", tt.spec, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSnapshotPolicy(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseSnapshotPolicy(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+// makeSnaps returns n snapshots, 10 msec apart, with the congestion window
+// changing every 100 snapshots.
+func makeSnaps(n int) []*snapshot.Snapshot {
+	start := time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)
+	snaps := make([]*snapshot.Snapshot, n)
+	for i := range snaps {
+		snaps[i] = &snapshot.Snapshot{
+			Timestamp: start.Add(time.Duration(i) * 10 * time.Millisecond),
+			Observed:  1,
+			TCPInfo:   &tcp.LinuxTCPInfo{SndCwnd: uint32(10 + i/100), RTT: 1000},
+		}
+	}
+	return snaps
+}
+
+func TestSnapshotPolicyFilter(t *testing.T) {
+	snaps := makeSnaps(1005)
+	tests := []struct {
+		spec string
+		want int
+	}{
+		{spec: "all", want: 1005},
+		{spec: "every:10", want: 102},
+		// 10 msec snapshots over about 10 seconds.
+		{spec: "interval:1s", want: 12},
+		// Changes at 0, 100, ..., 1000, plus the last snapshot.
+		{spec: "changes", want: 12},
+		{spec: "maxbytes:1", want: 2},
+		{spec: "changes+maxbytes:1", want: 2},
+	}
+	for _, tt := range tests {
+		p, err := parser.ParseSnapshotPolicy(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := p.Filter(snaps)
+		if len(got) != tt.want {
+			t.Errorf("%s kept %d snapshots, want %d", tt.spec, len(got), tt.want)
+			continue
+		}
+		if got[0] != snaps[0] || got[len(got)-1] != snaps[len(snaps)-1] {
+			t.Errorf("%s should keep the first and last snapshots", tt.spec)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package row
+
+import (
+	"log"
+	"sync"
+
+	"github.com/m-lab/etl/metrics"
+)
+
+// FanOutMode determines which child sinks must succeed for a FanOut commit
+// to succeed.
+type FanOutMode int
+
+const (
+	// AllMustSucceed waits for every child, and fails if any child fails.
+	// The rows may still have been committed to the other children.
+	AllMustSucceed FanOutMode = iota
+	// PrimaryMustSucceed waits for every child, but only fails if the
+	// primary fails.  Secondary failures are logged and counted.
+	PrimaryMustSucceed
+	// BestEffortSecondaries waits only for the primary.  Secondaries commit
+	// in the background, and blocks are dropped for a secondary that falls
+	// too far behind.
+	BestEffortSecondaries
+)
+
+// maxSecondaryBacklog limits the number of blocks that a best effort
+// secondary may have in flight before new blocks are dropped.
+const maxSecondaryBacklog = 8
+
+// finisher matches task.Finisher, which can't be imported here.
+type finisher interface {
+	Finish(err error) error
+}
+
+// Child is a named child of a FanOut.  The name is used in metrics.
+type Child struct {
+	Name string
+	Sink Sink
+}
+
+// fanOutChild tracks the state of a single child.
+type fanOutChild struct {
+	Child
+	stats ActiveStats
+	slots chan struct{} // Limits the background commits.
+
+	lock sync.Mutex    // Protects last.
+	last chan struct{} // Closed when the latest background commit completes.
+}
+
+// FanOut implements Sink by committing each block to several child sinks
+// concurrently.  The first child is the primary.  FanOut also implements
+// task.Finisher, waiting for background commits, and passing the task result
+// to any children that are Finishers.
+// It is THREAD-SAFE.
+//
+// NOTE: The children commit the same rows concurrently, so they must not
+// modify them, and callers must not modify rows after Commit returns.
+type FanOut struct {
+	mode     FanOutMode
+	children []*fanOutChild
+	pending  sync.WaitGroup // Tracks background commits.
+}
+
+// NewFanOut creates a FanOut that commits to the children, with the given
+// mode.  The first child is the primary.  A Filter modifies rows, so it may
+// wrap a FanOut, but may not be a child.
+func NewFanOut(mode FanOutMode, children ...Child) (*FanOut, error) {
+	if len(children) == 0 {
+		return nil, ErrInvalidSink
+	}
+	fo := &FanOut{mode: mode}
+	for _, c := range children {
+		if _, isFilter := c.Sink.(*Filter); c.Sink == nil || isFilter {
+			return nil, ErrInvalidSink
+		}
+		fo.children = append(fo.children, &fanOutChild{Child: c,
+			slots: make(chan struct{}, maxSecondaryBacklog)})
+	}
+	return fo, nil
+}
+
+// begin counts rows about to be committed.
+func (as *ActiveStats) begin(n int) {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+	as.Pending += n
+}
+
+// commit commits the rows to the child, and records the results.
+func (c *fanOutChild) commit(rows []interface{}, label string) (int, error) {
+	c.stats.begin(len(rows))
+	n, err := c.Sink.Commit(rows, label)
+	c.stats.Done(n, nil)
+	metrics.FanOutRowCount.WithLabelValues(label, c.Name, "ok").Add(float64(n))
+	if err != nil {
+		c.stats.Done(len(rows)-n, err)
+		metrics.FanOutRowCount.WithLabelValues(label, c.Name, "failed").Add(float64(len(rows) - n))
+	}
+	return n, err
+}
+
+// commitAsync commits the rows to the child in the background, in order
+// with earlier background commits.  If the child is too far behind, the
+// rows are dropped.
+func (c *fanOutChild) commitAsync(rows []interface{}, label string, wg *sync.WaitGroup) {
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		log.Printf("Dropping %d rows for %s, which is too far behind", len(rows), c.Name)
+		c.stats.begin(len(rows))
+		c.stats.Done(len(rows), ErrBufferFull)
+		metrics.FanOutRowCount.WithLabelValues(label, c.Name, "dropped").Add(float64(len(rows)))
+		return
+	}
+	c.lock.Lock()
+	prev := c.last
+	done := make(chan struct{})
+	c.last = done
+	c.lock.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() { <-c.slots }()
+		defer close(done)
+		if prev != nil {
+			<-prev
+		}
+		if _, err := c.commit(rows, label); err != nil {
+			log.Println(c.Name, err)
+		}
+	}()
+}
+
+// combine returns nil, the single error, or CommitErrors.
+func combine(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return CommitErrors(errs)
+	}
+}
+
+// Commit implements Sink.  It returns the number of rows committed to the
+// primary, or for AllMustSucceed, the fewest rows committed to any child.
+func (fo *FanOut) Commit(rows []interface{}, label string) (int, error) {
+	type result struct {
+		n   int
+		err error
+	}
+	results := make([]result, len(fo.children))
+	var wg sync.WaitGroup
+	for i, c := range fo.children {
+		if i > 0 && fo.mode == BestEffortSecondaries {
+			c.commitAsync(rows, label, &fo.pending)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, c *fanOutChild) {
+			defer wg.Done()
+			results[i].n, results[i].err = c.commit(rows, label)
+		}(i, c)
+	}
+	wg.Wait()
+
+	if fo.mode != AllMustSucceed {
+		for i := 1; i < len(results); i++ {
+			if results[i].err != nil {
+				log.Println(fo.children[i].Name, results[i].err)
+			}
+		}
+		return results[0].n, results[0].err
+	}
+	n := len(rows)
+	errs := []error{}
+	for _, r := range results {
+		if r.n < n {
+			n = r.n
+		}
+		if r.err != nil {
+			errs = append(errs, r.err)
+		}
+	}
+	return n, combine(errs)
+}
+
+// Finish implements task.Finisher.  It waits for background commits, then
+// passes the task result to each child that is a Finisher.  Secondary errors
+// are only returned for AllMustSucceed.
+func (fo *FanOut) Finish(taskErr error) error {
+	fo.pending.Wait()
+	errs := []error{}
+	for i, c := range fo.children {
+		f, ok := c.Sink.(finisher)
+		if !ok {
+			continue
+		}
+		err := f.Finish(taskErr)
+		switch {
+		case err == nil:
+		case i == 0 || fo.mode == AllMustSucceed:
+			errs = append(errs, err)
+		default:
+			log.Println(c.Name, err)
+		}
+	}
+	return combine(errs)
+}
+
+// GetStats implements HasStats, returning the stats for the primary.
+func (fo *FanOut) GetStats() Stats {
+	return fo.children[0].stats.GetStats()
+}
+
+// ChildStats returns the stats for each child, in order.
+func (fo *FanOut) ChildStats() []Stats {
+	stats := make([]Stats, len(fo.children))
+	for i, c := range fo.children {
+		stats[i] = c.stats.GetStats()
+	}
+	return stats
+}
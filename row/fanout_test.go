@@ -0,0 +1,131 @@
+package row_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/m-lab/etl/row"
+)
+
+// failingSink commits the first row of each block, and fails the rest.
+func failingSink() *blockingSink {
+	bs := &blockingSink{release: make(chan struct{}), fail: true}
+	close(bs.release)
+	return bs
+}
+
+// finishingSink records the task error passed to Finish.
+type finishingSink struct {
+	inMemorySink
+	taskErr error
+	fail    error
+}
+
+func (fs *finishingSink) Finish(err error) error {
+	fs.taskErr = err
+	return fs.fail
+}
+
+func TestFanOut(t *testing.T) {
+	rows := []interface{}{1, 2, 3}
+	tests := []struct {
+		name      string
+		mode      row.FanOutMode
+		primary   row.Sink
+		secondary row.Sink
+		want      int
+		wantErr   bool
+	}{
+		{"all-ok", row.AllMustSucceed, newInMemorySink(), newInMemorySink(), 3, false},
+		{"all-secondary-fails", row.AllMustSucceed, newInMemorySink(), failingSink(), 1, true},
+		{"primary-secondary-fails", row.PrimaryMustSucceed, newInMemorySink(), failingSink(), 3, false},
+		{"primary-fails", row.PrimaryMustSucceed, failingSink(), newInMemorySink(), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fo, err := row.NewFanOut(tt.mode,
+				row.Child{Name: "primary", Sink: tt.primary},
+				row.Child{Name: "secondary", Sink: tt.secondary})
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := fo.Commit(rows, "test")
+			if n != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("Commit() = %d, %v, want %d, error %v", n, err, tt.want, tt.wantErr)
+			}
+			for i, s := range fo.ChildStats() {
+				if s.Total() != 3 || s.Pending != 0 {
+					t.Errorf("Child %d stats = %+v", i, s)
+				}
+			}
+			if fo.GetStats() != fo.ChildStats()[0] {
+				t.Error("GetStats() should return the primary stats")
+			}
+		})
+	}
+
+	if _, err := row.NewFanOut(row.AllMustSucceed); err != row.ErrInvalidSink {
+		t.Error("Expected ErrInvalidSink, got", err)
+	}
+	// Filters modify the rows, so they can't be children.
+	filter := row.NewFilter(newInMemorySink(), mustPolicy(t), "lga04")
+	if _, err := row.NewFanOut(row.AllMustSucceed, row.Child{Name: "a", Sink: filter}); err != row.ErrInvalidSink {
+		t.Error("Expected ErrInvalidSink, got", err)
+	}
+}
+
+func TestFanOutBestEffort(t *testing.T) {
+	primary := newInMemorySink()
+	secondary := &blockingSink{release: make(chan struct{})}
+	fo, err := row.NewFanOut(row.BestEffortSecondaries,
+		row.Child{Name: "primary", Sink: primary},
+		row.Child{Name: "secondary", Sink: secondary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The secondary is blocked, so only the first blocks are accepted, and
+	// the rest are dropped.
+	for i := 0; i < 10; i++ {
+		if n, err := fo.Commit([]interface{}{i}, "test"); n != 1 || err != nil {
+			t.Fatal("Commit failed:", n, err)
+		}
+	}
+	if len(primary.data) != 10 {
+		t.Error("Primary should not wait for the secondary")
+	}
+	close(secondary.release)
+	if err := fo.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(secondary.data, []interface{}{0, 1, 2, 3, 4, 5, 6, 7}) {
+		t.Error("Secondary rows out of order or missing:", secondary.data)
+	}
+	stats := fo.ChildStats()[1]
+	if stats.Committed != 8 || stats.Failed != 2 || stats.Pending != 0 {
+		t.Errorf("Secondary stats = %+v", stats)
+	}
+}
+
+func TestFanOutFinish(t *testing.T) {
+	taskErr := errors.New("task failed")
+	for _, mode := range []row.FanOutMode{row.AllMustSucceed, row.PrimaryMustSucceed} {
+		primary := &finishingSink{}
+		secondary := &finishingSink{fail: errors.New("finish failed")}
+		fo, err := row.NewFanOut(mode,
+			row.Child{Name: "primary", Sink: primary},
+			row.Child{Name: "plain", Sink: newInMemorySink()},
+			row.Child{Name: "secondary", Sink: secondary})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = fo.Finish(taskErr)
+		if primary.taskErr != taskErr || secondary.taskErr != taskErr {
+			t.Error("Finish should pass the task error to each Finisher")
+		}
+		// Secondary errors only matter if all must succeed.
+		if (err != nil) != (mode == row.AllMustSucceed) {
+			t.Errorf("Finish() mode %d error = %v", mode, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package row
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/m-lab/etl/metrics"
+)
+
+// Errors that may be returned by privacy filtering functions.
+var (
+	ErrInvalidPolicy = errors.New("invalid privacy policy")
+	ErrNotRedactable = errors.New("object does not implement Redactable")
+)
+
+// Redactable is implemented by row types that can be filtered by a
+// PrivacyPolicy.
+type Redactable interface {
+	// Redact truncates IPs and removes hostnames as required by the policy.
+	// It returns false, without modifying the row, if the row must be
+	// dropped.
+	Redact(p *PrivacyPolicy) bool
+}
+
+// PrivacyPolicy describes how rows are filtered before they leave the
+// parser, so that published tables meet our privacy commitments.  Policies
+// are loaded from JSON, e.g.
+// {"version": "2020-04", "datatypes": ["ndt", "ndt5", "ndt7"],
+// "drop_sites": ["lga03"], "drop_networks": ["192.168.0.0/16"],
+// "ipv4_prefix": 24, "ipv6_prefix": 48, "strip_hostnames": true}
+type PrivacyPolicy struct {
+	// Version identifies the policy, and is exported as the
+	// etl_privacy_policy metric.
+	Version string `json:"version"`
+	// DataTypes lists the datatypes, e.g. "ndt5", that the policy applies to.
+	// Only ndt, ndt5, ndt7 and tcpinfo rows can be redacted.
+	DataTypes []string `json:"datatypes"`
+	// DropSites lists the sites, e.g. "lga03", whose tests are dropped.
+	DropSites []string `json:"drop_sites"`
+	// DropNetworks lists CIDR ranges.  Tests with a client or server IP in
+	// any of them are dropped.
+	DropNetworks []string `json:"drop_networks"`
+	// IPv4Prefix and IPv6Prefix are the prefix lengths that client IPs are
+	// truncated to, e.g. 24 and 48.  Zero leaves the IPs unchanged.
+	IPv4Prefix int `json:"ipv4_prefix"`
+	IPv6Prefix int `json:"ipv6_prefix"`
+	// StripHostnames removes client hostnames.
+	StripHostnames bool `json:"strip_hostnames"`
+
+	nets   []*net.IPNet
+	v4Mask net.IPMask
+	v6Mask net.IPMask
+}
+
+// redactableTypes lists the datatypes whose rows implement Redactable.
+var redactableTypes = map[string]bool{"ndt": true, "ndt5": true, "ndt7": true, "tcpinfo": true}
+
+// ParsePrivacyPolicy parses and validates a JSON privacy policy.
+func ParsePrivacyPolicy(data []byte) (*PrivacyPolicy, error) {
+	p := &PrivacyPolicy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if p.Version == "" || len(p.DataTypes) == 0 {
+		return nil, fmt.Errorf("%w: version and datatypes are required", ErrInvalidPolicy)
+	}
+	for _, dt := range p.DataTypes {
+		if !redactableTypes[dt] {
+			return nil, fmt.Errorf("%w: datatype %q can't be redacted", ErrInvalidPolicy, dt)
+		}
+	}
+	if p.IPv4Prefix < 0 || p.IPv4Prefix > 32 || p.IPv6Prefix < 0 || p.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("%w: bad prefix length /%d or /%d", ErrInvalidPolicy, p.IPv4Prefix, p.IPv6Prefix)
+	}
+	if p.IPv4Prefix > 0 {
+		p.v4Mask = net.CIDRMask(p.IPv4Prefix, 32)
+	}
+	if p.IPv6Prefix > 0 {
+		p.v6Mask = net.CIDRMask(p.IPv6Prefix, 128)
+	}
+	for _, cidr := range p.DropNetworks {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+		}
+		p.nets = append(p.nets, n)
+	}
+	return p, nil
+}
+
+// LoadPrivacyPolicy loads a JSON privacy policy from a file.
+func LoadPrivacyPolicy(fn string) (*PrivacyPolicy, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivacyPolicy(data)
+}
+
+// AppliesTo returns true if the policy applies to the datatype.
+func (p *PrivacyPolicy) AppliesTo(dataType string) bool {
+	for _, dt := range p.DataTypes {
+		if dt == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+// DropSite returns true if tests from the site must be dropped.
+func (p *PrivacyPolicy) DropSite(site string) bool {
+	for _, s := range p.DropSites {
+		if s == site {
+			return true
+		}
+	}
+	return false
+}
+
+// DropIP returns true if the IP is in a dropped network.
+func (p *PrivacyPolicy) DropIP(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range p.nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TruncatesIPs returns true if the policy truncates client IPs.
+func (p *PrivacyPolicy) TruncatesIPs() bool {
+	return p.v4Mask != nil || p.v6Mask != nil
+}
+
+// TruncateIP returns the IP truncated to the policy's prefix length.  If the
+// policy truncates IPs, an IP that can't be parsed is removed.
+func (p *PrivacyPolicy) TruncateIP(ip string) string {
+	if ip == "" || !p.TruncatesIPs() {
+		return ip
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	if v4 := addr.To4(); v4 != nil {
+		if p.v4Mask == nil {
+			return ip
+		}
+		return v4.Mask(p.v4Mask).String()
+	}
+	if p.v6Mask == nil {
+		return ip
+	}
+	return addr.Mask(p.v6Mask).String()
+}
+
+// Hostname returns the client hostname, or "" if hostnames are stripped.
+func (p *PrivacyPolicy) Hostname(name string) string {
+	if p.StripHostnames {
+		return ""
+	}
+	return name
+}
+
+// TruncateAddr truncates the IP of a host:port address, as TruncateIP.  The
+// port is kept.  If the policy truncates IPs, an address without a valid IP
+// is removed.
+func (p *PrivacyPolicy) TruncateAddr(addr string) string {
+	if addr == "" || !p.TruncatesIPs() {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return p.TruncateIP(addr)
+	}
+	host = p.TruncateIP(host)
+	if host == "" {
+		return ""
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// MetadataValue returns the value of a client provided metadata entry, with
+// any IP address truncated, and false if the entry must be removed.  Clients may report
+// their own hostname, so entries whose name mentions a host are removed if
+// hostnames are stripped.
+func (p *PrivacyPolicy) MetadataValue(name, value string) (string, bool) {
+	if strings.Contains(strings.ToLower(name), "host") && p.Hostname(value) == "" {
+		return "", false
+	}
+	if net.ParseIP(value) != nil {
+		return p.TruncateIP(value), true
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil && net.ParseIP(host) != nil {
+		return p.TruncateAddr(value), true
+	}
+	return value, true
+}
+
+// Apply applies the policy to each row, and returns the rows to keep, and
+// the number of rows dropped by the policy.  Rows that are not Redactable
+// are also omitted, and ErrNotRedactable is returned.
+func (p *PrivacyPolicy) Apply(rows []interface{}, label string) ([]interface{}, int, error) {
+	kept := make([]interface{}, 0, len(rows))
+	dropped := 0
+	var err error
+	for _, r := range rows {
+		rr, ok := r.(Redactable)
+		switch {
+		case !ok:
+			err = ErrNotRedactable
+			metrics.PrivacyRowCount.WithLabelValues(label, "not_redactable").Inc()
+		case rr.Redact(p):
+			kept = append(kept, r)
+			metrics.PrivacyRowCount.WithLabelValues(label, "kept").Inc()
+		default:
+			dropped++
+			metrics.PrivacyRowCount.WithLabelValues(label, "dropped").Inc()
+		}
+	}
+	return kept, dropped, err
+}
+
+// Filter is a Sink that applies a PrivacyPolicy to rows before committing
+// them to another Sink.  Rows are modified in place, so a Filter may wrap a
+// FanOut, but may not be one of its children.  Filter also implements
+// task.Finisher, passing the task result to the wrapped Sink if it is a
+// Finisher.
+// It is THREAD-SAFE if the wrapped Sink is.
+type Filter struct {
+	sink    Sink
+	policy  *PrivacyPolicy
+	dropAll bool // The rows come from a dropped site.
+}
+
+// NewFilter creates a Filter for rows from an archive from the site.
+func NewFilter(sink Sink, policy *PrivacyPolicy, site string) *Filter {
+	return &Filter{sink: sink, policy: policy, dropAll: policy.DropSite(site)}
+}
+
+// Commit implements Sink.  Dropped rows are counted as committed.
+func (f *Filter) Commit(rows []interface{}, label string) (int, error) {
+	if f.dropAll {
+		metrics.PrivacyRowCount.WithLabelValues(label, "dropped_site").Add(float64(len(rows)))
+		return len(rows), nil
+	}
+	kept, dropped, err := f.policy.Apply(rows, label)
+	if len(kept) == 0 {
+		return dropped, err
+	}
+	n, commitErr := f.sink.Commit(kept, label)
+	switch {
+	case commitErr == nil:
+	case err == nil:
+		err = commitErr
+	default:
+		err = CommitErrors{err, commitErr}
+	}
+	return n + dropped, err
+}
+
+// Finish implements task.Finisher.
+func (f *Filter) Finish(err error) error {
+	if fin, ok := f.sink.(finisher); ok {
+		return fin.Finish(err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package row_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/m-lab/etl/row"
+)
+
+const testPolicy = `{"version": "test-1", "datatypes": ["ndt5"],
+	"drop_sites": ["lga03"], "drop_networks": ["10.0.0.0/8", "2001:db8:bad::/48"],
+	"ipv4_prefix": 24, "ipv6_prefix": 48, "strip_hostnames": true}`
+
+// testRow is a Redactable row with a client IP.
+type testRow struct {
+	ClientIP string
+}
+
+func (r *testRow) Redact(p *row.PrivacyPolicy) bool {
+	if p.DropIP(r.ClientIP) {
+		return false
+	}
+	r.ClientIP = p.TruncateIP(r.ClientIP)
+	return true
+}
+
+func mustPolicy(t *testing.T) *row.PrivacyPolicy {
+	p, err := row.ParsePrivacyPolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParsePrivacyPolicy(t *testing.T) {
+	p := mustPolicy(t)
+	if !p.AppliesTo("ndt5") || p.AppliesTo("ndt7") {
+		t.Error("Wrong datatypes:", p.DataTypes)
+	}
+	if !p.DropSite("lga03") || p.DropSite("lga04") {
+		t.Error("Wrong sites:", p.DropSites)
+	}
+	if p.Hostname("host.example.com") != "" {
+		t.Error("Hostname should be stripped")
+	}
+
+	for _, bad := range []string{
+		"",
+		`{"datatypes": ["ndt5"]}`,
+		`{"version": "1"}`,
+		`{"version": "1", "datatypes": ["ndt5", "traceroute"]}`,
+		`{"version": "1", "datatypes": ["annotation"]}`,
+		`{"version": "1", "datatypes": ["sidestream"]}`,
+		`{"version": "1", "datatypes": ["ndt5"], "ipv4_prefix": 33}`,
+		`{"version": "1", "datatypes": ["ndt5"], "ipv6_prefix": -1}`,
+		`{"version": "1", "datatypes": ["ndt5"], "drop_networks": ["10.0.0.0"]}`,
+	} {
+		if _, err := row.ParsePrivacyPolicy([]byte(bad)); !errors.Is(err, row.ErrInvalidPolicy) {
+			t.Errorf("ParsePrivacyPolicy(%q) error = %v", bad, err)
+		}
+	}
+}
+
+func TestPrivacyPolicyIPs(t *testing.T) {
+	p := mustPolicy(t)
+	tests := []struct {
+		ip   string
+		drop bool
+		want string
+	}{
+		{"192.168.13.57", false, "192.168.13.0"},
+		{"::ffff:192.168.13.57", false, "192.168.13.0"},
+		{"2001:db8:1234:5678::1", false, "2001:db8:1234::"},
+		{"10.1.2.3", true, "10.1.2.0"},
+		{"2001:db8:bad:1::1", true, "2001:db8:bad::"},
+		{"", false, ""},
+		{"not-an-ip", false, ""},
+	}
+	for _, tt := range tests {
+		if got := p.DropIP(tt.ip); got != tt.drop {
+			t.Errorf("DropIP(%q) = %v, want %v", tt.ip, got, tt.drop)
+		}
+		if got := p.TruncateIP(tt.ip); got != tt.want {
+			t.Errorf("TruncateIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	for addr, want := range map[string]string{
+		"192.168.13.57:3010":          "192.168.13.0:3010",
+		"[2001:db8:1234:5678::1]:443": "[2001:db8:1234::]:443",
+		"192.168.13.57":               "192.168.13.0",
+		"host.example.com:443":        "",
+		"":                            "",
+	} {
+		if got := p.TruncateAddr(addr); got != want {
+			t.Errorf("TruncateAddr(%q) = %q, want %q", addr, got, want)
+		}
+	}
+
+	// Without prefixes, IPs are unchanged.
+	p, err := row.ParsePrivacyPolicy([]byte(`{"version": "1", "datatypes": ["ndt5"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.TruncateIP("192.168.13.57"); got != "192.168.13.57" {
+		t.Error("TruncateIP() =", got)
+	}
+}
+
+func TestPrivacyPolicyMetadataValue(t *testing.T) {
+	p := mustPolicy(t)
+	tests := []struct {
+		name, value string
+		want        string
+		keep        bool
+	}{
+		{"client_library_name", "ndt7-client-go", "ndt7-client-go", true},
+		{"client_library_version", "host:0.1.0", "host:0.1.0", true},
+		{"client.hostname", "host.example.com", "", false},
+		{"client_ip", "192.168.13.57", "192.168.13.0", true},
+		{"client_addr", "192.168.13.57:3010", "192.168.13.0:3010", true},
+	}
+	for _, tt := range tests {
+		got, keep := p.MetadataValue(tt.name, tt.value)
+		if got != tt.want || keep != tt.keep {
+			t.Errorf("MetadataValue(%q, %q) = %q, %v", tt.name, tt.value, got, keep)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p := mustPolicy(t)
+	rows := []interface{}{
+		&testRow{ClientIP: "192.168.13.57"},
+		&testRow{ClientIP: "10.1.2.3"},
+		&testRow{ClientIP: "2001:db8:1234:5678::1"},
+	}
+
+	sink := newInMemorySink()
+	n, err := row.NewFilter(sink, p, "lga04").Commit(rows, "ndt5")
+	if n != 3 || err != nil {
+		t.Fatalf("Commit() = %d, %v", n, err)
+	}
+	if len(sink.data) != 2 {
+		t.Fatal("Expected 2 rows, got", len(sink.data))
+	}
+	for i, want := range []string{"192.168.13.0", "2001:db8:1234::"} {
+		r := sink.data[i].(*testRow)
+		if r.ClientIP != want {
+			t.Errorf("Row %d = %+v", i, r)
+		}
+	}
+
+	// Rows that can't be redacted are dropped, and reported as errors.
+	sink = newInMemorySink()
+	n, err = row.NewFilter(sink, p, "lga04").Commit([]interface{}{1, &testRow{}}, "ndt5")
+	if n != 1 || !errors.Is(err, row.ErrNotRedactable) || len(sink.data) != 1 {
+		t.Errorf("Commit() = %d, %v with %d rows", n, err, len(sink.data))
+	}
+
+	// Rows from dropped sites are never committed.
+	sink = newInMemorySink()
+	n, err = row.NewFilter(sink, p, "lga03").Commit(rows, "ndt5")
+	if n != 3 || err != nil || len(sink.data) != 0 {
+		t.Errorf("Commit() = %d, %v with %d rows", n, err, len(sink.data))
+	}
+}
+
+func TestFilterFinish(t *testing.T) {
+	p := mustPolicy(t)
+	fail := errors.New("finish failed")
+	fs := &finishingSink{fail: fail}
+	taskErr := errors.New("task failed")
+	if err := row.NewFilter(fs, p, "").Finish(taskErr); err != fail || fs.taskErr != taskErr {
+		t.Error("Finish() =", err, fs.taskErr)
+	}
+	if err := row.NewFilter(newInMemorySink(), p, "").Finish(nil); err != nil {
+		t.Error("Finish() =", err)
+	}
+}
@@ -5,7 +5,10 @@ package row
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -38,6 +41,17 @@ type Annotatable interface {
 	AnnotateServer(*api.Annotations) error             // Must properly handle nil parameter.
 }
 
+// InsertID returns a deterministic BigQuery insert ID for the index'th row
+// parsed from testName in the archive.  BigQuery uses insert IDs to
+// deduplicate rows that are inserted more than once, e.g. when a task is
+// retried, so the ID must not depend on anything that changes between runs,
+// such as the parse time.
+func InsertID(archive, testName string, index int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d", archive, testName, index)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
 // Stats contains stats about buffer history.
 type Stats struct {
 	Buffered  int // rows buffered but not yet sent.
@@ -286,6 +300,17 @@ func (ann *annotator) Annotate(rows []interface{}, metricLabel string) error {
 	return nil
 }
 
+// DefaultMaxInFlight is the default limit on the number of blocks that a Base
+// may be annotating or committing concurrently.
+const DefaultMaxInFlight = 4
+
+// CommitErrors aggregates the errors from several asynchronous commits.
+type CommitErrors []error
+
+func (ce CommitErrors) Error() string {
+	return fmt.Sprintf("%d commits failed, first error: %v", len(ce), ce[0])
+}
+
 // Base provides common parser functionality.
 // Base is NOT THREAD-SAFE
 type Base struct {
@@ -295,12 +320,30 @@ type Base struct {
 	label string // Used in metrics and errors.
 
 	stats ActiveStats
+
+	slots   chan struct{}  // Limits the number of blocks in flight.
+	last    chan struct{}  // Closed when the most recently submitted block is committed.
+	pending sync.WaitGroup // Tracks all blocks in flight.
+
+	errLock sync.Mutex // Protects errs.
+	errs    []error    // Commit errors since the last Flush.
 }
 
 // NewBase creates a new Base.  This will generally be embedded in a type specific parser.
 func NewBase(label string, sink Sink, bufSize int, ann v2as.Annotator) *Base {
 	buf := NewBuffer(bufSize)
-	return &Base{sink: sink, ann: annotator{ann}, buf: buf, label: label}
+	return &Base{sink: sink, ann: annotator{ann}, buf: buf, label: label,
+		slots: make(chan struct{}, DefaultMaxInFlight)}
+}
+
+// SetMaxInFlight sets the limit on the number of blocks being annotated or
+// committed concurrently.  Put blocks while the limit is reached.
+// It must be called before the first Put.
+func (pb *Base) SetMaxInFlight(n int) {
+	if n < 1 {
+		n = 1
+	}
+	pb.slots = make(chan struct{}, n)
 }
 
 // GetStats returns the buffer/sink stats.
@@ -313,46 +356,86 @@ func (pb *Base) TaskError() error {
 	return nil
 }
 
-func (pb *Base) commit(rows []interface{}) error {
-	// TODO - care about error?
-	_ = pb.ann.Annotate(rows, pb.label)
-	// TODO do we need these to be done in order.
+// commit writes a block of rows to the Sink, and records the result.
+func (pb *Base) commit(rows []interface{}) {
 	// This is synchronous, blocking, and thread safe.
 	done, err := pb.sink.Commit(rows, pb.label)
 	if done > 0 {
 		pb.stats.Done(done, nil)
 	}
 	if err != nil {
+		log.Println(err)
 		pb.stats.Done(len(rows)-done, err)
+		pb.errLock.Lock()
+		pb.errs = append(pb.errs, err)
+		pb.errLock.Unlock()
 	}
-	return err
 }
 
-// Flush synchronously flushes any pending rows.
+// submit hands a block of rows to a commit goroutine, blocking while
+// the maximum number of blocks are already in flight.
+// Blocks are annotated concurrently, but committed to the Sink in the
+// order they were submitted.
+func (pb *Base) submit(rows []interface{}) {
+	pb.stats.MoveToPending(len(rows))
+	pb.slots <- struct{}{}
+	prev := pb.last
+	done := make(chan struct{})
+	pb.last = done
+	pb.pending.Add(1)
+	go func() {
+		defer pb.pending.Done()
+		defer func() { <-pb.slots }()
+		defer close(done)
+
+		// TODO - care about error?
+		_ = pb.ann.Annotate(rows, pb.label)
+		if prev != nil {
+			<-prev
+		}
+		pb.commit(rows)
+	}()
+}
+
+// Flush commits any buffered rows, and waits for all blocks in flight.
+// It returns nil if all commits since the previous Flush succeeded, the
+// error if one failed, or CommitErrors if several failed.
 func (pb *Base) Flush() error {
 	rows := pb.buf.Reset()
-	pb.stats.MoveToPending(len(rows))
-	return pb.commit(rows)
+	if len(rows) > 0 {
+		pb.submit(rows)
+	}
+	pb.pending.Wait()
+	pb.last = nil
+
+	pb.errLock.Lock()
+	defer pb.errLock.Unlock()
+	errs := pb.errs
+	pb.errs = nil
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return CommitErrors(errs)
+	}
 }
 
 // Put adds a row to the buffer.
-// Iff the buffer is already full the prior buffered rows are
-// annotated and committed to the Sink.
-// NOTE: There is no guarantee about ordering of writes resulting from
-// sequential calls to Put.  However, once a block of rows is submitted
-// to pb.commit, it should be written in the same order to the Sink.
+// Iff the buffer is already full the prior buffered rows are handed off
+// to be annotated and committed to the Sink asynchronously.  Put blocks if
+// the maximum number of blocks are already in flight.
+// NOTE: Blocks are committed to the Sink in the order they fill, and the
+// rows in each block are written in order, but commits are only guaranteed
+// to be complete after Flush returns.
 // TODO improve Annotatable architecture.
 func (pb *Base) Put(row Annotatable) {
 	rows := pb.buf.Append(row)
 	pb.stats.Inc()
 
 	if rows != nil {
-		pb.stats.MoveToPending(len(rows))
-		// TODO consider making this asynchronous.
-		err := pb.commit(rows)
-		if err != nil {
-			log.Println(err)
-		}
+		pb.submit(rows)
 	}
 }
 
@@ -1,9 +1,11 @@
 package row_test
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -180,6 +182,132 @@ func TestAsyncPut(t *testing.T) {
 	}
 }
 
+// blockingSink records the order of committed rows, and blocks each Commit
+// until released.
+type blockingSink struct {
+	release chan struct{}
+	fail    bool
+
+	lock sync.Mutex
+	data []interface{}
+}
+
+func (bs *blockingSink) Commit(data []interface{}, label string) (int, error) {
+	<-bs.release
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	bs.data = append(bs.data, data...)
+	if bs.fail {
+		return 1, errors.New("commit failed")
+	}
+	return len(data), nil
+}
+
+func emptyAnnotator() (v2as.Annotator, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"AnnotatorDate":"2018-12-05T00:00:00Z", "Annotations":{}}`)
+	}))
+	return v2as.GetAnnotator(ts.URL), ts.Close
+}
+
+func TestPipelinedPut(t *testing.T) {
+	ann, done := emptyAnnotator()
+	defer done()
+	bs := &blockingSink{release: make(chan struct{})}
+	b := row.NewBase("test", bs, 2, ann)
+	b.SetMaxInFlight(2)
+
+	// The first two full blocks should not block.
+	rows := make([]*Row, 0)
+	for i := 0; i < 7; i++ {
+		rows = append(rows, &Row{client: fmt.Sprint(i)})
+	}
+	for _, r := range rows[:5] {
+		b.Put(r)
+	}
+	if s := b.GetStats(); s.Pending != 4 || s.Buffered != 1 {
+		t.Errorf("Expected 4 pending, 1 buffered: %+v", s)
+	}
+
+	// The third full block should block until a commit completes.
+	putDone := make(chan struct{})
+	go func() {
+		b.Put(rows[5])
+		b.Put(rows[6])
+		close(putDone)
+	}()
+	select {
+	case <-putDone:
+		t.Fatal("Put should have blocked")
+	case <-time.After(100 * time.Millisecond):
+	}
+	bs.release <- struct{}{}
+	<-putDone
+	if s := b.GetStats(); s.Pending != 4 || s.Committed != 2 || s.Buffered != 1 {
+		t.Errorf("Expected 4 pending, 2 committed, 1 buffered: %+v", s)
+	}
+
+	close(bs.release)
+	if err := b.Flush(); err != nil {
+		t.Error(err)
+	}
+	if s := b.GetStats(); s.Pending != 0 || s.Committed != 7 || s.Buffered != 0 {
+		t.Errorf("Expected 7 committed: %+v", s)
+	}
+	for i := range rows {
+		if bs.data[i] != rows[i] {
+			t.Fatal("Rows committed out of order at", i)
+		}
+	}
+}
+
+func TestFlushErrors(t *testing.T) {
+	ann, done := emptyAnnotator()
+	defer done()
+	bs := &blockingSink{release: make(chan struct{}), fail: true}
+	close(bs.release)
+	b := row.NewBase("test", bs, 2, ann)
+
+	b.Put(&Row{})
+	b.Put(&Row{})
+	b.Put(&Row{})
+	err := b.Flush()
+	if errs, ok := err.(row.CommitErrors); !ok || len(errs) != 2 {
+		t.Error("Expected 2 CommitErrors, got", err)
+	}
+	if s := b.GetStats(); s.Pending != 0 || s.Committed != 2 || s.Failed != 1 {
+		t.Errorf("Expected 2 committed, 1 failed: %+v", s)
+	}
+
+	// Errors should be cleared by Flush.
+	bs.fail = false
+	b.Put(&Row{})
+	if err := b.Flush(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInsertID(t *testing.T) {
+	id := row.InsertID("gs://bucket/archive.tgz", "test.json", 0)
+	if id != row.InsertID("gs://bucket/archive.tgz", "test.json", 0) {
+		t.Error("InsertID should be deterministic")
+	}
+	if len(id) != 32 {
+		t.Error("Unexpected InsertID length:", id)
+	}
+	others := []string{
+		row.InsertID("gs://bucket/archive.tgz", "test.json", 1),
+		row.InsertID("gs://bucket/archive.tgz", "test2.json", 0),
+		row.InsertID("gs://bucket/other.tgz", "test.json", 0),
+		row.InsertID("gs://bucket/archive.tgz", "test.json0", 0),
+	}
+	for _, other := range others {
+		if other == id {
+			t.Error("InsertID collision:", id)
+		}
+	}
+}
+
 func assertBQInserterIsSink(in row.Sink) {
 	func(in row.Sink) {}(&bq.BQInserter{})
 }
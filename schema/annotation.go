@@ -5,6 +5,7 @@ import (
 
 	"cloud.google.com/go/civil"
 	"github.com/m-lab/go/cloud/bqx"
+	"github.com/m-lab/go/rtx"
 	"github.com/m-lab/uuid-annotator/annotator"
 
 	"github.com/m-lab/etl/row"
@@ -39,3 +40,22 @@ func (row *AnnotationRow) Schema() (bigquery.Schema, error) {
 	rr := bqx.RemoveRequired(sch)
 	return rr, err
 }
+
+var annotationSchema bigquery.Schema
+
+func init() {
+	var err error
+	annotationSchema, err = (&AnnotationRow{}).Schema()
+	rtx.Must(err, "Error generating annotation schema")
+}
+
+// Save implements bigquery.ValueSaver, using the UUID as the insert ID, so
+// that retried tasks are deduplicated.
+func (r *AnnotationRow) Save() (map[string]bigquery.Value, string, error) {
+	id := r.UUID
+	if id == "" {
+		id = row.InsertID(r.Parser.ArchiveURL, r.Parser.Filename, 0)
+	}
+	ss := bigquery.StructSaver{Schema: annotationSchema, InsertID: id, Struct: r}
+	return ss.Save()
+}
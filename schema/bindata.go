@@ -163,7 +163,7 @@ func readmeMd() (*asset, error) {
 	return a, nil
 }
 
-var _tcprowYaml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd4\x5b\x4b\x73\xdb\xb8\xb2\xde\xe7\x57\x74\xcd\xe6\xda\x55\xb6\xf2\x98\x4c\x26\xc9\xad\xba\x29\x59\x56\xe6\xba\x12\x3f\x46\x64\xe2\x33\x2b\x16\x04\xb4\x24\x8c\x40\x80\x01\x40\xc9\xca\xaf\x3f\xd5\x20\x29\xd1\x24\x65\xc9\x19\x2b\xa7\xce\x4e\x96\x40\x74\x7f\x8d\x7e\x7c\xdd\xa0\xe3\xc1\xcd\x85\x9e\x98\xf7\xcf\x00\xce\xd1\x71\x2b\x33\x2f\x8d\x7e\x0f\x23\x74\xb9\xf2\x0e\x26\xd6\xa4\x30\x45\xef\x0c\x9f\x9b\xcc\x1f\xf5\x7a\xf1\xe0\x26\xb9\xb8\xfa\x78\xdd\xeb\x1d\x3f\x2b\x9f\xee\x45\x9e\x79\x6c\xed\x11\x0f\x6e\x20\xfc\x42\x3f\x48\xc7\x73\xe7\xc2\xf7\x17\x1a\x2e\x3f\xb3\x31\x08\xe6\x59\x58\xe4\x68\x11\x48\x07\xda\xa4\x52\x33\xa5\x56\xf0\x12\x8e\x86\xce\xb3\xb1\x92\x6e\x86\xe2\xb8\xf7\x0c\x00\xe0\xda\xcf\xd0\xc2\x82\xa9\x1c\x1d\x58\x9c\x28\xe4\x1e\xbc\x65\xda\x49\xd4\xbe\xd8\xc6\xc1\x8c\x2d\xa4\x9e\x82\xd4\xdc\xa4\x99\x42\x8f\x60\xcd\xd2\xd1\x0e\x23\x9c\xa0\x45\xcd\xf1\x3d\x8c\x3e\x0e\xe0\xf7\x77\x2f\x9f\x01\x7c\x42\xab\x51\xbd\x87\x08\x91\x94\x49\x86\x51\xdc\x3f\xfb\x7c\x11\xfd\xff\xf0\x1c\xa4\xa6\x6d\x54\x2e\xf0\xb9\x46\xff\xdc\xf3\x2c\x29\x84\xf4\x66\x6b\xec\x83\x7e\x37\xfa\xcf\xc6\x91\x92\xdc\x2c\xd0\xae\x4a\x88\x29\xe3\x33\xa9\x9b\xf6\xf8\x68\x2c\xa1\x10\x92\x1e\x64\x0a\x14\x3d\x39\x66\x0e\x05\x70\xa3\xa7\xe8\xe8\x7b\xfa\xe8\xad\x51\xc0\xd4\xd4\x58\xe9\x67\xa9\x3b\x81\x52\x36\x48\x17\xec\xc3\x94\x33\x90\xd3\x73\xde\xac\xd7\x2f\xa5\x16\x66\x09\x4c\xfc\x9d\x3b\x9f\xa2\xf6\x4d\x53\xc0\xc0\xa4\xe1\x7b\x82\x4b\x30\x65\xb6\x78\x1d\xb0\x4a\x9d\xe5\xbe\xc7\x6b\x46\x0a\x16\x40\x9f\x70\x96\x94\x87\xd6\xb2\x50\xcd\x34\x23\x0c\x87\x93\x4a\xef\x5a\xe6\xb9\xca\xd3\x31\x5a\x30\x13\xf0\x32\x45\x93\x7b\x07\x47\xa3\xf8\xba\xc4\x6d\xab\x27\x83\x89\xdc\x31\x30\x0f\x7e\x26\x1d\x38\xfc\x96\x93\xda\xbd\x86\x0d\x47\xe8\xd0\x13\xec\xef\x68\x0d\x18\x0d\x13\x63\x97\xcc\x0a\xc8\xac\x99\x5a\x74\xae\x06\x42\x72\x37\x4f\xec\x46\xb7\x26\x08\xa9\x09\xa1\xd1\x1a\x39\xe9\x9a\x90\xef\xd7\x50\xdd\x58\x33\xc6\x36\xa0\x81\xd1\x0e\x79\xee\xe5\x02\x0b\x25\x4a\xc3\x67\x61\x39\xf8\x19\xf3\xe4\x9a\x08\x53\xa3\x11\x72\xcd\xb4\x5b\xa2\x45\xb1\xcb\x2f\x83\xb6\xc5\x26\x89\xc9\xfd\x23\x95\x3d\x63\x7c\x6e\x26\x93\x96\xb6\xc3\xbb\xcc\x68\xd4\x5e\x32\x55\x1d\x00\x8c\x8b\xb5\xc0\x4d\xae\x3d\xda\x56\xd4\x72\x8b\xe4\x27\x64\xdd\x51\x7c\x7d\x02\x36\xd8\xdc\x68\x70\x39\xe7\xe8\xdc\x24\x57\x30\x8a\x63\x48\x91\xb9\xbc\x58\x1b\x7c\xed\x1e\x92\x4a\xc8\xe3\x60\x5c\x07\xb5\xdb\x46\x3f\x93\x1e\x50\x73\x23\x50\x40\xf4\xd7\x15\x98\x62\x1d\x30\x2d\xc0\x84\x6c\xa1\x71\x6a\xbc\x64\xe1\xeb\x06\xa2\x5f\x42\xd0\xc4\x17\x97\x14\xf2\x97\x37\x11\xbc\xb8\x7b\xf9\xbf\xe1\xbb\xa8\x3f\xf8\x04\x2f\xee\x5e\x15\x7f\xdd\x46\x83\xfe\xe7\x21\xbc\xb8\x7b\x5d\xfc\x3d\x1c\x5c\xc1\x8b\xbb\xb7\x70\x0a\xb7\xcc\xad\x05\xa0\x58\xff\x9a\x44\xc3\xe1\x15\x9c\x42\xdf\x83\x42\xe6\xc8\x46\x08\xc3\x41\x0c\x0e\x51\x97\x12\xfe\xba\x4a\xce\xfb\x71\x1f\x4e\xe9\xe3\x29\xc9\x63\x7c\xae\xcd\x52\xa1\x98\xa2\x28\x72\xa3\xd4\x01\x94\x0b\x46\xb7\x60\xf9\x42\xfc\x52\xb3\x27\x19\x27\xb9\xbe\x89\x93\x1a\x84\x9a\x59\x73\x96\xc9\xe7\x4a\xea\xfc\xae\x11\x96\xb7\x11\x67\xaa\x9d\xb0\xce\xbe\xfc\x41\x4e\x3c\x51\xc1\x58\x14\x99\x91\x16\xc5\xda\x60\xcf\x11\x5f\x14\x7f\x35\xcc\x48\x89\x73\x2a\xfd\x2c\x1f\xf7\xb8\x49\x9f\xa7\xa7\x8a\x8d\x9f\xa3\x57\xcf\xa5\x73\x39\xba\xe7\xbf\xbf\x7b\xb1\x29\x14\xd5\x8e\x2d\xe9\xb7\x45\xb4\xb8\x20\x2e\xe4\xb0\xf1\x0a\xfc\x0c\x41\x19\xce\x14\xd9\x40\xa0\xa5\x00\x17\x48\xc7\x0d\x0e\xa7\xbd\xa5\x16\xc1\x98\x5f\xa5\x93\x63\xd2\xd2\x41\xb1\xfb\x09\x64\xa8\x05\x55\x81\x5d\x8a\xb5\x83\xef\xd7\x57\xbf\xd6\x6c\xec\xb4\x48\x96\x85\x52\x35\xd3\x76\x59\x75\x6d\x9e\xc7\x42\xb3\xc8\x51\x2e\x0a\x70\x85\x2f\xd7\xc0\xd5\x0d\x1d\x53\x02\x94\x0e\x04\x7a\xb4\xa9\xd4\x9b\x8d\x1c\x5a\xda\x80\x1b\x3d\x91\xd3\x93\x70\x5a\x1a\x99\x55\x2b\xfa\xca\x79\xa6\x3d\xe5\xc3\x50\x75\x83\xc1\x06\xb9\xb5\xa8\xbd\x5a\x81\x36\x1e\x58\x88\xde\x60\xc1\x7f\x6a\x2e\xcb\x17\x7b\x9a\xab\x9f\x65\x9f\x65\x2a\x3d\x8a\x96\xbd\x3e\x2a\x46\xe5\x5b\x48\xce\x3c\x9d\x61\x48\x9d\x36\xd4\xcf\x5a\x66\x59\x13\x00\x6d\xf4\xa9\x46\xbf\x34\x76\x0e\x63\xe3\xbd\x42\x8d\x7c\xde\x0c\xf6\x2b\xe3\xb1\xd8\x09\x17\xa8\xa1\x28\xca\x33\x63\x3d\xb0\x2c\x53\x41\x14\x65\x32\xcf\x94\xa2\x82\xb0\x60\x4a\x8a\xa2\x64\xdf\x25\x67\xb7\x5b\x73\x1a\xa9\x95\xb0\x2c\x4b\x54\x01\x66\xa7\x97\xc4\xd7\x1d\x5c\xab\x5e\xec\x20\x2e\xd2\x71\x43\xff\x3f\x73\xa6\xbd\xfc\x5e\xd4\x76\xb7\x72\x1e\x53\xf8\x5b\x4e\x26\x12\x09\xe9\x17\x4d\x35\x16\x2e\x25\xb7\xc6\x21\x37\x5a\xb4\x0b\x9e\x37\x8f\x4c\xba\xfd\x0e\x5d\xcf\x51\xb1\x15\x0a\xa0\x84\xf5\xf4\x8a\xb2\x52\x47\xd2\x97\xf1\xf9\x23\xf5\x8d\xb4\xb8\x8c\xa2\x76\x61\x2e\x9c\x1d\x2e\xd9\x9d\x4c\xf3\x14\x22\x9c\x86\x32\x16\xc9\xef\xcd\x54\xb6\x71\x92\x40\x36\x38\xd3\x30\x46\x70\x29\x53\x8a\xe2\x73\xc6\x74\x08\xb7\x4d\xca\x87\xcb\x28\x0a\xa1\xb5\x60\x56\x9a\x9c\x9c\x92\xb9\xa2\xd2\x94\x48\xcf\x56\x1e\xeb\x10\x53\xe7\x12\xce\xf8\x6c\x9f\x7c\xd2\x85\xa6\x42\x61\xc6\x21\xe8\x05\xe5\x8a\x00\xc7\xc9\xef\x58\xd0\x75\x52\xd1\x62\x4a\x58\x66\xc6\x35\xcf\xe7\x4b\xc9\x0f\xbd\x95\xd3\x29\x5a\x10\x9b\x13\x7d\x40\x6d\x0a\xec\xd4\xb9\x7f\x70\x3a\x5f\x34\xe3\xf3\x8e\x68\xdf\x10\xc1\x12\x89\x83\x31\xfa\x25\xa2\xa6\xe4\xdb\xd3\x77\x3e\xe4\x33\xfa\x9c\x6b\xd6\x00\xd3\xe7\x81\xac\x50\x96\xa0\x53\x20\xe4\x37\x32\xc3\x0d\x49\xde\x20\x2a\x8f\xdd\xb5\x73\xd8\x9b\x37\xbf\xff\x56\x83\x9a\x91\x9e\xbe\x45\xb6\xba\xce\x28\xea\x86\x14\x71\x63\x71\x6c\x88\x7e\x56\xa7\x93\x32\x3b\x27\x8e\xd2\x1f\x7c\x1a\x9e\x53\xda\x76\x64\xc1\xb1\x32\xed\x4c\x75\x08\x4c\x2e\x28\xba\x0f\xa4\xcf\xc6\xf9\x3d\x00\xb9\x0a\x91\x32\xce\x13\x9e\xd0\xb4\x50\x65\x0a\x87\x0f\x33\xcc\xad\x74\x5e\xf2\x9f\x81\x8e\x74\xd8\x07\x5b\x99\x68\x1f\x03\x6f\xd3\x26\x78\x6c\xd6\xe3\x43\x40\x29\xe5\xed\x83\xe6\x63\xe1\xa7\x9d\x3c\xae\xa2\x0a\xa1\xd7\xd0\x66\xf9\xe1\xc3\x87\x0f\x00\xb7\x94\xd9\x26\x12\x95\x00\xea\x4a\x15\x5b\x39\x90\xfe\xc3\xe6\xec\x99\xf3\xe7\xcc\xb3\x08\x75\xdb\x07\x28\xdb\x83\x93\x9a\x23\x28\xe2\xb4\x81\xa1\x56\xee\xbd\x64\x2e\xd0\xd4\x87\x6a\xc1\xbe\x45\x40\x39\x2d\xa8\x25\xd9\xe9\xa9\xcc\xf9\x3e\x9f\xef\xa5\x2c\x95\xab\x4a\x47\x38\xba\x32\x1e\x64\x9a\xa9\x50\xce\x51\x1c\x37\xb4\xbe\xa1\xc6\x46\x07\xfb\x57\xc3\x0e\x18\xe7\x3e\x70\x25\x54\x0e\x97\x33\xb4\x41\x3b\x3a\xf1\x79\xd0\x7a\x0b\xa8\xa6\x61\x47\xc8\x17\x8f\x37\x6c\x49\x10\x9b\xee\xf7\x63\xc6\xb5\x7c\xb1\x36\xee\x8f\x25\xf2\xd2\xee\x7b\x61\xa9\xec\xfe\x94\x10\xa8\x14\x79\xe7\x59\x9a\xed\xf2\x90\x9b\xcb\xf8\xcb\xd6\x02\x7a\x71\x03\x71\x9d\x76\x91\xd0\x32\x8e\xa5\x83\x8c\xf9\x59\xbb\x1a\x36\x62\xf7\xe5\xcb\x77\x2f\x4f\xc2\xa7\xd7\x6f\x5f\x95\x9f\xde\xbe\x7a\xd1\xee\xde\x53\x9f\x27\xdc\x98\xb9\x6c\x0d\x4c\x76\xd8\x7a\xc4\x17\x91\x8b\x67\x16\xdd\x6c\x2b\xaf\x29\xdb\x8b\x81\x62\x69\xd6\x9a\x8a\x94\xad\xc5\x3a\x25\x91\xa1\xd9\xc2\x48\x01\x4c\x51\xfb\x11\xb2\x17\xde\x85\x06\x60\x81\xd5\x39\xc1\x38\x9f\x4c\xd0\xee\xe0\x03\xce\xf9\xa0\xd9\x6e\xce\x1b\xb7\x53\x6e\x6a\xa8\x3f\x17\x30\x32\xb9\x16\x10\x5b\x99\x15\xce\x73\x34\x8a\xe3\x66\x40\xc6\x33\x84\xcf\xb4\xf1\x26\x6a\x0b\xba\x2e\x64\x50\x73\x43\x7b\xa8\xd7\x11\xcc\x8a\xad\x4e\xd4\xcc\xbe\xaf\xde\xbd\xad\x97\x49\xeb\x7d\x92\xbb\x3d\x00\x7d\x65\xb6\xcd\xe3\xe3\x38\xf0\x40\xa6\x79\x93\x58\xfe\x34\x04\xa9\xc0\xc5\x1e\x08\x22\x2d\xb6\xfa\x55\xa4\xcc\x12\x22\xcf\xac\x87\x62\x85\x51\xcd\xb8\xfd\xca\x54\x8e\xd5\x84\x51\xd5\xfb\x50\xea\xc8\x76\xcc\x2d\x77\x86\xd5\x6f\x6f\xdf\xbc\x6c\xb4\xe0\xfb\xba\x5a\xa4\xc5\x60\xa9\xdb\x8c\x6c\xb0\xd1\xa7\x08\x97\xff\x34\x20\xbe\xd4\x3b\x7b\xc5\xbe\xe8\xec\x00\xfa\x62\x81\xd6\x4b\x57\x74\x1f\xdb\x43\x94\x89\x45\xc5\xd8\x1f\xe4\x44\xc6\x0a\xb4\x52\x4f\x77\xb7\x1a\x76\xbd\x16\x84\x24\x47\x0d\x7e\xde\xa6\x38\x1b\x32\xb3\x5e\xbf\xbb\xd9\xe9\xca\x12\xeb\xfc\x15\x49\x81\x21\xbe\xe8\x0c\xd2\xe2\x4a\x61\x77\x95\xa0\x68\x46\xe7\x7b\x7b\x46\x35\x5f\x44\x19\xe3\xed\xf9\x4d\xf8\x36\x4c\x3b\x83\x15\x2a\xae\x57\xe5\xca\x6f\x39\xe6\xad\x78\x5f\x65\x92\x87\x8b\x8c\x3c\x13\xa1\x51\x1c\xaf\x36\x83\x1e\x47\x68\x58\xee\xcd\xa9\xcf\xb5\xd4\xd3\xed\x67\xe8\x82\x68\xa9\x09\xce\xb7\x64\xfd\xd7\x43\x30\x62\xe3\x99\xda\xc6\x74\xc3\x8f\xa0\xdb\x2d\x17\x39\x35\x93\xa4\xcc\x7d\xca\x1b\xd8\xc8\x33\x80\xe8\xf2\xc2\xaf\x32\xa4\x48\x0a\xc3\xe1\x5f\x5f\xd5\x6f\x05\x68\xd7\x6a\xa2\xbe\xb3\x28\x33\x2e\xf5\x74\xd4\x75\x65\x52\x55\xb4\x62\x09\xd0\x9a\x93\xda\x9d\x50\xcd\x94\xed\x70\x6c\xd8\x10\x32\xb2\x73\xf0\x8a\xba\x39\xe7\x49\x16\xf6\x4e\x6c\xc7\xe5\x45\xa3\xf6\x5e\xb2\xbb\x07\x74\x8d\xd0\x7b\x36\x56\x08\xc5\x86\xc5\x7c\x8a\x77\xd4\xe0\x08\x3d\x2c\xa5\x9f\x81\xdb\xdc\xa2\x41\xaf\x17\x5d\x27\x97\xfd\x7f\x25\x37\xfd\xc1\xc5\xd5\x1f\xc9\xa8\x1f\x0f\x7b\x3d\x38\xde\x17\x45\xca\xee\x1e\x81\x24\xec\xd5\xef\x6c\x55\xa9\x30\x6d\xdc\x21\x50\xcf\x71\x90\x4c\x5e\xbe\x9c\x49\x3e\x03\x9e\xa7\xb9\x62\xe1\x5e\x63\x33\xa2\xae\x42\x1d\x8a\x3b\x8d\x31\xb5\xeb\x35\x92\xd7\x74\x97\x37\xaf\xb7\xfb\x78\x90\x97\x84\x06\x75\x97\xef\x84\x47\xcb\xa4\xf0\x43\x58\x9e\x48\xd9\xea\xe1\x9d\xe5\x08\xa7\xee\x3a\xef\x68\x4f\xee\x69\xba\x0e\xc2\xed\xad\xe6\x45\x21\xc4\x15\xa8\x98\x16\x90\xe5\x16\xab\x99\x4d\x67\x70\x6e\x4f\xcb\x0e\xa7\xfb\x4d\x37\x70\xea\x2e\xf4\xbe\xca\x6f\xa1\xf8\x4f\xaf\x79\xd0\xfa\x41\xc5\xaf\x8c\xa7\x06\x2e\x9c\xdd\x03\xf3\xa6\xc2\x39\x42\xfa\x16\x55\x3b\xe7\x50\x8b\x92\xfd\xd6\xae\xec\xa8\xf3\x0b\x5e\x53\xf6\xb8\x5b\x9c\xc3\xf3\x4c\x26\xba\x10\x9e\x84\xdd\x8f\x8e\x9b\x97\xaa\x3d\xbe\x49\x30\x52\x77\x15\xbd\x4b\xa9\x43\xd9\x1d\xc5\x71\xf3\xa2\x98\x48\x22\xd3\x60\x94\x40\x7b\x02\x99\xc5\xd3\xb3\xb3\x51\x17\x11\xd9\x52\x14\x3d\xcf\x92\x54\x6a\x2a\x8c\x0f\xdf\xdc\x16\x53\x80\xce\xe3\xbf\xd0\x59\xee\x6b\x85\x83\x59\xbb\x0a\x8c\x80\xce\xf7\x48\xa1\xfe\xbf\x17\xc7\x8f\x3f\x59\x7a\x3a\xe9\x38\xde\xed\xaa\x75\xc6\x55\xad\x70\x1d\x4e\xc3\x8e\x5b\xd8\x86\x8a\xa8\xa8\xce\xaf\x3a\x0b\xc7\x75\xc5\xa6\x2a\x7a\x55\xad\x0e\xf5\x6e\xaf\x02\x40\xc7\xc8\x4d\x9a\xe5\x1e\x13\x51\x3e\x1d\xea\xc0\x83\xee\x76\x96\xbb\x15\xb5\x58\xdd\x4d\x7b\x28\x51\x26\xf7\xa1\xff\x20\x6b\x1d\xe5\xba\x7e\x23\x79\x5c\x31\x81\x7b\x34\x27\x3c\x39\x2b\x47\xb5\xb9\x66\xc5\x8c\xe4\x5b\xce\x54\x98\xfe\x6b\xd1\xd3\x78\xe7\x77\xe4\xd8\x07\x9c\x75\x8a\x3e\x91\x7a\x62\x12\x3e\xb3\x46\x9b\xf0\xd2\xc1\xc3\x41\x35\xba\xd5\x62\xdb\xc5\x52\x31\x9d\xc8\x28\xc4\x97\x4c\xae\x07\x77\x6b\x5e\xb6\xac\x5a\x83\x9f\xa6\x6d\xa4\xc5\x59\x3e\x79\xa4\xbe\xe5\x5d\x68\x99\xa5\x02\x29\xec\xba\x29\x34\x5a\xad\x2a\x27\x75\x21\xb9\xf9\xf5\x71\xc5\x83\x1b\xb8\xf7\x86\x45\xf1\xfe\x88\x0d\xfd\xe7\x9a\xe5\xd2\x89\x9f\x84\xd1\x17\x3d\x5d\xbf\x27\x9b\x31\x57\x26\x44\x6f\xb2\x8c\x38\x19\x72\x96\x3b\x0c\xdb\xd0\xe2\x52\x39\xe9\x60\x92\x2b\x15\xf2\x3e\x67\xba\x4c\xa4\x30\xb5\x66\xa9\x0b\x2c\x26\xc5\xf2\xd2\xa4\xf7\x33\x0d\x5f\x06\x5d\x87\xd1\xcf\x6b\xe3\x37\x07\xa2\x5a\x17\xae\x4c\x36\xac\xdf\x96\x96\xbd\x4f\x98\x5b\xc3\x6e\x2a\x8b\x99\xb1\xeb\x06\xc0\xe7\x36\x70\x6c\x2a\x7f\x27\xeb\xbb\xe0\xe1\xe0\xea\x07\xf2\xd1\x5a\xb3\x1d\xd5\x70\x0d\x75\x30\x6c\xbf\x06\x32\x18\x56\x93\x6e\xf1\xdf\x86\x3b\xd9\xdd\x0b\x85\x1c\xda\x39\x20\xbe\x61\x2b\x65\x98\x28\x39\x40\x31\x16\xc6\xbb\x32\x56\x66\xc8\x04\x5a\x77\xb2\x89\x9e\xe6\xfb\x48\x3f\xc4\x1a\x03\x79\x68\x50\xd9\xee\x36\xad\xc8\xfd\x0f\xdd\x3d\x5c\xb2\x75\x6c\x57\xea\x96\xd7\xfe\xcb\xe2\x24\xa9\xea\x49\x14\x45\x5e\x67\x0d\x00\x70\x54\x0e\x3a\x35\x4c\x94\x59\xba\xe3\x5d\xb1\xb7\x8d\x06\x87\x4d\x37\x9e\x16\x31\x3e\x3f\xcf\xb3\x36\xa0\xf3\xbc\xc8\x1d\x58\xe7\x8b\x1b\x07\x39\x8f\xfa\x83\x4f\xed\xbb\xd8\x7b\x6b\x42\xa6\xb8\x8e\xf6\x77\x98\xc6\x10\xe6\xd5\xdb\xb7\xf5\x37\x15\x84\x63\x7c\x9e\x88\x3c\x73\xf7\x47\x21\x11\x62\x9b\xf3\x54\x2d\x47\xf0\xdf\x82\x17\x2e\xd1\x22\xd5\x4b\x22\x92\x61\xca\xd1\x50\x7f\x58\x0e\x2a\x5c\x7d\x0a\x62\x74\x19\x4b\x14\x0f\xd5\x8c\xf9\x91\xfe\x1f\xb6\x4b\x1c\xa2\xde\xbc\x1d\x95\xfb\xeb\xc9\x35\x09\xd9\xae\xb9\xc9\xfd\xa9\x99\x9c\x06\x55\xd6\x87\xd0\x34\xf9\x75\x0c\x17\x57\xc5\xcb\x99\x2b\xec\x2a\xdb\xbb\x74\xe3\x8b\xc4\x18\x93\x35\x2e\x15\xba\x9b\x0b\x2a\x62\xc5\x30\xae\x1d\x9d\x88\xf6\x7f\x1c\xb0\xcd\xa4\xab\x1a\xb6\x54\x6f\x33\x4e\x3c\xc1\xe0\x4c\x15\xe3\x93\x87\x51\x6c\x1b\xae\x68\x91\x3c\x30\x86\xbb\xc4\xb4\xeb\xd5\xd8\xfb\xd2\x1e\xb6\xd1\x3d\x2f\xdc\x48\xae\xb6\xee\x8d\x52\x4c\x0f\xb9\xff\xed\x81\xf7\xff\x78\xe0\xfd\xe3\x03\xed\x1f\x19\x3e\x47\x7f\x79\xe0\xcd\xc3\xf1\xf6\x95\x32\xfc\xc0\x62\xf8\x62\x9c\xb7\x5e\xf1\x7c\x5a\x19\xb7\x3f\x07\x4a\xa4\xc5\xc1\xa1\x7c\x5c\x8a\x9f\x80\x84\x0c\xf6\x67\x18\x2d\x1c\x56\xce\x75\xe6\x0f\x1d\x24\xe1\x25\x62\x65\x5a\x17\x04\x4f\x2b\xe4\xdc\x9a\x36\x71\x78\x0a\x11\x5f\x71\xca\xdc\xa1\x32\xf9\x7a\xf3\xde\x50\xb3\xb1\x3a\xcc\x69\x6f\x84\x8c\xe2\x38\x3c\x76\x70\x29\x87\x15\xd0\x3d\xf9\x7a\x0a\x19\xe7\x83\x2d\xff\xd1\xf2\xa4\x9b\x1f\xf2\xb0\x37\x42\x06\xc3\xce\xff\x2c\x79\x5a\x21\x7d\x95\xcd\xd8\x81\x45\x9c\x0d\x79\x8b\x53\x3f\xb5\x88\xd8\x1c\x24\x28\xce\xce\x46\x87\xf2\xa6\x72\xeb\xde\xd9\xed\x21\x77\x3f\x5c\xa8\x55\x12\x8a\x4b\xb2\x3f\x98\x3c\xc8\x19\x57\x52\x06\x4b\x2d\x0e\x25\xe3\xd9\xbf\x03\x00\x00\xff\xff\xcb\x9e\xe2\x61\x06\x37\x00\x00")
+var _tcprowYaml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xd5\x5b\xdd\x73\xdb\x36\x12\x7f\xcf\x5f\x81\xc9\xcb\xd9\x73\xb6\x1c\xbb\x69\xea\xe4\x66\xae\x23\xcb\x4a\xeb\x69\x6c\xb9\xa6\x12\x5f\x9f\x38\x10\x09\x49\x38\x53\x00\x03\x80\x92\xd5\xbf\xfe\x76\x17\x24\x45\x93\xd4\x87\x53\x2b\x9d\xcb\xe4\x41\xa2\xf0\xb1\xdf\xfb\xdb\x5d\x3a\x50\x3c\xb5\x53\xed\x6e\x75\x22\xa3\xe5\x87\x57\x8c\x5d\x0a\x1b\x19\x99\x3a\xa9\xd5\x07\xf6\xab\x5e\x30\x37\x15\x2c\xc8\x97\x59\x26\x15\x3c\x90\x96\x19\xf8\x65\x21\x8c\x60\x56\x24\x22\x72\x22\x66\x63\xa3\x67\x8c\x27\x09\xb3\xe5\x62\x3d\xa6\xdd\x91\x56\x0a\xd6\xc0\x89\x9d\x57\xc1\x93\x0b\x3b\x6b\xee\x1d\xc2\xae\xe2\x18\x96\xd2\x1a\xc6\xd3\x34\x91\x70\xcf\x68\x49\x87\xa6\xdc\x58\x61\x8e\x98\xe8\x4c\x3a\xec\xb5\x98\x0b\xb3\xfc\x70\xfa\xe6\x35\xd3\x86\xbd\x8e\xa6\x5c\x4d\x84\xfd\xe7\x8c\x3f\x8e\x96\x4e\xd8\x0f\x3f\xbe\xa1\x7f\xaf\x1b\xf7\x5f\x1a\x9d\xa6\x22\x6e\x25\x40\x65\xb3\x91\x30\xc8\x44\x85\xa3\x99\x74\x25\xb3\x2b\xa9\x14\x34\xf9\x43\x5f\x0d\x7b\xb7\x57\x6a\xac\x1b\xa7\xde\x09\x9b\x25\xb0\x9c\x76\x4f\x84\xb3\x3a\x7a\xd0\xa9\x3b\xe8\x74\x60\x47\x78\x75\xf3\x71\xd0\xe9\x1c\x16\xbb\x3b\x81\xe3\x4e\x34\x29\xeb\xdd\x32\xfa\x05\x7f\x90\x36\xca\xac\xa5\xe7\x57\x8a\x5d\x7f\xe2\x23\x16\x73\xc7\x69\x91\xc5\x45\x0c\x54\xa5\x80\x68\x05\x8a\x59\xb2\x53\x76\xd0\x87\xc7\xa3\x44\xda\xa9\x88\x0f\x3b\x70\x04\x63\x03\xa0\xdc\xb0\x39\x4f\x32\x01\x6a\x15\x63\x54\x27\x73\x86\x2b\x2b\x85\x72\xfe\x18\xcb\xa6\x7c\x2e\xd5\x04\xd4\x1f\xe9\x59\x9a\x08\x38\x19\x2c\xc0\xe2\x09\x77\x62\x0c\x76\xa0\x22\x01\xfc\x7d\xec\xb1\x9f\xde\x9f\xc2\xc3\xdf\x84\x51\x22\xf9\xc0\x02\x21\x90\x98\xb0\x1f\x0c\xbb\x17\x9f\xae\x82\x5f\xfb\x97\x68\x42\x70\x4c\x92\xc5\xe2\x44\x09\x77\xe2\xa2\x34\xf4\x97\x74\xa6\x25\xef\xbd\x6e\x3b\xf7\x9f\xb4\x45\x22\x23\x8d\xfa\xce\x59\x9c\xf1\x68\x2a\x55\x5d\x1e\x1f\xc1\x10\x80\x8b\x58\xe2\x46\x9e\xb0\x04\x77\x8e\xb8\x05\xe5\x81\x3d\x82\x75\xe0\x73\xfc\xe8\x8c\x4e\xc0\x6e\x27\xda\x48\x37\x9d\xd9\x23\x96\xdf\x0d\xa2\x23\xf9\xf0\xc4\x6a\x96\xe1\x3e\xa7\xcb\xf5\x0b\xa9\x62\xf0\x00\x1e\xff\x37\xb3\x6e\x06\x72\xaa\x8b\x82\xf5\xf4\x8c\x9e\x23\xbb\xc8\xa6\x4c\xe7\x6f\x89\x57\xa9\xd2\xcc\x75\xa2\x8a\x90\x48\x02\xc2\x85\x11\x0f\x73\xa5\x35\x24\x54\x11\xcd\x9d\x20\xe5\x80\x21\xda\x86\x78\x6e\x4a\x93\x75\x72\x26\x74\x06\xd7\x1f\xdc\x0d\x07\x39\xdf\xa6\xd8\x49\x22\xb2\x87\x8c\x3b\xef\xcc\x56\x7c\xcd\x90\xec\x4e\x4d\x86\x60\xaf\xc2\x21\xdb\x7f\x0a\xa3\x19\x88\x6b\xac\xcd\x82\x9b\x98\xa5\x46\x4f\x8c\xb0\xb6\xc2\x84\x8c\xec\x43\x68\x56\xb4\xd5\x99\x00\x0d\x01\x87\x65\x24\x08\xd1\xf6\x2b\x5c\xdd\x1a\x3d\x12\x4d\x86\x7a\x40\xa7\x88\x32\x27\xe7\xc2\x13\x91\x0b\x3e\xa5\xe5\x40\x3d\xb0\x00\xa6\x29\xd8\x44\x2b\xc1\x32\x05\x97\x63\x54\x8a\xb7\xd9\x25\x51\xeb\x0f\x09\x41\x4c\xcf\x24\xf6\x82\x83\xdf\x8e\xc7\x0d\x6a\xfb\x8f\x29\x90\xa1\x9c\x04\x7b\xcb\x15\x00\xa2\xa7\xb5\x60\x39\x99\x72\xc2\x34\xbc\x36\x32\x02\xed\x04\xa5\x0b\x9a\x3a\x02\x25\xa1\xcc\xe1\x9b\xcd\xa2\x08\x44\x3c\xce\x12\xf8\x61\xc8\x66\x82\xdb\xcc\xaf\x25\x5b\x7b\xc2\x49\x71\xc9\xf3\xd8\x18\x10\xd9\x4d\xa1\x5f\x48\xc7\x40\x70\x3a\x06\x9b\x09\xfe\xb8\x61\xda\xaf\x63\x5c\xc5\x4c\x53\xb4\x50\x62\xa2\x81\x4b\x7a\x5c\xe3\xe8\x35\x39\xcd\xf0\xea\x1a\x5d\xfe\xfa\x36\x60\x6f\x1e\x4f\xff\x45\xcf\x82\x6e\xef\x37\xf8\x76\xe6\xbf\xdd\x07\xbd\xee\xa7\x3e\x7c\x7f\xeb\xbf\xf7\x7b\x37\xf0\xe5\x9c\x1d\xb3\x7b\x6e\xcb\x0b\x44\x5c\xfe\x1a\x06\xfd\xfe\x0d\xfc\xdc\x75\x2c\x01\x59\xa0\x8c\x04\x3c\x1f\x82\xf5\x0a\x95\xdf\xf0\xc7\x4d\x78\xd9\x1d\x76\x61\x15\x7c\x3c\xc6\xfb\x40\x30\x4a\x2f\x12\x11\x4f\x80\x19\x8a\x8d\x20\x23\x64\xca\x92\xd0\x0d\x33\xd1\x3c\x7e\x5d\x91\x27\x0a\x27\x1c\xdc\x0e\xc3\x0a\x0b\x15\xb1\x66\x3c\x95\x27\x89\x54\xd9\x63\xcd\x2d\xef\x83\x88\x27\xcd\x80\x75\xf1\xf9\x17\x34\xe2\x71\x42\xc2\x42\xcf\x0c\x54\xec\xd7\x92\x3c\xef\xa2\xb9\xff\x56\x13\x23\x06\xce\x09\x04\xa4\x6c\xd4\x81\x88\x7b\x32\x3b\x4e\xf8\xe8\x44\xb8\xe4\x04\x9c\x17\x02\xf5\xc9\x4f\xef\xdf\xac\x12\x45\x71\x62\xe3\xf6\x7b\xef\x2d\x96\xae\xa3\x18\x96\x67\xaa\x44\xc3\x23\x94\x41\x0c\xda\x04\x07\x8f\x05\xaa\x1b\x1e\x4c\x3a\x0b\x15\x93\x30\xbf\x48\x2b\x47\x48\xa5\x65\xfe\xf4\x23\x96\xc2\x7a\xcc\x02\xdb\x08\x6b\x3a\xdf\x0f\x67\x3f\x54\x64\x6c\x55\x1c\x2e\x3c\x51\x15\xd1\xb6\x49\xb5\x14\xcf\x73\x59\x83\x1c\x21\x20\x68\x10\x73\xde\x96\x2b\xcc\x55\x05\x3d\xc4\x00\x08\xff\x63\xc8\x69\x06\x12\xe5\xea\x20\x80\x17\x78\x00\xf8\xcf\x58\x4e\x8e\x48\x5b\x4a\x70\x03\x79\x14\x1e\x41\xa0\x06\xfb\x81\x78\x48\x59\x97\x04\xd6\xcb\x0c\xb0\xec\xe0\x77\x05\xa8\x85\x93\xf7\x92\x04\xff\xaa\xb8\xc0\x44\x77\x14\x57\x37\x4d\x3f\x49\x88\xbe\x2d\x88\xe6\x63\xc2\x31\x7d\xc7\x32\x02\x4b\x04\x1d\x52\xe8\x34\x94\x3f\x2b\x91\xa5\x04\x00\x4a\xab\x63\x88\x1e\x0b\x6d\x1e\xd8\x48\x3b\x97\x08\x08\x22\x0f\x75\x67\xbf\xd1\xb0\x9f\x4e\x02\x00\xa6\x98\x4f\xca\x53\x6d\x9c\x47\x6b\x91\x37\x7a\x90\x55\x92\x60\x42\x00\x90\x21\x63\x9f\xb2\x1f\xc3\x8b\xfb\xb5\x31\x0d\xc9\x0a\xe1\x84\x30\xf1\xcc\x6c\xb5\x92\xe1\xa0\x05\x6b\x55\x93\x1d\x1b\xfa\x70\x5c\xa3\xff\xf7\x0c\xb4\x28\xff\xf4\xb9\xdd\x2e\xad\x13\x33\xf6\x5f\x39\x1e\x4b\x81\x9c\x7e\x56\x98\x63\xd9\xb5\x8c\x8c\x86\x2c\xa4\x55\xdc\x4c\x78\xb0\xef\x79\x41\xb7\xdb\x42\xeb\xa5\x48\xf8\x12\x88\xc0\x80\xf5\xf2\x84\xf2\x9c\x46\xa4\x17\xc2\xe1\x33\xe9\x85\xe0\x72\x1d\x04\xcd\xc4\xec\x8d\x9d\x5d\xf3\x47\x39\xcb\x00\x0b\x8b\x09\xa5\xb1\x00\x88\x5c\x6b\x24\x04\x36\x22\xae\xd8\x08\xbc\x6b\x06\x46\x81\xfe\x09\x58\x9d\xdc\x6d\x15\xf2\x19\x5c\x48\xae\x35\xe7\x46\xea\x0c\x8d\x92\x5b\x9f\x69\x72\x4e\x2f\x10\xd5\x57\x58\x9c\x59\x0b\xe8\x29\x9a\xee\x12\x4f\xda\xb8\x29\xb8\xd0\x23\x72\xfa\x18\x63\x05\xb1\x63\x81\x1d\x0f\xd7\x91\x44\x30\x55\xe4\x65\xaa\x6d\x5d\x3f\x9f\x73\x7c\xe8\x8c\x9c\x4c\x80\xab\x78\xa5\xd1\x0d\x64\xa3\x63\x03\xe9\x7f\x41\x3b\x9f\x15\xec\x69\xf1\xf6\x15\x10\xcc\x39\x01\xec\x0b\xde\x0c\x99\x12\x83\x6f\x47\x3d\x3a\x8a\x67\xf8\x19\x40\x53\x8d\x99\x6e\x44\x60\x05\xa3\x04\x6a\x01\x39\xbf\x95\xa9\x58\x81\xe4\x15\x47\xb9\xda\x6d\x33\x86\xbd\x7b\xf7\xd3\x8f\x15\x56\x53\xa4\xd3\x35\xc0\x56\x9b\x8e\x82\x76\x96\x82\x48\x1b\x31\xd2\x08\x3f\x0b\xed\xcc\xb8\x79\x40\x8c\x02\x52\x86\xba\x02\xc2\xb6\x45\x09\x8e\x20\x03\x34\x22\xd5\x3e\x78\xb2\x44\xe8\x2e\x2c\x41\xd9\xe2\x76\x60\xc8\x16\x1c\x41\xb1\xe2\x90\x1f\x2a\x5a\x30\x33\x91\xf2\xd9\x54\x64\x46\x42\xe1\x12\x7d\x0f\xee\x90\x86\x5d\x78\xcb\x03\xed\x73\xd8\x5b\x95\x09\x4e\xc4\xdf\x81\x95\xfc\xbe\x5d\xb8\xf9\xe8\xed\xb4\x15\xc7\x15\x50\x81\x6a\x0d\x40\x95\x3f\xc3\x3f\x00\xb2\x18\xd9\x20\x10\x27\x00\x8e\x21\x01\x82\xdf\xc3\x22\xf7\xf3\x4a\xf7\x80\x55\x2f\x01\x78\x06\x40\x6a\xb3\x9a\x87\x68\x0f\x41\x06\x08\x67\x09\x62\x5a\x42\xa8\x85\x79\x2f\xb8\x25\x98\xba\x29\x17\xec\x9a\x04\x12\x70\x75\x2c\x49\xb6\x5a\x2a\x50\xd1\x8d\x1e\x76\x22\x16\xd3\x55\x41\x23\x3b\x80\x30\xcf\x24\xf6\x06\x90\x76\x11\x1f\xd6\xa8\xbe\xc5\xc2\x46\x91\xfc\x8b\x66\x07\x1b\x65\x8e\xb0\x92\x48\xac\x58\x4c\xb1\x9b\x24\x7d\x2e\x78\x20\xaa\xd7\x30\x55\x17\xec\x9d\x88\xe6\xcf\x17\x6c\x0e\x10\xe3\x17\x11\x2e\x04\xf2\x52\xb8\xdf\x16\xc8\x73\xb9\xef\xc4\x4b\x21\xf7\x97\x64\x01\x53\x91\x03\xa0\x36\x4b\xb7\x59\xc8\xed\xf5\xf0\xf3\xda\x04\x7a\x75\xcb\x86\x55\xd8\x85\x97\xe6\x7e\x0c\x8e\x93\x72\x37\x6d\x66\xc3\x9a\xef\x9e\x9e\xbe\x3f\x3d\xa2\x4f\x6f\xcf\xcf\xf2\x4f\xe7\x67\x6f\x9a\xd5\xfb\xcc\x65\x20\x50\xfd\x20\xc5\x33\x65\x0d\x20\x20\xb0\xc3\x29\x18\xe4\x74\x2d\xae\xc9\xcb\x8b\x5e\x02\x12\x69\x74\x45\xf2\xd2\xa2\x0c\x49\x28\x68\x3e\xd7\x32\xc6\xfe\xa7\xce\x01\xb6\x78\xa4\x02\x60\x2e\x0a\x3d\x81\xb9\x8f\x81\xd3\x2d\x78\xc0\x5a\x47\x94\x6d\xc7\xbc\xc3\x66\xc8\x9d\x69\xac\xcf\xa1\xaa\x84\x10\x1a\x83\x26\x64\xea\x8d\xe7\x00\x56\x1f\x36\x0a\x1f\xc1\x3e\xe1\xc1\x2b\xaf\xf5\x70\x3d\x96\x44\xe6\x0a\xf6\x60\xad\x13\x43\x1c\x5f\x6b\x44\xf5\xe8\x7b\xf6\xfe\xbc\x9a\x26\x8d\x73\x61\x66\x77\x60\xe8\x0b\x37\x4d\x1c\x3f\x1c\x12\x0e\xe4\x70\xfc\xdf\xc5\xc1\x2c\x16\xf3\x1d\x38\x00\xa8\xbc\xd6\xae\x82\x04\xac\x29\x70\x1c\x4a\x23\xbf\x42\x27\x75\xbf\xfd\x82\x2d\xd8\xa2\xc3\x98\x54\xeb\xd0\xbc\xc3\xbe\xa9\x6f\xb9\xd5\xad\x7e\x3c\x7f\x77\x5a\x2b\xc1\x77\x35\x35\xe0\xab\x07\x85\x73\x5b\x73\xae\xa0\xc7\xbb\xcb\xdf\xcd\x50\x04\x54\x6e\x2d\x91\xe3\xd6\x0a\x00\x1e\x0b\xe3\xa4\xf5\xd5\xc7\x7a\x17\xe5\xf1\xbc\x40\xec\x1b\x31\x91\x36\xb1\x30\x10\x06\xb6\x97\x1a\xa6\x5c\x0b\x76\x8b\x86\x4a\x76\xde\x84\x38\x2b\x30\x53\xae\xdf\x5e\xec\xb4\x45\x89\x32\x7e\x05\x32\x16\xe4\x5f\xa8\x83\x99\x1f\x29\x6c\xcf\x12\xe8\xcd\xb0\xa1\xb3\xa3\x57\x43\xac\x05\xec\xdf\xec\xdf\xd0\x53\xea\x76\x92\x14\x0a\xac\x57\xc4\xca\xaf\x99\xc8\x1a\xfe\xbe\x4c\x65\x44\x83\x8c\x2c\x8d\xa9\x50\x04\x83\x2a\x1b\x3d\x16\xb9\xe1\x99\xd3\xc7\x2e\x53\x20\x9d\xf5\x3a\xb4\x74\x35\x10\x0e\xec\x7c\x0d\xcb\x6f\x9b\xd8\x18\x6a\xc7\x93\x75\x48\x97\x7e\xac\x8e\x8b\x0a\xb8\x8b\x46\xcd\x25\x12\xf3\x14\xf2\x12\x1a\x81\x53\x82\xeb\x2b\xb7\x4c\x05\x7a\x12\x35\x87\x7f\x38\xab\x4e\x05\xf0\xd4\xa2\xa3\xbe\x35\x29\xf3\x08\x6e\xb9\x6b\x1b\x99\x14\x19\xcd\x2f\x61\xb8\xe6\xa8\x32\x13\xaa\x88\xb2\xe9\x8e\x35\x19\xb2\x14\xe5\x4c\x56\x51\x15\x27\xe4\x62\x3a\x3b\x34\x2d\xc3\x8b\x5a\xee\x05\xf3\xdf\x40\x6b\x20\x1c\x8e\xa7\x70\xba\x47\xc4\xd2\x81\x51\x4b\x0e\x86\x85\x6c\x01\x61\x02\xa8\x29\xa7\x68\xac\xd3\x09\x06\xe1\x75\xf7\x3f\xe1\x6d\xb7\x77\x75\xf3\x4b\x78\xd7\x1d\xf6\x3b\x1d\x76\xb8\x2b\x17\xd8\x95\xda\x9d\x13\x3a\xab\xdb\x5a\xaa\x3e\x9d\x1e\x12\xf4\xa4\x39\x24\x59\xf9\x62\x2a\xa3\x29\x8b\xb2\x59\x86\x3d\x61\x30\xf5\x55\x8b\xba\x70\x75\xe6\x67\x1a\x23\x2c\xd7\x2b\x20\xaf\x6e\x2e\xef\xde\xae\xb7\x71\xba\x2f\xa4\x02\x75\x9b\xed\xd0\xd6\x3c\x28\x7c\x13\x2f\x2f\x44\x6c\xb1\x79\x6b\x3a\x12\x13\x3b\xc8\xdc\xb6\x99\x6d\xe1\x84\xeb\x4b\xcd\x2b\x7f\x89\xf5\x5c\x61\x3f\x24\xcd\xa0\x06\xc9\x7b\x36\xad\xce\xb9\x3e\x2c\xc3\x7d\xbb\x75\x37\x60\xdd\x95\xda\x95\xf8\x35\x10\xff\xe5\x29\x27\xaa\x37\x12\x0e\xf5\x1d\x16\x70\xa4\xbb\x0d\xfd\x26\x6f\x1c\x14\xbe\xe3\xa2\x9c\xc3\x39\x43\x8e\x7e\x2b\x23\x3b\xac\xfc\xc8\x6a\xf2\x1a\x77\x8d\x71\x00\x15\x32\x54\xfe\xf2\x90\x4e\x3f\x38\xac\x0f\x55\x3b\xd1\x2a\xc0\x48\xd5\x96\xf4\xe0\x31\xa5\x5d\xf8\xad\x3e\x28\xa6\xf7\x16\x14\x03\x40\x86\xef\x13\xa4\x46\x1c\x5f\x5c\xdc\xb5\x01\x91\x35\x49\x11\xc7\xb7\x10\x4d\x31\x31\x6e\x9e\xdc\xfa\x2e\x40\xab\xfa\xaf\x70\x28\x5c\x49\x1c\xdc\x98\x25\x21\x02\xd4\xef\x41\x22\xd4\xbf\xdf\x1c\x3e\x5f\xb3\xb8\x3b\x6c\x51\xef\x7a\xd2\x5a\xfd\xaa\x92\xb8\xf6\x47\x61\xcb\x14\xb6\x46\xa2\x48\x30\xcf\x2f\x5b\x13\xc7\xa0\x40\x53\x05\xbc\x2a\x56\x53\xbe\xdb\x29\x01\xa0\x1a\xf1\xe5\x86\xcc\x89\x30\xce\x77\x53\x1e\xd8\x68\x6e\x17\x99\x5d\x62\x89\xd5\x5e\xb4\x53\x8a\xc2\x31\x3c\xd6\x1f\x28\xad\x83\x4c\x55\x27\x92\x87\x05\x12\x78\x02\x73\x68\xe7\x34\x6f\xd5\xc2\x06\xdf\x23\xf9\x9a\xe1\x54\x59\xfb\xfe\xad\x78\x74\x5b\x62\xec\x06\x63\x9d\x40\x75\x2c\x81\xf8\x30\x9a\x1a\xad\x34\xbd\x74\xb0\xd9\xa9\xee\xee\x55\xbc\x6e\xb0\xe4\xbb\x13\x38\x1a\x64\x0b\x2e\xcb\xc6\x5d\x89\xcb\x16\x45\x69\xf0\xdd\xa8\x85\x7a\xe5\x22\x1b\x3f\x93\xde\x7c\x16\x9a\x47\x29\x02\x85\x6d\x93\x42\xad\x00\x33\xc9\x22\xfc\x62\x70\x73\xa5\xba\xf0\xad\x9b\x27\x6f\x58\xf8\xf7\x47\x0c\xd5\x9f\x25\xca\x45\x8d\x1f\x51\xeb\x0b\x77\x57\xe7\x64\x53\x6e\xf3\x80\xe8\xe8\xad\x24\xf8\x12\xf1\xcc\x0a\x3a\x06\x17\xe7\xc4\x01\x19\xe3\x2c\x49\x28\xee\xe3\x34\xc5\x07\x52\x36\x31\x7a\xa1\x3c\x2f\x7a\x26\xf2\xa1\x49\xe7\x7b\x0a\x3e\x77\xba\x16\xa1\x5f\x56\xda\x6f\xd8\xd1\xce\xd7\xd1\xc8\x64\x85\xfa\x4d\x2e\xd9\xa7\x80\xb9\xd1\xec\xc6\xb4\x98\x6a\x53\x16\x00\x2e\x33\x84\xb1\x31\xfd\x1d\x95\xb3\xe0\x7e\xef\xe6\x1b\xe2\x51\x49\xd9\x96\x6c\x58\xb2\xda\xeb\x37\x5f\x03\xe9\xf5\x8b\x4e\x77\xfc\xff\xc6\x77\xb8\xbd\x16\xa2\x18\xda\xda\x20\xbe\xe5\xcb\x44\xf3\x38\xc7\x00\xbe\x2d\x2c\x1e\x73\x5f\x99\x0a\x0e\x0e\x06\x84\x96\xde\x53\x7f\x1f\xe9\x9b\x50\x23\x81\x87\x1a\x94\x6d\x2f\xd3\x7c\xec\xdf\x34\x7b\xb8\xe6\xa5\x6f\x17\xe4\xe6\x63\xff\x85\xd7\x24\x66\x3d\x7c\x07\x91\xe2\x3a\xaf\x31\xc0\x0e\xf2\x46\x27\x38\x61\xa2\x17\xf6\xb0\xf3\x8d\x30\x98\x0e\x5d\x59\x1a\xce\xc3\x2e\xb3\xb4\xc9\x10\x3c\xa4\xd8\x21\xaa\x78\x71\x65\x20\x97\x38\x17\x6b\xce\x62\x9f\xac\xa1\x48\x31\x08\x76\x37\x98\x5a\x13\xe6\xec\xfc\xbc\xfa\xa6\x42\x8c\x23\xb1\x30\x06\x62\x9f\xb6\x42\x02\x88\x6a\xeb\xfa\x10\x7e\x48\xea\x71\x21\xbd\x51\x8a\x48\x00\x80\x24\x75\x39\x6a\xe4\xf7\xf3\x46\x85\xad\x76\x41\xb4\xca\x7d\x09\xfd\xa1\xe8\x31\x3f\xd3\xfe\xe9\xb8\x10\xdf\x24\x5a\xbd\x1d\x95\xb9\xc1\x78\x80\x97\xac\xa7\x1c\x48\x3d\xd6\xe3\x63\x22\xa5\x54\x42\x5d\xe4\x83\x21\xbb\xba\xf1\x2f\x67\x2e\x85\xfb\x06\xda\xa2\x79\xa8\xb5\x4e\x6b\x43\x85\xf6\xe2\x02\x93\x98\x6f\xc6\x35\xbd\x53\x08\xf3\x0f\x8b\x1d\xac\xa2\xd3\x55\x34\x5b\x8a\xb7\x19\xc7\x0e\xd9\x88\x78\xe2\xdb\x27\x9b\xb9\x58\xd7\x5c\xc1\x77\x7b\xd6\xb7\xe1\xae\xc5\xac\xed\xd5\xd8\xa7\xb7\x6d\x96\xd1\x13\x2b\x5c\xdd\x5c\x1c\xdd\xb9\x9b\x89\xd9\x3e\xcf\xbf\xdf\xf3\xf9\x1f\xf7\x7c\xfe\x70\x4f\xe7\x07\x1a\x47\xa7\xd7\x7b\x3e\x9c\xd4\xdb\xc5\x31\xcb\x9e\xaf\x89\xe6\x00\xb7\xf6\x7b\xc7\xfd\xf7\x61\x05\xf0\xf0\xde\x59\xf9\xb8\x88\xbf\x03\x27\x28\xb0\xdf\xa9\xb5\xb0\xdf\x7b\x06\xa9\xdb\xb7\x93\xd0\x4b\xc4\x89\x9e\xec\xf7\x12\xfc\xfb\x06\xbb\x8f\x2b\xbe\x88\x09\xb7\xfb\x8a\xe4\xe5\xe1\x9d\xbe\xc2\x76\x70\xbc\xdf\x4b\xee\x86\x43\xda\xb6\xf7\x5b\xf6\x7b\x41\x7b\xe7\xeb\x25\xee\xb8\xec\xad\xf9\x8b\x96\x17\x3d\x7c\x9f\xca\x5e\x5d\xd2\xeb\xb7\xfe\x65\xc9\xcb\x5e\xd2\x4d\xd2\x29\xdf\xf3\x15\x17\xfd\x48\xed\xfb\x8a\xa1\xde\x8b\x53\x5c\x5c\xdc\xed\xcb\x9a\xf2\xa3\x3b\x17\xf7\xfb\x3c\x7d\x7f\xae\x56\xdc\xe0\x87\x64\xbf\x70\xa9\xf6\x79\x0b\x8e\xf5\xf7\x75\xc7\xab\xff\x01\xaf\x07\xac\x63\x5c\x38\x00\x00")
 
 func tcprowYamlBytes() ([]byte, error) {
 	return bindataRead(
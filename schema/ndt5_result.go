@@ -4,7 +4,9 @@ import (
 	"cloud.google.com/go/bigquery"
 
 	"github.com/m-lab/go/cloud/bqx"
+	"github.com/m-lab/go/rtx"
 	"github.com/m-lab/ndt-server/data"
+	"github.com/m-lab/ndt-server/metadata"
 
 	"github.com/m-lab/etl/row"
 )
@@ -17,6 +19,10 @@ type NDT5ResultRow struct {
 	LogTime   int64           `json:"log_time,int64" bigquery:"log_time"`
 	Result    data.NDT5Result `json:"result" bigquery:"result"`
 
+	// Index is the position of the result within the test file.
+	// NOT part of struct schema.  Used only to derive the insert ID.
+	Index int `json:"-" bigquery:"-"`
+
 	// NOT part of struct schema. Included only to provide a fake annotator interface.
 	row.NullAnnotator `bigquery:"-"`
 }
@@ -34,3 +40,56 @@ func (row *NDT5ResultRow) Schema() (bigquery.Schema, error) {
 	rr := bqx.RemoveRequired(sch)
 	return rr, err
 }
+
+var ndt5Schema bigquery.Schema
+
+func init() {
+	var err error
+	ndt5Schema, err = (&NDT5ResultRow{}).Schema()
+	rtx.Must(err, "Error generating ndt5 schema")
+}
+
+// Save implements bigquery.ValueSaver, providing an insert ID derived from
+// the task file, test, and index, so that retried tasks are deduplicated.
+func (r *NDT5ResultRow) Save() (map[string]bigquery.Value, string, error) {
+	archive := ""
+	if r.ParseInfo != nil {
+		archive = r.ParseInfo.TaskFileName
+	}
+	ss := bigquery.StructSaver{Schema: ndt5Schema, InsertID: row.InsertID(archive, r.TestID, r.Index), Struct: r}
+	return ss.Save()
+}
+
+// Redact implements row.Redactable.
+func (r *NDT5ResultRow) Redact(p *row.PrivacyPolicy) bool {
+	res := &r.Result
+	if p.DropIP(res.ClientIP) || p.DropIP(res.ServerIP) {
+		return false
+	}
+	res.ClientIP = p.TruncateIP(res.ClientIP)
+	if res.C2S != nil {
+		res.C2S.ClientIP = p.TruncateIP(res.C2S.ClientIP)
+	}
+	if res.S2C != nil {
+		res.S2C.ClientIP = p.TruncateIP(res.S2C.ClientIP)
+	}
+	if res.Control != nil {
+		res.Control.ClientMetadata = redactMetadata(p, res.Control.ClientMetadata)
+	}
+	return true
+}
+
+// redactMetadata returns the client metadata that may be kept under the
+// policy.
+func redactMetadata(p *row.PrivacyPolicy, md []metadata.NameValue) []metadata.NameValue {
+	if md == nil {
+		return nil
+	}
+	kept := make([]metadata.NameValue, 0, len(md))
+	for _, nv := range md {
+		if v, ok := p.MetadataValue(nv.Name, nv.Value); ok {
+			kept = append(kept, metadata.NameValue{Name: nv.Name, Value: v})
+		}
+	}
+	return kept
+}
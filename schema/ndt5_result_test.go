@@ -6,6 +6,9 @@ import (
 	"cloud.google.com/go/bigquery"
 
 	"github.com/m-lab/go/cloud/bqx"
+	"github.com/m-lab/ndt-server/data"
+
+	"github.com/m-lab/etl/row"
 )
 
 func TestNDT5Result_Schema(t *testing.T) {
@@ -34,3 +37,23 @@ func TestNDT5Result_Schema(t *testing.T) {
 		t.Errorf("NDT5Result.Schema() missing expected fields; got %d, want 3", count)
 	}
 }
+
+func TestNDT5Result_Redact(t *testing.T) {
+	p, err := row.ParsePrivacyPolicy([]byte(`{"version": "test-1", "datatypes": ["ndt5"],
+		"drop_networks": ["10.0.0.0/8"], "ipv4_prefix": 24}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &NDT5ResultRow{Result: data.NDT5Result{ClientIP: "192.168.13.57", ServerIP: "192.0.2.1"}}
+	if !r.Redact(p) {
+		t.Fatal("Redact() dropped row")
+	}
+	if r.Result.ClientIP != "192.168.13.0" || r.Result.ServerIP != "192.0.2.1" {
+		t.Errorf("Redact() = %+v", r.Result)
+	}
+
+	r = &NDT5ResultRow{Result: data.NDT5Result{ClientIP: "10.1.2.3"}}
+	if r.Redact(p) || r.Result.ClientIP != "10.1.2.3" {
+		t.Error("Redact() should drop row without modifying it")
+	}
+}
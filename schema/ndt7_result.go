@@ -8,8 +8,10 @@ import (
 	"cloud.google.com/go/civil"
 	"github.com/m-lab/etl/row"
 	"github.com/m-lab/go/cloud/bqx"
+	"github.com/m-lab/go/rtx"
 
 	"github.com/m-lab/ndt-server/data"
+	"github.com/m-lab/ndt-server/ndt7/model"
 )
 
 // NDT7ResultRow defines the BQ schema using 'Standard Columns' conventions for
@@ -48,3 +50,49 @@ func (row *NDT7ResultRow) Schema() (bigquery.Schema, error) {
 	rr := bqx.RemoveRequired(sch)
 	return rr, err
 }
+
+var ndt7Schema bigquery.Schema
+
+func init() {
+	var err error
+	ndt7Schema, err = (&NDT7ResultRow{}).Schema()
+	rtx.Must(err, "Error generating ndt7 schema")
+}
+
+// Save implements bigquery.ValueSaver, using the test UUID as the insert ID,
+// so that retried tasks are deduplicated.
+func (r *NDT7ResultRow) Save() (map[string]bigquery.Value, string, error) {
+	id := r.ID
+	if id == "" {
+		id = row.InsertID(r.Parser.ArchiveURL, r.Parser.Filename, 0)
+	}
+	ss := bigquery.StructSaver{Schema: ndt7Schema, InsertID: id, Struct: r}
+	return ss.Save()
+}
+
+// Redact implements row.Redactable.
+func (r *NDT7ResultRow) Redact(p *row.PrivacyPolicy) bool {
+	if p.DropIP(r.Raw.ClientIP) || p.DropIP(r.Raw.ServerIP) {
+		return false
+	}
+	r.Raw.ClientIP = p.TruncateIP(r.Raw.ClientIP)
+	redactArchivalData(p, r.Raw.Download)
+	redactArchivalData(p, r.Raw.Upload)
+	return true
+}
+
+// redactArchivalData redacts the client addresses and metadata of a download
+// or upload measurement.
+func redactArchivalData(p *row.PrivacyPolicy, d *model.ArchivalData) {
+	if d == nil {
+		return
+	}
+	for _, ms := range [][]model.Measurement{d.ServerMeasurements, d.ClientMeasurements} {
+		for i := range ms {
+			if ci := ms[i].ConnectionInfo; ci != nil {
+				ci.Client = p.TruncateAddr(ci.Client)
+			}
+		}
+	}
+	d.ClientMetadata = redactMetadata(p, d.ClientMetadata)
+}
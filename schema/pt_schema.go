@@ -8,8 +8,10 @@ import (
 
 	"github.com/m-lab/annotation-service/api"
 	"github.com/m-lab/go/cloud/bqx"
+	"github.com/m-lab/go/rtx"
 
 	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/row"
 )
 
 type HopIP struct {
@@ -67,6 +69,23 @@ func (row *PTTest) Schema() (bigquery.Schema, error) {
 	return rr, nil
 }
 
+var ptSchema bigquery.Schema
+
+func init() {
+	var err error
+	ptSchema, err = (&PTTest{}).Schema()
+	rtx.Must(err, "Error generating pt schema")
+}
+
+// Save implements bigquery.ValueSaver, providing an insert ID derived from
+// the task file and test file, so that retried tasks are deduplicated.
+// The UUID is not used, as it is missing from older tests.
+func (r *PTTest) Save() (map[string]bigquery.Value, string, error) {
+	id := row.InsertID(r.Parseinfo.TaskFileName, r.Parseinfo.Filename, 0)
+	ss := bigquery.StructSaver{Schema: ptSchema, InsertID: id, Struct: r}
+	return ss.Save()
+}
+
 // Implement parser.Annotatable
 
 // GetLogTime returns the timestamp that should be used for annotation.
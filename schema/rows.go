@@ -0,0 +1,95 @@
+package schema
+
+// Sinks that write rows without the bigquery client, such as the Storage
+// Write API and Parquet sinks, need the schema of each row type, and the
+// representation BigQuery uses for each column type.
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// Errors that may be returned when converting rows.
+var (
+	ErrNoSchema         = errors.New("row type has no schema")
+	ErrUnsupportedValue = errors.New("unsupported value for column")
+)
+
+// Generator is implemented by row types with an explicit schema.
+type Generator interface {
+	Schema() (bigquery.Schema, error)
+}
+
+// Of returns the schema for the row, from its Schema method if it has one,
+// or inferred from its struct type.
+func Of(r interface{}) (bigquery.Schema, error) {
+	if g, ok := r.(Generator); ok {
+		return g.Schema()
+	}
+	s, err := bigquery.InferSchema(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %T: %v", ErrNoSchema, r, err)
+	}
+	return s, nil
+}
+
+// Values returns the column values of the row, from its Save method if it is
+// a bigquery.ValueSaver, or from its struct fields and the schema.
+func Values(s bigquery.Schema, r interface{}) (map[string]bigquery.Value, error) {
+	saver, ok := r.(bigquery.ValueSaver)
+	if !ok {
+		saver = &bigquery.StructSaver{Schema: s, Struct: r}
+	}
+	values, _, err := saver.Save()
+	return values, err
+}
+
+// Epoch is the zero day for DATE columns.
+var Epoch = civil.Date{Year: 1970, Month: time.January, Day: 1}
+
+// ColumnValue converts a single value, or element of a repeated value, to
+// the representation BigQuery uses for the column type: TIMESTAMP values are
+// int64 microseconds since the epoch, DATE values are int32 days since the
+// Epoch, and DATETIME and TIME values are canonical strings.  Other values,
+// including RECORD values, are returned unchanged.
+func ColumnValue(f *bigquery.FieldSchema, v bigquery.Value) (bigquery.Value, error) {
+	switch f.Type {
+	case bigquery.TimestampFieldType:
+		switch t := v.(type) {
+		case time.Time:
+			return t.UnixNano() / 1000, nil
+		case int64:
+			return t, nil
+		}
+	case bigquery.DateFieldType:
+		switch d := v.(type) {
+		case civil.Date:
+			return int32(d.DaysSince(Epoch)), nil
+		case time.Time:
+			return int32(civil.DateOf(d).DaysSince(Epoch)), nil
+		case int32:
+			return d, nil
+		}
+	case bigquery.DateTimeFieldType:
+		switch dt := v.(type) {
+		case civil.DateTime:
+			return bigquery.CivilDateTimeString(dt), nil
+		case string:
+			return dt, nil
+		}
+	case bigquery.TimeFieldType:
+		switch t := v.(type) {
+		case civil.Time:
+			return bigquery.CivilTimeString(t), nil
+		case string:
+			return t, nil
+		}
+	default:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: %T for %s", ErrUnsupportedValue, v, f.Name)
+}
@@ -0,0 +1,49 @@
+package schema_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+
+	"github.com/m-lab/etl/schema"
+)
+
+func TestOf(t *testing.T) {
+	s, err := schema.Of(&struct{ Name string }{})
+	if err != nil || len(s) != 1 || s[0].Name != "Name" {
+		t.Error("Of() =", s, err)
+	}
+	if _, err := schema.Of("not a struct"); !errors.Is(err, schema.ErrNoSchema) {
+		t.Error("Expected ErrNoSchema, got", err)
+	}
+}
+
+func TestColumnValue(t *testing.T) {
+	ts := time.Date(2020, 3, 18, 0, 6, 43, 982584000, time.UTC)
+	tests := []struct {
+		typ  bigquery.FieldType
+		v    bigquery.Value
+		want bigquery.Value
+	}{
+		{bigquery.TimestampFieldType, ts, ts.UnixNano() / 1000},
+		{bigquery.DateFieldType, civil.DateOf(ts), int32(18339)},
+		{bigquery.DateFieldType, ts, int32(18339)},
+		{bigquery.DateTimeFieldType, civil.DateTimeOf(ts), "2020-03-18 00:06:43.982584"},
+		{bigquery.TimeFieldType, civil.TimeOf(ts), "00:06:43.982584"},
+		{bigquery.IntegerFieldType, uint32(7), uint32(7)},
+		{bigquery.StringFieldType, "foo", "foo"},
+	}
+	for _, tt := range tests {
+		got, err := schema.ColumnValue(&bigquery.FieldSchema{Name: "col", Type: tt.typ}, tt.v)
+		if err != nil || got != tt.want {
+			t.Errorf("ColumnValue(%s, %v) = %v (%T), %v", tt.typ, tt.v, got, got, err)
+		}
+	}
+	_, err := schema.ColumnValue(&bigquery.FieldSchema{Name: "col", Type: bigquery.TimestampFieldType}, 1.5)
+	if !errors.Is(err, schema.ErrUnsupportedValue) {
+		t.Error("Expected ErrUnsupportedValue, got", err)
+	}
+}
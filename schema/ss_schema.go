@@ -5,7 +5,12 @@ package schema
 import (
 	"time"
 
+	"cloud.google.com/go/bigquery"
+
 	"github.com/m-lab/annotation-service/api"
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/row"
 )
 
 type Web100ConnectionSpecification struct {
@@ -189,6 +194,25 @@ type SS struct {
 
 	Type             int64          `json:"type,int64"`
 	Web100_log_entry Web100LogEntry `json:"web100_log_entry"`
+
+	// Index is the position of the connection within the test file.
+	// NOT part of struct schema.  Used only to derive the insert ID.
+	Index int `json:"-" bigquery:"-"`
+}
+
+var ssSchema bigquery.Schema
+
+func init() {
+	var err error
+	ssSchema, err = bigquery.InferSchema(SS{})
+	rtx.Must(err, "Error generating ss schema")
+}
+
+// Save implements bigquery.ValueSaver, providing an insert ID derived from
+// the task file, test, and index, so that retried tasks are deduplicated.
+func (ss *SS) Save() (map[string]bigquery.Value, string, error) {
+	saver := bigquery.StructSaver{Schema: ssSchema, InsertID: row.InsertID(ss.TaskFileName, ss.TestID, ss.Index), Struct: ss}
+	return saver.Save()
 }
 
 // Implement parser.Annotatable
@@ -1,6 +1,14 @@
 package schema
 
-import "time"
+import (
+	"time"
+
+	"cloud.google.com/go/bigquery"
+
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/row"
+)
 
 // Sample is an individual measurement taken by DISCO.
 type Sample struct {
@@ -19,6 +27,25 @@ type SwitchStats struct {
 	Metric        string    `json:"metric" bigquery:"metric"`
 	Hostname      string    `json:"hostname" bigquery:"hostname"`
 	Experiment    string    `json:"experiment" bigquery:"experiment"`
+
+	// Index is the position of the record within the test file.
+	// NOT part of struct schema.  Used only to derive the insert ID.
+	Index int `json:"-" bigquery:"-"`
+}
+
+var switchSchema bigquery.Schema
+
+func init() {
+	var err error
+	switchSchema, err = bigquery.InferSchema(SwitchStats{})
+	rtx.Must(err, "Error generating switch schema")
+}
+
+// Save implements bigquery.ValueSaver, providing an insert ID derived from
+// the task file, test, and index, so that retried tasks are deduplicated.
+func (s SwitchStats) Save() (map[string]bigquery.Value, string, error) {
+	ss := bigquery.StructSaver{Schema: switchSchema, InsertID: row.InsertID(s.TaskFilename, s.TestID, s.Index), Struct: s}
+	return ss.Save()
 }
 
 // Size estimates the number of bytes in the SwitchStats object.
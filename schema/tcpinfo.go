@@ -12,6 +12,7 @@ import (
 	"github.com/m-lab/tcp-info/snapshot"
 
 	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/row"
 )
 
 // ServerInfo details various information about the server.
@@ -41,6 +42,12 @@ type ParseInfoV0 struct {
 	Filename      string
 }
 
+// SnapshotPolicyInfo records how the snapshots in a row were selected.
+type SnapshotPolicyInfo struct {
+	Policy  string // The snapshot policy, e.g. "every:10".
+	Dropped int64  // The number of snapshots omitted from Snapshots.
+}
+
 // TCPRow describes a single BQ row of TCPInfo data.
 type TCPRow struct {
 	UUID     string    // Top level just because
@@ -49,7 +56,8 @@ type TCPRow struct {
 	ClientASN uint32 // Top level for clustering
 	ServerASN uint32 // Top level for clustering
 
-	ParseInfo *ParseInfoV0
+	ParseInfo      *ParseInfoV0
+	SnapshotPolicy *SnapshotPolicyInfo
 
 	SockID inetdiag.SockID
 
@@ -171,3 +179,29 @@ func (row *TCPRow) AnnotateServer(local *api.Annotations) error {
 	row.ServerASN = uint32(asn)
 	return nil
 }
+
+// clearClientAddr removes the client address from a raw inet_diag message.
+func clearClientAddr(s *snapshot.Snapshot) {
+	if s != nil && s.InetDiagMsg != nil {
+		s.InetDiagMsg.ID.IDiagDst = [16]byte{}
+	}
+}
+
+// Redact implements row.Redactable.  If the policy truncates IPs, the client
+// address is also removed from the raw snapshots.
+func (row *TCPRow) Redact(p *row.PrivacyPolicy) bool {
+	if p.DropIP(row.SockID.SrcIP) || p.DropIP(row.SockID.DstIP) {
+		return false
+	}
+	row.SockID.DstIP = p.TruncateIP(row.SockID.DstIP)
+	if row.Client != nil {
+		row.Client.IP = p.TruncateIP(row.Client.IP)
+	}
+	if p.TruncatesIPs() {
+		clearClientAddr(row.FinalSnapshot)
+		for _, s := range row.Snapshots {
+			clearClientAddr(s)
+		}
+	}
+	return true
+}
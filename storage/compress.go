@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression identifies the compression format of an archive or file.
+type Compression string
+
+// Compression formats detected by DetectCompression.
+const (
+	NoCompression Compression = "none"
+	Gzip          Compression = "gzip"
+	Zstd          Compression = "zstd"
+	Bzip2         Compression = "bzip2"
+	Xz            Compression = "xz"
+)
+
+// magicLen is the number of bytes needed to detect any supported format.
+const magicLen = 6
+
+var magics = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Bzip2, []byte("BZh")},
+	{Xz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// DetectCompression returns the compression format indicated by the magic
+// bytes at the start of header, or NoCompression.
+func DetectCompression(header []byte) Compression {
+	for _, m := range magics {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.compression
+		}
+	}
+	return NoCompression
+}
+
+// NewDecompressor returns a reader that decompresses r.  The caller should
+// Close the reader, which does not close r.
+func NewDecompressor(c Compression, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Bzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case Xz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
+
+// testSuffixes are the compression suffixes stripped from test file names.
+var testSuffixes = []string{".gz", ".zst"}
+
+// NormalizeTest prepares a test file for parsing.  Gzip and zstd compressed
+// data is decompressed, within the limits of the budget, and the compression
+// suffix is stripped from the name, so that parsers only see raw content.
+// It returns the stripped name, for detecting the test type, the new data,
+// and the compression that was removed.  Parsers should still be given the
+// original name, since it may be part of the test ID.
+func NormalizeTest(name string, data []byte, budget *InflateBudget) (string, []byte, Compression, error) {
+	c := DetectCompression(data)
+	switch c {
+	case Gzip, Zstd:
+		var err error
+		data, err = budget.Inflate(c, data)
+		if err != nil {
+			return name, nil, c, err
+		}
+	default:
+		// Other formats are left to the parsers.
+		c = NoCompression
+	}
+	// Some files are stored uncompressed with a compression suffix, so the
+	// suffix is stripped even if the data was not compressed.
+	for _, suffix := range testSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			break
+		}
+	}
+	return name, data, c, nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/m-lab/go/rtx"
+	"github.com/ulikunitz/xz"
+
+	"github.com/m-lab/etl/etl"
+)
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   Compression
+	}{
+		{[]byte{0x1f, 0x8b, 0x08, 0, 0, 0}, Gzip},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0, 0}, Zstd},
+		{[]byte("BZh91AY"), Bzip2},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, Xz},
+		{[]byte("ndt/2019"), NoCompression},
+		{[]byte{0x1f}, NoCompression},
+		{nil, NoCompression},
+	}
+	for _, tt := range tests {
+		if got := DetectCompression(tt.header); got != tt.want {
+			t.Errorf("DetectCompression(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// makeTar returns a tar archive with a plain and a gzipped entry.  Sources
+// return the gzipped entry as is, so checkTests inflates it like Task does.
+func makeTar() []byte {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"test": "gzipped"}`))
+	zw.Close()
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"2019/05/25/test1.json", []byte(`{"test": "plain"}`)},
+		{"2019/05/25/test2.json.gz", gz.Bytes()},
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), Typeflag: tar.TypeReg})
+		tw.Write(f.data)
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func compress(t *testing.T, c Compression, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch c {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Zstd:
+		w, err = zstd.NewWriter(&buf)
+	case Xz:
+		w, err = xz.NewWriter(&buf)
+	default:
+		return data
+	}
+	rtx.Must(err, "compressor")
+	_, err = w.Write(data)
+	rtx.Must(err, "compress")
+	rtx.Must(w.Close(), "close")
+	return buf.Bytes()
+}
+
+func checkTests(t *testing.T, src etl.TestSource) {
+	want := map[string]string{
+		"2019/05/25/test1.json":    `{"test": "plain"}`,
+		"2019/05/25/test2.json.gz": `{"test": "gzipped"}`,
+	}
+	count := 0
+	for name, data, err := src.NextTest(1000); err != io.EOF; name, data, err = src.NextTest(1000) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, data, _, err = NormalizeTest(name, data, NewInflateBudget(1000, 1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want[name] {
+			t.Errorf("%s: got %q, want %q", name, data, want[name])
+		}
+		count++
+	}
+	if count != len(want) {
+		t.Error("Expected", len(want), "tests, got", count)
+	}
+}
+
+func TestCompressedSources(t *testing.T) {
+	dp, err := etl.ValidateTestPath(
+		"gs://fake-bucket/ndt/tcpinfo/2019/05/25/20190525T020001.697396Z-tcpinfo-mlab4-ord01-ndt.tar.zst")
+	rtx.Must(err, "bad path")
+	for _, c := range []Compression{NoCompression, Gzip, Zstd, Xz} {
+		t.Run(string(c), func(t *testing.T) {
+			archive := compress(t, c, makeTar())
+
+			src, _ := flakySource(t, archive)
+			if src.compression != c {
+				t.Error("Detected", src.compression, "want", c)
+			}
+			checkTests(t, src)
+			src.Close()
+
+			rr := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(archive[offset : offset+length])), nil
+			}
+			ps, err := NewPrefetchSource(context.Background(), rr, int64(len(archive)), dp, "label", PrefetchOptions{ChunkSize: 100})
+			rtx.Must(err, "NewPrefetchSource")
+			checkTests(t, ps)
+			ps.Close()
+		})
+	}
+}
+
+func TestNormalizeTest(t *testing.T) {
+	raw := []byte(`{"test": "raw"}`)
+	tests := []struct {
+		name     string
+		data     []byte
+		wantName string
+		wantC    Compression
+		wantErr  bool
+	}{
+		{"test.json.gz", compress(t, Gzip, raw), "test.json", Gzip, false},
+		{"test.jsonl.zst", compress(t, Zstd, raw), "test.jsonl", Zstd, false},
+		{"test.json.gz", raw, "test.json", NoCompression, false}, // Stored uncompressed.
+		{"test.json", raw, "test.json", NoCompression, false},
+		{"bomb.gz", compress(t, Gzip, make([]byte, 1000)), "bomb.gz", Gzip, true},
+	}
+	for _, tt := range tests {
+		name, data, c, err := NormalizeTest(tt.name, tt.data, NewInflateBudget(100, 1000))
+		if (err != nil) != tt.wantErr || (err != nil && !IsOversizeInflated(err)) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if name != tt.wantName || c != tt.wantC {
+			t.Errorf("%s: got %s %s, want %s %s", tt.name, name, c, tt.wantName, tt.wantC)
+		}
+		if err == nil && !bytes.Equal(data, raw) {
+			t.Errorf("%s: got data %q", tt.name, data)
+		}
+	}
+}
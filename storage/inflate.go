@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// DefaultMaxInflatedSize is the default limit on the size of a single test
+// file after decompression, to guard against decompression bombs.
+const DefaultMaxInflatedSize = 1024 * 1024 * 1024
+
+// DefaultMaxInflatedTaskSize is the default limit on the total size of all
+// test files decompressed while processing a single task.
+const DefaultMaxInflatedTaskSize = 16 * 1024 * 1024 * 1024
+
+// OversizeInflatedError is returned when decompressed data exceeds either the
+// per-test limit or the remaining per-task budget.
+type OversizeInflatedError struct {
+	Limit int64 // The limit that was exceeded, in bytes.
+	Task  bool  // True if the per-task budget, rather than the per-test limit, was exceeded.
+}
+
+func (e *OversizeInflatedError) Error() string {
+	if e.Task {
+		return fmt.Sprintf("inflated data exceeds remaining task budget of %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("inflated test exceeds %d bytes", e.Limit)
+}
+
+// IsOversizeInflated returns true if err is, or wraps, an OversizeInflatedError.
+func IsOversizeInflated(err error) bool {
+	var e *OversizeInflatedError
+	return errors.As(err, &e)
+}
+
+// readLimited reads all of r, returning an OversizeInflatedError if there is
+// more than limit bytes.
+func readLimited(r io.Reader, limit int64, task bool) ([]byte, error) {
+	out, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, &OversizeInflatedError{Limit: limit, Task: task}
+	}
+	return out, nil
+}
+
+// Inflate decompresses data in the given format, returning an
+// OversizeInflatedError if the result would be larger than maxSize.
+// Task decompresses test files with an InflateBudget, so parsers and sources
+// should not need to decompress them.
+func Inflate(c Compression, data []byte, maxSize int64) ([]byte, error) {
+	r, err := NewDecompressor(c, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r, maxSize, false)
+}
+
+// InflateBudget limits decompression for a single task, with a limit for each
+// test file, and a total budget for all test files.
+// It is THREAD-SAFE.
+type InflateBudget struct {
+	maxTest int64
+
+	lock      sync.Mutex
+	remaining int64
+}
+
+// NewInflateBudget creates an InflateBudget with limits in bytes.
+func NewInflateBudget(maxTest, maxTotal int64) *InflateBudget {
+	return &InflateBudget{maxTest: maxTest, remaining: maxTotal}
+}
+
+// Remaining returns the remaining task budget.
+func (b *InflateBudget) Remaining() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.remaining
+}
+
+// Inflate decompresses data, and charges the result against the budget.
+// It returns an OversizeInflatedError if the result exceeds the per-test
+// limit or the remaining budget.  The limit is reserved before decompressing,
+// and the unused part refunded afterwards, so that concurrent callers can't
+// overspend the budget.
+func (b *InflateBudget) Inflate(c Compression, data []byte) ([]byte, error) {
+	b.lock.Lock()
+	limit, task := b.maxTest, false
+	if b.remaining < limit {
+		limit, task = b.remaining, true
+	}
+	b.remaining -= limit
+	b.lock.Unlock()
+
+	used := int64(0)
+	defer func() {
+		b.lock.Lock()
+		b.remaining += limit - used
+		b.lock.Unlock()
+	}()
+
+	r, err := NewDecompressor(c, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := readLimited(r, limit, task)
+	if err != nil {
+		return nil, err
+	}
+	used = int64(len(out))
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestInflate(t *testing.T) {
+	data := compress(t, Gzip, make([]byte, 1000))
+	if out, err := Inflate(Gzip, data, 1000); err != nil || len(out) != 1000 {
+		t.Error("Expected 1000 bytes", len(out), err)
+	}
+	_, err := Inflate(Gzip, data, 999)
+	if !IsOversizeInflated(err) {
+		t.Fatal("Expected OversizeInflatedError", err)
+	}
+	if IsOversizeInflated(fmt.Errorf("wrapped: %w", err)) != true {
+		t.Error("Should detect wrapped error")
+	}
+	if _, err := Inflate(Gzip, []byte("not gzip"), 1000); err == nil || IsOversizeInflated(err) {
+		t.Error("Expected gzip error", err)
+	}
+}
+
+func TestInflateBudget(t *testing.T) {
+	b := NewInflateBudget(600, 1500)
+	data := compress(t, Gzip, make([]byte, 500))
+	if _, err := b.Inflate(Gzip, data); err != nil {
+		t.Fatal(err)
+	}
+	if b.Remaining() != 1000 {
+		t.Error("Expected 1000 remaining, got", b.Remaining())
+	}
+	// Exceeds the per-test limit.
+	_, err := b.Inflate(Gzip, compress(t, Gzip, make([]byte, 700)))
+	if e, ok := err.(*OversizeInflatedError); !ok || e.Task || e.Limit != 600 {
+		t.Error("Expected per-test error", err)
+	}
+	if _, err := b.Inflate(Gzip, data); err != nil {
+		t.Fatal(err)
+	}
+	// Exceeds the remaining task budget.
+	_, err = b.Inflate(Gzip, compress(t, Gzip, make([]byte, 501)))
+	if e, ok := err.(*OversizeInflatedError); !ok || !e.Task || e.Limit != 500 {
+		t.Error("Expected task budget error", err)
+	}
+}
+
+func TestInflateBudgetConcurrent(t *testing.T) {
+	b := NewInflateBudget(1000, 1000)
+	data := compress(t, Gzip, make([]byte, 500))
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	inflated := int64(0)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := b.Inflate(Gzip, data); err == nil {
+				lock.Lock()
+				inflated += int64(len(out))
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if inflated > 1000 || b.Remaining() != 1000-inflated {
+		t.Errorf("Inflated %d with %d remaining", inflated, b.Remaining())
+	}
+}
@@ -0,0 +1,396 @@
+package storage
+
+// The ParquetSink writes rows to Parquet files, for consumers that read
+// the data directly from disk or GCS instead of through BigQuery.  The
+// Parquet schema is derived from the same bigquery.Schema used for the
+// BigQuery tables, so the files have the same columns.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	gcs "cloud.google.com/go/storage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/row"
+	"github.com/m-lab/etl/schema"
+)
+
+const (
+	// DefaultRowGroupSize is the default size of buffered rows before a row
+	// group is written.
+	DefaultRowGroupSize = 64 * 1024 * 1024
+	// DefaultMaxParquetFileSize is the default size at which a new file is
+	// started.
+	DefaultMaxParquetFileSize = 512 * 1024 * 1024
+)
+
+// Output creates the files written by a ParquetSink.
+type Output interface {
+	// Create creates the named file, overwriting any existing file.
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+	// Remove removes the named file.  It returns an error wrapping
+	// os.ErrNotExist if there is no such file.
+	Remove(ctx context.Context, name string) error
+}
+
+type gcsOutput struct {
+	client stiface.Client
+	bucket string
+}
+
+// NewGCSOutput returns an Output that creates objects in the GCS bucket.
+func NewGCSOutput(client stiface.Client, bucket string) Output {
+	return &gcsOutput{client: client, bucket: bucket}
+}
+
+func (o *gcsOutput) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return ObjectWriter(ctx, o.client, o.bucket, name), nil
+}
+
+func (o *gcsOutput) Remove(ctx context.Context, name string) error {
+	err := o.client.Bucket(o.bucket).Object(name).Delete(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %s", os.ErrNotExist, name)
+	}
+	return err
+}
+
+type dirOutput struct {
+	dir string
+}
+
+// NewDirOutput returns an Output that creates files under a local directory.
+func NewDirOutput(dir string) Output {
+	return &dirOutput{dir: dir}
+}
+
+func (o *dirOutput) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	fn := filepath.Join(o.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(fn)
+}
+
+func (o *dirOutput) Remove(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(o.dir, filepath.FromSlash(name)))
+}
+
+// countingWriter counts the bytes written to a file.
+type countingWriter struct {
+	io.WriteCloser
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.WriteCloser.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+//======================================================================
+// Conversion of bigquery schemas and rows.
+//======================================================================
+
+// parquetField is a node of a parquet-go JSON schema.
+type parquetField struct {
+	Tag    string
+	Fields []*parquetField `json:",omitempty"`
+}
+
+// parquetTypes maps BigQuery column types to Parquet types.  Types not
+// listed here are written as strings.
+var parquetTypes = map[bigquery.FieldType]string{
+	bigquery.IntegerFieldType:   "type=INT64",
+	bigquery.FloatFieldType:     "type=DOUBLE",
+	bigquery.BooleanFieldType:   "type=BOOLEAN",
+	bigquery.BytesFieldType:     "type=BYTE_ARRAY",
+	bigquery.TimestampFieldType: "type=INT64, convertedtype=TIMESTAMP_MICROS",
+	bigquery.DateFieldType:      "type=INT32, convertedtype=DATE",
+}
+
+func parquetFields(schema bigquery.Schema) []*parquetField {
+	fields := make([]*parquetField, len(schema))
+	for i, f := range schema {
+		// All fields are optional, so that missing values are allowed.
+		rt := "OPTIONAL"
+		if f.Repeated {
+			rt = "REPEATED"
+		}
+		pf := &parquetField{}
+		switch t, ok := parquetTypes[f.Type]; {
+		case f.Type == bigquery.RecordFieldType:
+			pf.Tag = fmt.Sprintf("name=%s, repetitiontype=%s", f.Name, rt)
+			pf.Fields = parquetFields(f.Schema)
+		case ok:
+			pf.Tag = fmt.Sprintf("name=%s, %s, repetitiontype=%s", f.Name, t, rt)
+		default:
+			pf.Tag = fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=%s", f.Name, rt)
+		}
+		fields[i] = pf
+	}
+	return fields
+}
+
+// ParquetSchema returns the parquet-go JSON schema for the BigQuery schema.
+// Nested and repeated records become nested and repeated groups.
+func ParquetSchema(schema bigquery.Schema) (string, error) {
+	root := parquetField{Tag: "name=parquet_go_root, repetitiontype=REQUIRED",
+		Fields: parquetFields(schema)}
+	j, err := json.Marshal(root)
+	return string(j), err
+}
+
+// parquetValues converts row values to the JSON representation expected by
+// the parquet-go JSON writer for the schema.
+func parquetValues(s bigquery.Schema, values map[string]bigquery.Value) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(s))
+	for _, f := range s {
+		v := values[f.Name]
+		if v == nil {
+			continue
+		}
+		if !f.Repeated {
+			pv, err := parquetValue(f, v)
+			if err != nil {
+				return nil, err
+			}
+			out[f.Name] = pv
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("%w: %T for repeated %s", schema.ErrUnsupportedValue, v, f.Name)
+		}
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			var err error
+			list[i], err = parquetValue(f, rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+		}
+		out[f.Name] = list
+	}
+	return out, nil
+}
+
+// parquetValue converts a single value, or element of a repeated value.
+func parquetValue(f *bigquery.FieldSchema, v bigquery.Value) (interface{}, error) {
+	switch f.Type {
+	case bigquery.RecordFieldType:
+		if values, ok := v.(map[string]bigquery.Value); ok {
+			return parquetValues(f.Schema, values)
+		}
+		return nil, fmt.Errorf("%w: %T for %s", schema.ErrUnsupportedValue, v, f.Name)
+	case bigquery.BytesFieldType:
+		// Write the raw bytes, instead of the base64 JSON encoding.
+		if b, ok := v.([]byte); ok {
+			return string(b), nil
+		}
+	}
+	return schema.ColumnValue(f, v)
+}
+
+//======================================================================
+// ParquetSink implements row.Sink to Parquet files.
+//======================================================================
+
+// ParquetSink implements row.Sink by writing rows to a sequence of Parquet
+// files.  Files are named <name>-NNNN.parquet, and a new file is started when
+// the current file reaches the maximum size.  It should be used for a single
+// task, and implements task.Finisher, so that the last file is completed when
+// the task completes.  The schema is derived from the first row.
+// It is THREAD-SAFE.
+//
+// NOTE: Files from a failed task are not removed, so consumers should
+// expect duplicates until the task is retried.  When a retry succeeds, it
+// overwrites the files, and removes any later files from earlier attempts.
+type ParquetSink struct {
+	out          Output
+	name         string // Prefix of the file names.
+	rowGroupSize int64
+	maxFileSize  int64
+
+	lock       sync.Mutex // Protects all fields below.
+	schema     bigquery.Schema
+	jsonSchema string
+	file       *countingWriter
+	writer     *writer.JSONWriter
+	files      []string // Names of all files started.
+}
+
+// NewParquetSink creates a ParquetSink that writes files with the name
+// prefix to the Output.  Rows are buffered until rowGroupSize bytes, and a
+// new file is started after maxFileSize bytes.
+func NewParquetSink(out Output, name string, rowGroupSize, maxFileSize int64) *ParquetSink {
+	return &ParquetSink{out: out, name: name, rowGroupSize: rowGroupSize, maxFileSize: maxFileSize}
+}
+
+// fileName returns the name of the i'th file.
+func (ps *ParquetSink) fileName(i int) string {
+	return fmt.Sprintf("%s-%04d.parquet", ps.name, i)
+}
+
+// open starts a new file.  Caller must hold the lock.
+func (ps *ParquetSink) open() error {
+	name := ps.fileName(len(ps.files))
+	w, err := ps.out.Create(context.Background(), name)
+	if err != nil {
+		return err
+	}
+	file := &countingWriter{WriteCloser: w}
+	pw, err := writer.NewJSONWriter(ps.jsonSchema, writerfile.NewWriterFile(file), 1)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	pw.RowGroupSize = ps.rowGroupSize
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	ps.file, ps.writer = file, pw
+	ps.files = append(ps.files, name)
+	return nil
+}
+
+// closeFile completes the current file.  Caller must hold the lock.
+func (ps *ParquetSink) closeFile() error {
+	if ps.writer == nil {
+		return nil
+	}
+	err := ps.writer.WriteStop()
+	if cErr := ps.file.Close(); err == nil {
+		err = cErr
+	}
+	ps.file, ps.writer = nil, nil
+	return err
+}
+
+// write converts the row, and writes it to the current file.  Caller must
+// hold the lock.
+func (ps *ParquetSink) write(r interface{}) error {
+	values, err := schema.Values(ps.schema, r)
+	if err != nil {
+		return err
+	}
+	pv, err := parquetValues(ps.schema, values)
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(pv)
+	if err != nil {
+		return err
+	}
+	return ps.writer.Write(string(j))
+}
+
+// Commit implements row.Sink.  It writes the rows, and returns the number of
+// rows written.
+func (ps *ParquetSink) Commit(rows []interface{}, label string) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if ps.schema == nil {
+		s, err := schema.Of(rows[0])
+		if err != nil {
+			return 0, err
+		}
+		ps.jsonSchema, err = ParquetSchema(s)
+		if err != nil {
+			return 0, err
+		}
+		ps.schema = s
+	}
+	if ps.writer == nil {
+		if err := ps.open(); err != nil {
+			metrics.BackendFailureCount.WithLabelValues(label, "parquet open failed").Inc()
+			return 0, err
+		}
+	}
+	for i := range rows {
+		if err := ps.write(rows[i]); err != nil {
+			metrics.BackendFailureCount.WithLabelValues(label, "parquet write failed").Inc()
+			return i, err
+		}
+	}
+	// Include the rows buffered for the current row group.
+	if ps.file.n+ps.writer.Size >= ps.maxFileSize {
+		if err := ps.closeFile(); err != nil {
+			metrics.BackendFailureCount.WithLabelValues(label, "parquet close failed").Inc()
+			return len(rows), err
+		}
+	}
+	return len(rows), nil
+}
+
+// Finish implements task.Finisher.  It completes the current file, whether or
+// not the task succeeded.  If the task succeeded, files left by an earlier
+// attempt that wrote more files are removed.
+func (ps *ParquetSink) Finish(taskErr error) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if err := ps.closeFile(); err != nil {
+		log.Println("Failed to complete", ps.name, err)
+		return err
+	}
+	if taskErr != nil {
+		return nil
+	}
+	// Files are numbered consecutively, so stop at the first missing file.
+	for i := len(ps.files); ; i++ {
+		err := ps.out.Remove(context.Background(), ps.fileName(i))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			log.Println("Failed to remove stale file", ps.fileName(i), err)
+			return err
+		}
+	}
+}
+
+// Files returns the names of the files started by the sink.
+func (ps *ParquetSink) Files() []string {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	return append([]string{}, ps.files...)
+}
+
+// ParquetSinkFactory provides a ParquetSink for each task.  Files are named
+// after the task archive, with the date path and archive name, e.g.
+// ndt/ndt7/2020/03/18/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt-0000.parquet
+type ParquetSinkFactory struct {
+	out          Output
+	rowGroupSize int64
+	maxFileSize  int64
+}
+
+// NewParquetSinkFactory creates a ParquetSinkFactory that writes to the Output.
+func NewParquetSinkFactory(out Output, rowGroupSize, maxFileSize int64) *ParquetSinkFactory {
+	return &ParquetSinkFactory{out: out, rowGroupSize: rowGroupSize, maxFileSize: maxFileSize}
+}
+
+// Get implements factory.SinkFactory.
+func (sf *ParquetSinkFactory) Get(ctx context.Context, dp etl.DataPath) (row.Sink, etl.ProcessingError) {
+	base := strings.TrimSuffix(path.Base(dp.URI), dp.Suffix)
+	name := path.Join(dp.ExpDir, dp.DataType, dp.DatePath, base)
+	return NewParquetSink(sf.out, name, sf.rowGroupSize, sf.maxFileSize), nil
+}
@@ -0,0 +1,208 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	fgs "github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/schema"
+	"github.com/m-lab/etl/storage"
+)
+
+type parquetServer struct {
+	Site string
+}
+
+type parquetRow struct {
+	Name    string
+	Count   int64
+	Time    time.Time
+	Date    civil.Date
+	Tags    []string
+	Server  parquetServer
+	Servers []parquetServer
+}
+
+func testRows(n int) []interface{} {
+	ts := time.Date(2020, 3, 18, 1, 2, 3, 0, time.UTC)
+	rows := make([]interface{}, n)
+	for i := range rows {
+		rows[i] = &parquetRow{Name: "foo", Count: int64(i), Time: ts, Date: civil.DateOf(ts),
+			Tags: []string{"a", "b"}, Server: parquetServer{"lga03"},
+			Servers: []parquetServer{{"lga03"}, {"syd03"}}}
+	}
+	return rows
+}
+
+// numRows returns the number of rows in a local Parquet file.
+func numRows(t *testing.T, fn string) int64 {
+	fr, err := local.NewLocalFileReader(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	return pr.GetNumRows()
+}
+
+func TestParquetSchema(t *testing.T) {
+	schema, err := bigquery.InferSchema(parquetRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.ParquetSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"name=Name, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`,
+		`"name=Count, type=INT64, repetitiontype=OPTIONAL"`,
+		`"name=Time, type=INT64, convertedtype=TIMESTAMP_MICROS, repetitiontype=OPTIONAL"`,
+		`"name=Date, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`,
+		`"name=Tags, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REPEATED"`,
+		`{"Tag":"name=Server, repetitiontype=OPTIONAL","Fields":[{"Tag":"name=Site,`,
+		`{"Tag":"name=Servers, repetitiontype=REPEATED","Fields":[{"Tag":"name=Site,`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("ParquetSchema() missing %s:\n%s", want, s)
+		}
+	}
+}
+
+func TestParquetSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps := storage.NewParquetSink(storage.NewDirOutput(dir), "ndt7/task",
+		storage.DefaultRowGroupSize, storage.DefaultMaxParquetFileSize)
+	for i := 0; i < 2; i++ {
+		n, err := ps.Commit(testRows(3), "ndt7")
+		if err != nil || n != 3 {
+			t.Fatal("Commit failed:", n, err)
+		}
+	}
+	if err := ps.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	files := ps.Files()
+	if len(files) != 1 || files[0] != "ndt7/task-0000.parquet" {
+		t.Fatal("Unexpected files:", files)
+	}
+	if n := numRows(t, filepath.Join(dir, files[0])); n != 6 {
+		t.Error("Expected 6 rows, got", n)
+	}
+	// Nothing more to complete.
+	if err := ps.Finish(nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParquetSinkRollover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Every Commit fills a file.
+	ps := storage.NewParquetSink(storage.NewDirOutput(dir), "task", 1, 1)
+	for i := 0; i < 3; i++ {
+		if _, err := ps.Commit(testRows(2), "ndt7"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ps.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	files := ps.Files()
+	if len(files) != 3 || files[2] != "task-0002.parquet" {
+		t.Fatal("Unexpected files:", files)
+	}
+	for _, f := range files {
+		if n := numRows(t, filepath.Join(dir, f)); n != 2 {
+			t.Error("Expected 2 rows in", f, "got", n)
+		}
+	}
+
+	// A retry that writes fewer files removes the later files.
+	ps = storage.NewParquetSink(storage.NewDirOutput(dir), "task", 1, 1<<20)
+	if _, err := ps.Commit(testRows(2), "ndt7"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := filepath.Glob(filepath.Join(dir, "task-*.parquet"))
+	if err != nil || len(remaining) != 1 || filepath.Base(remaining[0]) != "task-0000.parquet" {
+		t.Error("Unexpected files after retry:", remaining, err)
+	}
+}
+
+func TestParquetSinkGCS(t *testing.T) {
+	server := fgs.NewServer([]fgs.Object{})
+	defer server.Stop()
+	server.CreateBucket("parquet-bucket")
+	c := server.Client()
+
+	f := storage.NewParquetSinkFactory(storage.NewGCSOutput(stiface.AdaptClient(c), "parquet-bucket"),
+		storage.DefaultRowGroupSize, storage.DefaultMaxParquetFileSize)
+	dp, err := etl.ValidateTestPath(
+		"gs://archive-mlab-sandbox/ndt/ndt7/2020/03/18/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, pErr := f.Get(context.Background(), dp)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	if _, err := sink.Commit(testRows(3), "ndt7"); err != nil {
+		t.Fatal(err)
+	}
+	ps := sink.(*storage.ParquetSink)
+	if err := ps.Finish(errors.New("task errors do not matter")); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "ndt/ndt7/2020/03/18/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt-0000.parquet"
+	r, err := c.Bucket("parquet-bucket").Object(name).NewReader(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Error("Not a complete parquet file")
+	}
+}
+
+func TestParquetSinkBadRow(t *testing.T) {
+	ps := storage.NewParquetSink(storage.NewDirOutput(os.TempDir()), "bad",
+		storage.DefaultRowGroupSize, storage.DefaultMaxParquetFileSize)
+	if _, err := ps.Commit([]interface{}{"not a struct"}, "ndt7"); !errors.Is(err, schema.ErrNoSchema) {
+		t.Error("Expected ErrNoSchema, got", err)
+	}
+}
@@ -0,0 +1,448 @@
+package storage
+
+// PrefetchSource is an alternative to GCSSource that reads ahead of the
+// parser.  The object is downloaded in parallel ranged chunks into a bounded
+// buffer, decompression runs in its own goroutine, and tar entries are
+// read and handed to the consumer over a channel.  Parsing only stalls when
+// the read-ahead buffer is empty, rather than on every slow GCS read.
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	gcs "cloud.google.com/go/storage"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/factory"
+	"github.com/m-lab/etl/metrics"
+)
+
+// RangeReaderFunc returns a reader for length bytes of an object, starting at
+// offset.  It is usually the NewRangeReader method of a gcs.ObjectHandle.
+type RangeReaderFunc func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// PrefetchOptions controls the read-ahead behavior of a PrefetchSource.
+type PrefetchOptions struct {
+	ChunkSize    int64 // Size of each ranged read.
+	Parallel     int   // Maximum number of chunks fetched or buffered at once.
+	Entries      int   // Number of tar entries buffered ahead of the consumer.
+	MaxEntrySize int64 // Entries larger than this are skipped, and reported as oversize.
+	ChunkRetries int   // Number of attempts for each chunk.
+
+	// MaxBuffered limits the total size of the entries buffered ahead of the
+	// consumer.  An entry larger than MaxBuffered is only read when nothing
+	// else is buffered.  Defaults to MaxEntrySize.
+	MaxBuffered int64
+
+	// NewGzipReader creates the decompressor for gzipped archives.  It may be
+	// replaced with a parallel gzip implementation.  Other formats use
+	// NewDecompressor.
+	NewGzipReader func(io.Reader) (io.ReadCloser, error)
+}
+
+// DefaultPrefetchOptions buffers up to 32MB of compressed data per archive,
+// and up to MaxEntrySize of entry data.  MaxEntrySize matches
+// task.DefaultMaxFileSize.
+var DefaultPrefetchOptions = PrefetchOptions{
+	ChunkSize:    4 * 1024 * 1024,
+	Parallel:     8,
+	Entries:      16,
+	MaxEntrySize: 200 * 1024 * 1024,
+	ChunkRetries: 5,
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// withDefaults returns a copy of the options with zero values replaced by
+// the defaults.
+func (opts PrefetchOptions) withDefaults() PrefetchOptions {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultPrefetchOptions.ChunkSize
+	}
+	if opts.Parallel <= 0 {
+		opts.Parallel = DefaultPrefetchOptions.Parallel
+	}
+	if opts.Entries <= 0 {
+		opts.Entries = DefaultPrefetchOptions.Entries
+	}
+	if opts.MaxEntrySize <= 0 {
+		opts.MaxEntrySize = DefaultPrefetchOptions.MaxEntrySize
+	}
+	if opts.ChunkRetries <= 0 {
+		opts.ChunkRetries = DefaultPrefetchOptions.ChunkRetries
+	}
+	if opts.MaxBuffered <= 0 {
+		opts.MaxBuffered = opts.MaxEntrySize
+	}
+	if opts.NewGzipReader == nil {
+		opts.NewGzipReader = newGzipReader
+	}
+	return opts
+}
+
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// chunkedReader reads an object of known size as a sequence of ranged reads,
+// fetching up to Parallel chunks ahead of the reader.
+type chunkedReader struct {
+	ctx       context.Context
+	rr        RangeReaderFunc
+	size      int64
+	chunkSize int64
+	retries   int
+	label     string
+
+	slots   chan struct{}      // Bounds the chunks in flight or buffered.
+	results []chan chunkResult // One per chunk, each with capacity 1.
+
+	next int    // Index of the next chunk to read.
+	buf  []byte // Unread data from the current chunk.
+	err  error  // Sticky error.
+}
+
+func newChunkedReader(ctx context.Context, rr RangeReaderFunc, size int64, opts PrefetchOptions, label string) *chunkedReader {
+	n := (size + opts.ChunkSize - 1) / opts.ChunkSize
+	cr := &chunkedReader{
+		ctx:       ctx,
+		rr:        rr,
+		size:      size,
+		chunkSize: opts.ChunkSize,
+		retries:   opts.ChunkRetries,
+		label:     label,
+		slots:     make(chan struct{}, opts.Parallel),
+		results:   make([]chan chunkResult, n),
+	}
+	for i := range cr.results {
+		cr.results[i] = make(chan chunkResult, 1)
+	}
+	go cr.fetchAll()
+	return cr
+}
+
+// fetchAll starts a fetch for each chunk, in order, as slots become available.
+func (cr *chunkedReader) fetchAll() {
+	for i := range cr.results {
+		select {
+		case cr.slots <- struct{}{}:
+		case <-cr.ctx.Done():
+			return
+		}
+		go cr.fetch(i)
+	}
+}
+
+// fetch reads a single chunk, retrying with backoff on errors.
+func (cr *chunkedReader) fetch(i int) {
+	offset := int64(i) * cr.chunkSize
+	length := cr.chunkSize
+	if offset+length > cr.size {
+		length = cr.size - offset
+	}
+	var data []byte
+	var err error
+	delay := 16 * time.Millisecond
+	for trial := 1; trial <= cr.retries; trial++ {
+		data, err = cr.fetchOnce(offset, length)
+		if err == nil || cr.ctx.Err() != nil {
+			break
+		}
+		metrics.GCSRetryCount.WithLabelValues(
+			cr.label, "range read", strconv.Itoa(trial), "error").Inc()
+		log.Printf("chunk fetch(%d) at %d: %v\n", trial, offset, err)
+		delay *= 2
+		// Stop waiting if the source is closed.
+		select {
+		case <-cr.ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	if err != nil {
+		err = streamError{err}
+	}
+	cr.results[i] <- chunkResult{data, err}
+}
+
+func (cr *chunkedReader) fetchOnce(offset, length int64) ([]byte, error) {
+	rdr, err := cr.rr(cr.ctx, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// Read implements io.Reader, returning the chunks in order.
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		if cr.next >= len(cr.results) {
+			return 0, io.EOF
+		}
+		select {
+		case res := <-cr.results[cr.next]:
+			<-cr.slots
+			cr.next++
+			cr.buf, cr.err = res.data, res.err
+		case <-cr.ctx.Done():
+			cr.err = cr.ctx.Err()
+		}
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// prefetchEntry is a single tar entry, or the error that ended the archive.
+type prefetchEntry struct {
+	name    string
+	size    int64
+	regular bool
+	data    []byte
+	err     error
+	weight  int64 // Acquired from the buffer limit, and released by the consumer.
+}
+
+// PrefetchSource implements etl.TestSource, reading tar entries ahead of the
+// consumer.  Caller is responsible for calling Close.
+type PrefetchSource struct {
+	FilePath  string
+	TableBase string     // TableBase is BQ table associated with this source, or "invalid".
+	PathDate  civil.Date // Date associated with YYYY/MM/DD in FilePath.
+
+	entries  chan prefetchEntry
+	buffered *semaphore.Weighted // Limits the size of the buffered entries.
+	cancel   func()
+	err      error // The error that ended the archive, returned by all later calls.
+}
+
+// NewPrefetchSource creates a PrefetchSource that reads size bytes using rr,
+// and starts reading ahead immediately.  The archive compression is detected
+// from its content.
+func NewPrefetchSource(ctx context.Context, rr RangeReaderFunc, size int64,
+	dp etl.DataPath, label string, opts PrefetchOptions) (*PrefetchSource, error) {
+	archiveDate, err := time.Parse("2006/01/02", dp.DatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse archive date path: %w", err)
+	}
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	src := &PrefetchSource{
+		FilePath:  dp.URI,
+		TableBase: label,
+		PathDate:  civil.DateOf(archiveDate),
+		entries:   make(chan prefetchEntry, opts.Entries),
+		buffered:  semaphore.NewWeighted(opts.MaxBuffered),
+		cancel:    cancel,
+	}
+	go src.run(ctx, newChunkedReader(ctx, rr, size, opts, label), opts)
+	return src, nil
+}
+
+// run decompresses and reads the archive, sending each entry to the entries
+// channel.  It closes the channel when the archive is finished or canceled.
+func (src *PrefetchSource) run(ctx context.Context, rdr io.Reader, opts PrefetchOptions) {
+	defer close(src.entries)
+
+	br := bufio.NewReader(rdr)
+	// A short archive will return an error, but it is still detected.
+	header, _ := br.Peek(magicLen)
+	rdr = br
+	if c := DetectCompression(header); c != NoCompression {
+		newReader := opts.NewGzipReader
+		if c != Gzip {
+			newReader = func(r io.Reader) (io.ReadCloser, error) { return NewDecompressor(c, r) }
+		}
+		// Decompress in a separate goroutine, so that it overlaps with the
+		// tar parsing and the consumer.
+		pr, pw := io.Pipe()
+		defer pr.Close() // Unblocks the decompressor if we exit early.
+		go func(in io.Reader) {
+			zr, err := newReader(in)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(pw, zr)
+			zr.Close()
+			pw.CloseWithError(err) // A nil error closes normally.
+		}(rdr)
+		rdr = pr
+	}
+
+	tr := tar.NewReader(rdr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		var e prefetchEntry
+		if err != nil {
+			e.err = err
+		} else {
+			e = prefetchEntry{name: h.Name, size: h.Size, regular: h.Typeflag == tar.TypeReg}
+			if e.regular && e.size <= opts.MaxEntrySize {
+				// Wait until there is room to buffer the entry.
+				e.weight = e.size
+				if e.weight > opts.MaxBuffered {
+					e.weight = opts.MaxBuffered
+				}
+				if src.buffered.Acquire(ctx, e.weight) != nil {
+					return
+				}
+				e.data, e.err = ioutil.ReadAll(tr)
+			}
+		}
+		select {
+		case src.entries <- e:
+		case <-ctx.Done():
+			return
+		}
+		if e.err != nil {
+			return
+		}
+	}
+}
+
+// NextTest reads the next test object from the tar file.
+// Skips reading contents of any file larger than maxSize, returning empty data
+// and storage.ErrOversizeFile.
+// Compressed entries, such as *.json.gz files, are returned as is, so that
+// Task can decompress them within its InflateBudget.
+// Errors in the archive content, rather than reading it, are returned as
+// ErrCorruptArchive.
+// Returns io.EOF when there are no more tests.
+func (src *PrefetchSource) NextTest(maxSize int64) (string, []byte, error) {
+	if src.err != nil {
+		return "", nil, src.err
+	}
+	metrics.WorkerState.WithLabelValues(src.TableBase, "read").Inc()
+	defer metrics.WorkerState.WithLabelValues(src.TableBase, "read").Dec()
+
+	e, ok := <-src.entries
+	if !ok {
+		src.err = io.EOF
+		return "", nil, src.err
+	}
+	src.buffered.Release(e.weight)
+	if e.err != nil {
+		log.Printf("prefetch %s: %v\n", src.FilePath, e.err)
+		src.err = e.err
+		if !isTransient(e.err) {
+			src.err = corruptArchive(e.err)
+		}
+		return "", nil, src.err
+	}
+	if e.size > maxSize || (e.regular && e.data == nil && e.size > 0) {
+		return e.name, nil, ErrOversizeFile
+	}
+	return e.name, e.data, nil
+}
+
+// Close stops the read-ahead, and waits for the reader to finish.
+func (src *PrefetchSource) Close() error {
+	src.cancel()
+	for range src.entries {
+	}
+	return nil
+}
+
+// Type returns a string for use in metrics and logs.
+func (src *PrefetchSource) Type() string {
+	return src.TableBase
+}
+
+// Detail returns a string for use in logs.
+func (src *PrefetchSource) Detail() string {
+	return src.FilePath
+}
+
+// Date returns a civil.Date associated with the archive path.
+func (src *PrefetchSource) Date() civil.Date {
+	return src.PathDate
+}
+
+// NewGCSPrefetchSource creates a PrefetchSource for a GCS tar or tgz file.
+// Caller is responsible for calling Close on the returned object.
+func NewGCSPrefetchSource(ctx context.Context, client *gcs.Client, dp etl.DataPath,
+	label string, opts PrefetchOptions) (etl.TestSource, error) {
+	if client == nil {
+		return nil, errNoClient
+	}
+	if !strings.HasPrefix(dp.URI, "gs://") {
+		return nil, errors.New("invalid file path: " + dp.URI)
+	}
+	parts := strings.SplitN(dp.URI, "/", 4)
+	if len(parts) != 4 {
+		return nil, errors.New("invalid file path: " + dp.URI)
+	}
+	fn := parts[3]
+	if !etl.IsArchive(fn) {
+		return nil, errors.New("not a tar archive: " + dp.URI)
+	}
+
+	obj := client.Bucket(parts[2]).Object(fn)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rr := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return obj.NewRangeReader(ctx, offset, length)
+	}
+	return NewPrefetchSource(ctx, rr, attrs.Size, dp, label, opts)
+}
+
+type gcsPrefetchSourceFactory struct {
+	client *gcs.Client
+	opts   PrefetchOptions
+}
+
+// Get implements SourceFactory.Get
+func (sf *gcsPrefetchSourceFactory) Get(ctx context.Context, dp etl.DataPath) (etl.TestSource, etl.ProcessingError) {
+	label := dp.TableBase()
+	if dp.GetDataType() == etl.INVALID {
+		return nil, factory.NewError(dp.DataType, "InvalidDatatype",
+			http.StatusInternalServerError, etl.ErrBadDataType)
+	}
+
+	// The source outlives the Get call, so it must not use the request context.
+	tr, err := NewGCSPrefetchSource(context.Background(), sf.client, dp, label, sf.opts)
+	if err != nil {
+		log.Printf("Error opening gcs file: %v", err)
+		return nil, factory.NewError(dp.DataType, "ETLSourceError",
+			sourceErrorStatus(err),
+			fmt.Errorf("ETLSourceError %w", err))
+	}
+	return tr, nil
+}
+
+// GCSPrefetchSourceFactory returns a SourceFactory that creates PrefetchSources.
+func GCSPrefetchSourceFactory(c *gcs.Client, opts PrefetchOptions) factory.SourceFactory {
+	return &gcsPrefetchSourceFactory{c, opts}
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/m-lab/go/rtx"
+
+	"github.com/m-lab/etl/etl"
+)
+
+var ndtTgz = "ndt/2018/05/09/20180509T101913Z-mlab1-mad03-ndt-0000.tgz"
+
+// ndtArchives returns the contents of the archives in testfiles/ndt.tar.
+func ndtArchives(t testing.TB) map[string][]byte {
+	f, err := os.Open("../testfiles/ndt.tar")
+	rtx.Must(err, "opening tar file")
+	defer f.Close()
+	archives := map[string][]byte{}
+	tf := tar.NewReader(f)
+	for h, err := tf.Next(); err != io.EOF; h, err = tf.Next() {
+		rtx.Must(err, "reading tar file")
+		if h.Typeflag == tar.TypeReg {
+			data, err := ioutil.ReadAll(tf)
+			rtx.Must(err, "reading", h.Name)
+			archives[h.Name] = data
+		}
+	}
+	return archives
+}
+
+// flakyRanges serves ranged reads from a byte slice, failing the first
+// attempt for each offset.
+type flakyRanges struct {
+	data []byte
+
+	lock   sync.Mutex
+	failed map[int64]bool
+}
+
+func (fr *flakyRanges) read(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	if !fr.failed[offset] {
+		fr.failed[offset] = true
+		return nil, errors.New("stream error")
+	}
+	return ioutil.NopCloser(bytes.NewReader(fr.data[offset : offset+length])), nil
+}
+
+func TestChunkedReader(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fr := &flakyRanges{data: data, failed: map[int64]bool{}}
+	opts := PrefetchOptions{ChunkSize: 333, Parallel: 3}.withDefaults()
+	cr := newChunkedReader(context.Background(), fr.read, int64(len(data)), opts, "test")
+	got, err := ioutil.ReadAll(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("Data mismatch")
+	}
+	if len(fr.failed) != 31 {
+		t.Error("Expected 31 chunks, got", len(fr.failed))
+	}
+}
+
+// serialTests reads all tests from an archive with a GCSSource.
+func serialTests(t *testing.T, archive []byte) map[string][]byte {
+	zr, err := gzip.NewReader(bytes.NewReader(archive))
+	rtx.Must(err, "gzip")
+	src := &GCSSource{TarReader: tar.NewReader(zr), Closer: zr}
+	defer src.Close()
+	tests := map[string][]byte{}
+	for name, data, err := src.NextTest(1000000); err != io.EOF; name, data, err = src.NextTest(1000000) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests[name] = data
+	}
+	return tests
+}
+
+func TestPrefetchSource(t *testing.T) {
+	archives := ndtArchives(t)
+	for fn, archive := range archives {
+		dp, err := etl.ValidateTestPath("gs://fake-bucket/" + fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := serialTests(t, archive)
+
+		fr := &flakyRanges{data: archive, failed: map[int64]bool{}}
+		opts := PrefetchOptions{ChunkSize: 1000, Parallel: 4, Entries: 2}
+		src, err := NewPrefetchSource(context.Background(), fr.read, int64(len(archive)), dp, "label", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for name, data, err := src.NextTest(1000000); err != io.EOF; name, data, err = src.NextTest(1000000) {
+			if err != nil {
+				t.Fatal(fn, err)
+			}
+			if !bytes.Equal(data, want[name]) {
+				t.Error("Data mismatch for", fn, name)
+			}
+			count++
+		}
+		if count != len(want) {
+			t.Error(fn, "expected", len(want), "tests, got", count)
+		}
+		src.Close()
+	}
+}
+
+func TestPrefetchSourceOversize(t *testing.T) {
+	archive := ndtArchives(t)[ndtTgz]
+	dp, err := etl.ValidateTestPath("gs://fake-bucket/" + ndtTgz)
+	rtx.Must(err, "bad path")
+	rr := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(archive[offset : offset+length])), nil
+	}
+
+	// Oversize entries are reported, and the remaining entries are still read.
+	src, err := NewPrefetchSource(context.Background(), rr, int64(len(archive)), dp, "label", PrefetchOptions{})
+	rtx.Must(err, "NewPrefetchSource")
+	oversize := 0
+	for _, _, err := src.NextTest(10); err != io.EOF; _, _, err = src.NextTest(10) {
+		if err != ErrOversizeFile {
+			t.Fatal("Expected ErrOversizeFile", err)
+		}
+		oversize++
+	}
+	if oversize == 0 {
+		t.Error("Expected oversize files")
+	}
+	src.Close()
+
+	// Closing early should not block.
+	src, err = NewPrefetchSource(context.Background(), rr, int64(len(archive)), dp, "label", PrefetchOptions{ChunkSize: 10, Entries: 1})
+	rtx.Must(err, "NewPrefetchSource")
+	src.Close()
+	if _, _, err := src.NextTest(10); err == nil {
+		t.Error("Expected error after Close")
+	}
+}
+
+func TestGCSPrefetchSourceFactory(t *testing.T) {
+	server := loadFromTar(fakestorage.NewServer([]fakestorage.Object{}),
+		"fake-bucket", tar.NewReader(bytes.NewReader(mustRead("../testfiles/ndt.tar"))))
+	defer server.Stop()
+	f := GCSPrefetchSourceFactory(server.Client(), PrefetchOptions{ChunkSize: 128})
+
+	dp, err := etl.ValidateTestPath("gs://fake-bucket/" + ndtTgz)
+	rtx.Must(err, "bad path")
+	src, pErr := f.Get(context.Background(), dp)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	defer src.Close()
+	name, data, err := src.NextTest(1000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(name, "2018/05/09/") || len(data) == 0 {
+		t.Error("Unexpected first test", name, len(data))
+	}
+}
+
+func mustRead(fn string) []byte {
+	data, err := ioutil.ReadFile(fn)
+	rtx.Must(err, "reading", fn)
+	return data
+}
+
+// readAll reads all tests from the source, and closes it.
+func readAll(b *testing.B, src etl.TestSource) {
+	defer src.Close()
+	for _, _, err := src.NextTest(100000000); err != io.EOF; _, _, err = src.NextTest(100000000) {
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkSource reads every archive in testfiles/ndt.tar from a fake GCS
+// server, using the source created by newSource.
+func benchmarkSource(b *testing.B, newSource func(*fakestorage.Server, etl.DataPath) (etl.TestSource, error)) {
+	server := loadFromTar(fakestorage.NewServer([]fakestorage.Object{}),
+		"fake-bucket", tar.NewReader(bytes.NewReader(mustRead("../testfiles/ndt.tar"))))
+	defer server.Stop()
+	paths := []etl.DataPath{}
+	for fn := range ndtArchives(b) {
+		dp, err := etl.ValidateTestPath("gs://fake-bucket/" + fn)
+		rtx.Must(err, "bad path")
+		paths = append(paths, dp)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, dp := range paths {
+			src, err := newSource(server, dp)
+			if err != nil {
+				b.Fatal(err)
+			}
+			readAll(b, src)
+		}
+	}
+}
+
+func BenchmarkSerialSource(b *testing.B) {
+	benchmarkSource(b, func(server *fakestorage.Server, dp etl.DataPath) (etl.TestSource, error) {
+		return NewTestSource(server.Client(), dp, "label")
+	})
+}
+
+func BenchmarkPrefetchSource(b *testing.B) {
+	opts := PrefetchOptions{ChunkSize: 16 * 1024}
+	benchmarkSource(b, func(server *fakestorage.Server, dp etl.DataPath) (etl.TestSource, error) {
+		return NewGCSPrefetchSource(context.Background(), server.Client(), dp, "label", opts)
+	})
+}
+
+func TestPrefetchSourceErrors(t *testing.T) {
+	archive := ndtArchives(t)[ndtTgz]
+	dp, err := etl.ValidateTestPath("gs://fake-bucket/" + ndtTgz)
+	rtx.Must(err, "bad path")
+
+	// A truncated archive is corrupt.
+	truncated := archive[:len(archive)/2]
+	rr := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(truncated[offset : offset+length])), nil
+	}
+	src, err := NewPrefetchSource(context.Background(), rr, int64(len(truncated)), dp, "label", PrefetchOptions{})
+	rtx.Must(err, "NewPrefetchSource")
+	for _, _, err = src.NextTest(1000000); err == nil; _, _, err = src.NextTest(1000000) {
+	}
+	if !errors.Is(err, ErrCorruptArchive) {
+		t.Error("Expected ErrCorruptArchive, got", err)
+	}
+	src.Close()
+
+	// Read failures are not.
+	failing := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return nil, errors.New("service unavailable")
+	}
+	src, err = NewPrefetchSource(context.Background(), failing, int64(len(archive)), dp, "label",
+		PrefetchOptions{ChunkRetries: 1})
+	rtx.Must(err, "NewPrefetchSource")
+	if _, _, err = src.NextTest(1000000); err == nil || errors.Is(err, ErrCorruptArchive) {
+		t.Error("Expected read error, got", err)
+	}
+	src.Close()
+}
+
+func TestPrefetchSourceMaxBuffered(t *testing.T) {
+	archive := ndtArchives(t)[ndtTgz]
+	dp, err := etl.ValidateTestPath("gs://fake-bucket/" + ndtTgz)
+	rtx.Must(err, "bad path")
+	rr := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(archive[offset : offset+length])), nil
+	}
+	want := serialTests(t, archive)
+
+	// Every entry is larger than the limit, so only one is buffered at a time,
+	// but all of them are still read.
+	src, err := NewPrefetchSource(context.Background(), rr, int64(len(archive)), dp, "label",
+		PrefetchOptions{Entries: 16, MaxBuffered: 1})
+	rtx.Must(err, "NewPrefetchSource")
+	defer src.Close()
+	count := 0
+	for name, data, err := src.NextTest(1000000); err != io.EOF; name, data, err = src.NextTest(1000000) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want[name]) {
+			t.Error("Data mismatch for", name)
+		}
+		count++
+	}
+	if count != len(want) {
+		t.Error("Expected", len(want), "tests, got", count)
+	}
+	// Everything acquired for buffering should have been released.
+	if !src.buffered.TryAcquire(1) {
+		t.Error("Buffer limit was not released")
+	}
+}
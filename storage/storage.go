@@ -8,13 +8,14 @@ package storage
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -32,6 +33,36 @@ import (
 // ErrOversizeFile is returned when exceptionally large files are skipped.
 var ErrOversizeFile = errors.New("Oversize file")
 
+// ErrCorruptArchive is returned when an archive can't be read because of its
+// content, such as a bad tar header or a truncated compressed stream.  Unlike
+// stream errors, these recur if the archive is read again.
+var ErrCorruptArchive = errors.New("corrupt archive")
+
+// streamError marks an error from reading the GCS object, as opposed to an
+// error in its content.
+type streamError struct{ error }
+
+func (e streamError) Unwrap() error { return e.error }
+
+// isTransient returns true for errors from the GCS stream or network, which
+// may not recur if the archive is read again.
+func isTransient(err error) bool {
+	var se streamError
+	var netErr net.Error
+	if errors.As(err, &se) || errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "stream error") ||
+		strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "broken pipe")
+}
+
+// corruptArchive wraps an archive content error with ErrCorruptArchive.
+func corruptArchive(err error) error {
+	return fmt.Errorf("%w: %s", ErrCorruptArchive, err)
+}
+
 // TarReader provides Next and Read functions.
 type TarReader interface {
 	Next() (*tar.Header, error)
@@ -46,74 +77,151 @@ type GCSSource struct {
 	RetryBaseTime time.Duration // The base time for backoff and retry.
 	TableBase     string        // TableBase is BQ table associated with this source, or "invalid".
 	PathDate      civil.Date    // Date associated with YYYY/MM/DD in FilePath.
+
+	// Fields used to resume reading after stream errors.  If open is nil,
+	// the source can't be resumed.
+	open        func(offset int64) (io.ReadCloser, func(), error)
+	compression Compression     // Archive compression, detected when opened at offset 0.
+	counter     *countingReader // Counts bytes read from the GCS stream.
+	buffered    *bufio.Reader   // Buffers the stream for detecting compression, or nil.
+	offset      int64           // Offset of the next unprocessed entry, for uncompressed tars.
+	dataStart   int64           // Offset of the current entry's data.
+	entries     int             // Number of entries completely processed.
+	resumes     int             // Number of times the source has been resumed.
+}
+
+// MaxResumes limits the number of times a GCSSource reopens an archive after
+// stream errors.
+var MaxResumes = 5
+
+var errNotResumable = errors.New("source is not resumable")
+
+// countingReader counts the bytes read through it, starting from an offset.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// reset opens the archive at offset, and sets up the tar reader.  The
+// compression format is detected when the archive is opened at the start.
+func (src *GCSSource) reset(offset int64) error {
+	rdr, cancel, err := src.open(offset)
+	if err != nil {
+		cancel()
+		return err
+	}
+	closer := &Closer{nil, rdr, cancel}
+	src.counter = &countingReader{rdr, offset}
+	src.buffered = nil
+	var r io.Reader = src.counter
+	if offset == 0 {
+		src.buffered = bufio.NewReader(src.counter)
+		// A short archive will return an error, but it is still detected.
+		header, _ := src.buffered.Peek(magicLen)
+		src.compression = DetectCompression(header)
+		r = src.buffered
+	}
+	if src.compression != NoCompression {
+		zipper, err := NewDecompressor(src.compression, r)
+		if err != nil {
+			closer.Close()
+			return err
+		}
+		closer.zipper = zipper
+		r = zipper
+	}
+	src.TarReader = tar.NewReader(r)
+	src.Closer = closer
+	return nil
+}
+
+// position returns the offset in the archive of the next byte the tar reader
+// will read.  It is only meaningful for uncompressed archives.
+func (src *GCSSource) position() int64 {
+	if src.buffered != nil {
+		return src.counter.n - int64(src.buffered.Buffered())
+	}
+	return src.counter.n
+}
+
+// resume reopens the archive after a stream error.  Uncompressed tars are
+// reopened with a range read at the last complete entry.  Compressed tars must
+// be read from the beginning, so the entries already processed are skipped.
+func (src *GCSSource) resume() error {
+	if src.open == nil || src.resumes >= MaxResumes {
+		return errNotResumable
+	}
+	src.resumes++
+	src.Closer.Close()
+	// Back off a little, in case GCS is having problems.
+	time.Sleep(src.RetryBaseTime << uint(src.resumes))
+
+	offset, skip := src.offset, 0
+	if src.compression != NoCompression {
+		offset, skip = 0, src.entries
+	}
+	err := src.reset(offset)
+	for i := 0; err == nil && i < skip; i++ {
+		_, err = src.Next()
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	metrics.GCSRetryCount.WithLabelValues(
+		src.TableBase, "resume", strconv.Itoa(src.resumes), status).Inc()
+	log.Printf("Resumed %s at offset %d, skipping %d entries: %v\n", src.FilePath, offset, skip, err)
+	return err
 }
 
 // Retrieve next file header.
 // Lots of error handling because of common faults in underlying GCS.
+// Returns the header, and on error, whether the error is transient, so that
+// reading may be retried or resumed.  Other errors are ErrCorruptArchive.
 func (src *GCSSource) nextHeader(trial int) (*tar.Header, bool, error) {
 	h, err := src.Next()
-	if err != nil {
-		if err == io.EOF {
-			return nil, false, err
-		} else if strings.Contains(err.Error(), "unexpected EOF") {
-			metrics.GCSRetryCount.WithLabelValues(
-				src.TableBase, "next", strconv.Itoa(trial), "unexpected EOF").Inc()
-			// TODO: These are likely unrecoverable, so we should
-			// just return.
-		} else {
-			// Quite a few of these now, and they seem to be
-			// unrecoverable.
-			metrics.GCSRetryCount.WithLabelValues(
-				src.TableBase, "next", strconv.Itoa(trial), "other").Inc()
-		}
-		log.Printf("nextHeader: %v\n", err)
+	if err == nil || err == io.EOF {
+		return h, false, err
 	}
-	return h, true, err
+	log.Printf("nextHeader: %v\n", err)
+	if isTransient(err) {
+		metrics.GCSRetryCount.WithLabelValues(
+			src.TableBase, "next", strconv.Itoa(trial), "stream error").Inc()
+		return nil, true, err
+	}
+	// Bad headers and unexpected EOF are deterministic, so retrying or
+	// re-reading the archive won't help.
+	metrics.GCSRetryCount.WithLabelValues(
+		src.TableBase, "next", strconv.Itoa(trial), "corrupt archive").Inc()
+	return nil, false, corruptArchive(err)
 }
 
 // Retrieve the data for a single file.
 // Lots of error handling because of common faults in underlying GCS.
 // Returns data in byte array, error and boolean regarding whether to retry.
 func (src *GCSSource) nextData(h *tar.Header, trial int) ([]byte, bool, error) {
-	var data []byte
-	var err error
-	var phase string
-	if strings.HasSuffix(strings.ToLower(h.Name), "gz") {
-		// TODO add unit test
-		var zipReader *gzip.Reader
-		zipReader, err = gzip.NewReader(src)
-		if err != nil {
-			if err == io.EOF {
-				return nil, false, err
-			}
-			metrics.GCSRetryCount.WithLabelValues(
-				src.TableBase, "open zip", strconv.Itoa(trial), "zipReaderError").Inc()
-			log.Printf("zipReaderError(%d): %v in file %s\n", trial, err, h.Name)
-			return nil, true, err
-		}
-		defer zipReader.Close()
-		phase = "read zip"
-		data, err = ioutil.ReadAll(zipReader)
-	} else {
-		phase = "read"
-		data, err = ioutil.ReadAll(src)
-	}
+	phase := "read"
+	data, err := ioutil.ReadAll(src)
 	if err != nil {
-		// These errors seem to be recoverable, at least with zip files.
-		if strings.Contains(err.Error(), "stream error") {
+		log.Printf("nextData(%d): %v\n", trial, err)
+		if isTransient(err) {
 			// We are seeing these very rarely, maybe 1 per hour.
 			// They are non-deterministic, so probably related to GCS problems.
 			metrics.GCSRetryCount.WithLabelValues(
 				src.TableBase, phase, strconv.Itoa(trial), "stream error").Inc()
-		} else {
-			// We haven't seen any of these so far (as of May 9)
-			metrics.GCSRetryCount.WithLabelValues(
-				src.TableBase, phase, strconv.Itoa(trial), "other error").Inc()
+			return nil, true, err
 		}
-		log.Printf("nextData(%d): %v\n", trial, err)
-		return nil, true, err
+		// A truncated entry or compressed stream is not recoverable.
+		metrics.GCSRetryCount.WithLabelValues(
+			src.TableBase, phase, strconv.Itoa(trial), "corrupt archive").Inc()
+		return nil, false, corruptArchive(err)
 	}
-
 	return data, false, nil
 }
 
@@ -135,11 +243,33 @@ func (src *GCSSource) Date() civil.Date {
 // NextTest reads the next test object from the tar file.
 // Skips reading contents of any file larger than maxSize, returning empty data
 // and storage.ErrOversizeFile.
+// Compressed entries, such as *.json.gz files, are returned as is, so that
+// Task can decompress them within its InflateBudget.
+// If the GCS stream fails, the archive is reopened, and reading resumes after
+// the last complete entry.  Errors in the archive content are returned as
+// ErrCorruptArchive, without reopening the archive.
 // Returns io.EOF when there are no more tests.
 func (src *GCSSource) NextTest(maxSize int64) (string, []byte, error) {
 	metrics.WorkerState.WithLabelValues(src.TableBase, "read").Inc()
 	defer metrics.WorkerState.WithLabelValues(src.TableBase, "read").Dec()
 
+	for {
+		name, data, failed, err := src.nextTest(maxSize)
+		if !failed {
+			return name, data, err
+		}
+		// Resuming may itself fail, so keep trying until MaxResumes.
+		for rErr := src.resume(); rErr != nil; rErr = src.resume() {
+			if rErr == errNotResumable {
+				return name, data, err
+			}
+		}
+	}
+}
+
+// nextTest reads the next test object, and also returns whether the stream
+// failed, so that the caller may resume.
+func (src *GCSSource) nextTest(maxSize int64) (string, []byte, bool, error) {
 	// Try to get the next file.  We retry multiple times, because sometimes
 	// GCS stalls and produces stream errors.
 	var err error
@@ -158,33 +288,42 @@ func (src *GCSSource) NextTest(maxSize int64) (string, []byte, error) {
 		if err == nil {
 			break
 		}
-		if !retry || trial >= 10 {
-			return "", nil, err
+		// The tar reader keeps returning the same error, so if we can,
+		// we reopen the stream instead of retrying.
+		if src.open != nil || !retry || trial >= 10 {
+			return "", nil, retry, err
 		}
 		// For each trial, increase backoff delay by 2x.
 		delay *= 2
 		time.Sleep(delay)
 	}
 
+	if src.counter != nil {
+		// The tar reader has read exactly up to the start of the data.
+		src.dataStart = src.position()
+	}
+
 	if h.Size > maxSize {
-		return h.Name, data, ErrOversizeFile
+		src.completed(h)
+		return h.Name, data, false, ErrOversizeFile
 	}
 
 	// Only process regular files.
 	if h.Typeflag != tar.TypeReg {
-		return h.Name, data, nil
+		src.completed(h)
+		return h.Name, data, false, nil
 	}
 
 	trial = 0
 	delay = src.RetryBaseTime
+	var retry bool
 	for {
 		trial++
-		var retry bool
 		data, retry, err = src.nextData(h, trial)
 		if err == nil {
 			break
 		}
-		if !retry || trial >= 10 {
+		if src.open != nil || !retry || trial >= 10 {
 			// FYI, it appears that stream errors start in the
 			// nextData phase of reading, but then persist on
 			// the next call to nextHeader.
@@ -194,18 +333,36 @@ func (src *GCSSource) NextTest(maxSize int64) (string, []byte, error) {
 		delay *= 2
 		time.Sleep(delay)
 	}
+	if err != nil && retry && src.open != nil {
+		// The entry is not completed, so it will be read again on resume.
+		return h.Name, nil, true, err
+	}
 
-	return h.Name, data, nil
+	src.completed(h)
+	if errors.Is(err, ErrCorruptArchive) {
+		return h.Name, nil, false, err
+	}
+	return h.Name, data, false, nil
+}
+
+// completed records that an entry has been processed, so that it is skipped
+// if the source is resumed.  It must be called before reading the next header.
+func (src *GCSSource) completed(h *tar.Header) {
+	src.entries++
+	if src.counter != nil && src.compression == NoCompression {
+		// Entry data is padded to 512 byte blocks.
+		src.offset = src.dataStart + (h.Size+511)&^511
+	}
 }
 
-// Closer handles gzip files.
+// Closer handles compressed files.
 type Closer struct {
 	zipper io.Closer // Must be non-null
 	rdr    io.Closer // Must be non-null
 	cancel func()    // Context cancel.
 }
 
-// Close invokes the gzip and body Close() functions.
+// Close invokes the decompressor and body Close() functions.
 func (t *Closer) Close() error {
 	defer t.cancel()
 	var err error
@@ -223,7 +380,9 @@ var errNoClient = errors.New("client should be non-null")
 // NewTestSource creates an TestSource suitable for injecting into Task.
 // Caller is responsible for calling Close on the returned object.
 //
-// uri should be of form gs://bucket/filename.tar or gs://bucket/filename.tgz
+// uri should be of form gs://bucket/filename.tar or gs://bucket/filename.tgz,
+// or another archive suffix accepted by etl.ValidateTestPath.  The archive may
+// be compressed with gzip, zstd, bzip2 or xz, which is detected from content.
 // FYI Using a persistent client saves about 80 msec, and 220 allocs, totalling 70kB.
 func NewTestSource(client *gcs.Client, dp etl.DataPath, label string) (etl.TestSource, error) {
 	if client == nil {
@@ -245,48 +404,31 @@ func NewTestSource(client *gcs.Client, dp etl.DataPath, label string) (etl.TestS
 		return nil, fmt.Errorf("failed to parse archive date path: %w", err)
 	}
 
-	// TODO - consider just always testing for valid gzip file.
-	if !(strings.HasSuffix(fn, ".tgz") || strings.HasSuffix(fn, ".tar") ||
-		strings.HasSuffix(fn, ".tar.gz")) {
-		return nil, errors.New("not tar or tgz: " + dp.URI)
+	// The compression is detected from the content, but we check the suffix
+	// to avoid opening files that aren't archives at all.
+	if !etl.IsArchive(fn) {
+		return nil, errors.New("not a tar archive: " + dp.URI)
 	}
 
 	// TODO(prod) Evaluate whether this is long enough.
 	// TODO - appengine requests time out after 60 minutes, so more than that doesn't help.
 	// SS processing sometimes times out with 1 hour.
 	// Is there a limit on http requests from task queue, or into flex instance?
-	rdr, cancel, err := getReader(client, bucket, fn, 300*time.Minute)
-	if err != nil {
-		cancel()
-		log.Println(err)
-		return nil, err
+	open := func(offset int64) (io.ReadCloser, func(), error) {
+		return getRangeReader(client, bucket, fn, offset, 300*time.Minute)
 	}
 
-	closer := &Closer{nil, rdr, cancel}
-	// Handle .tar.gz, .tgz files.
-	if strings.HasSuffix(strings.ToLower(fn), "gz") {
-		// TODO add unit test
-		// NB: This must not be :=, or it creates local rdr.
-		// TODO - add retries with backoff.
-		gzRdr, err := gzip.NewReader(rdr)
-		if err != nil {
-			closer.Close()
-			log.Println(err)
-			return nil, err
-		}
-		closer.zipper = gzRdr
-		rdr = gzRdr
-	}
-	tarReader := tar.NewReader(rdr)
-
 	baseTimeout := 16 * time.Millisecond
 	gcs := &GCSSource{
 		FilePath:      dp.URI,
-		TarReader:     tarReader,
-		Closer:        closer,
 		RetryBaseTime: baseTimeout,
 		TableBase:     label,
 		PathDate:      civil.DateOf(archiveDate),
+		open:          open,
+	}
+	if err := gcs.reset(0); err != nil {
+		log.Println(err)
+		return nil, err
 	}
 	return gcs, nil
 }
@@ -329,13 +471,23 @@ func (sf *gcsSourceFactory) Get(ctx context.Context, dp etl.DataPath) (etl.TestS
 		log.Printf("Error opening gcs file: %v", err)
 		// TODO - anything better we could do here?
 		return nil, factory.NewError(dp.DataType, "ETLSourceError",
-			http.StatusInternalServerError,
+			sourceErrorStatus(err),
 			fmt.Errorf("ETLSourceError %w", err))
 	}
 
 	return tr, nil
 }
 
+// sourceErrorStatus returns the http status for an archive that could not be
+// opened.  A missing object will still be missing on retry, so it is reported
+// as not found, rather than as a transient error.
+func sourceErrorStatus(err error) int {
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
 // GCSSourceFactory returns the default SourceFactory
 func GCSSourceFactory(c *gcs.Client) factory.SourceFactory {
 	return &gcsSourceFactory{c}
@@ -347,10 +499,15 @@ func GCSSourceFactory(c *gcs.Client) factory.SourceFactory {
 
 // Caller is responsible for closing response body.
 func getReader(client *gcs.Client, bucket string, fn string, timeout time.Duration) (io.ReadCloser, func(), error) {
+	return getRangeReader(client, bucket, fn, 0, timeout)
+}
+
+// getRangeReader returns a reader for the object, starting at offset.
+// Caller is responsible for closing response body.
+func getRangeReader(client *gcs.Client, bucket string, fn string, offset int64, timeout time.Duration) (io.ReadCloser, func(), error) {
 	// Lightweight - only setting up the local object.
-	b := client.Bucket(bucket)
-	obj := b.Object(fn)
+	obj := client.Bucket(bucket).Object(fn)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	rdr, err := obj.NewReader(ctx)
+	rdr, err := obj.NewRangeReader(ctx, offset, -1)
 	return rdr, cancel, err
 }
@@ -2,9 +2,13 @@ package storage
 
 import (
 	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"testing"
 	"time"
@@ -218,3 +222,135 @@ func TestSourceFactory(t *testing.T) {
 		t.Error("Expected 100, got", n)
 	}
 }
+
+// brokenReader returns a stream error after n bytes.
+type brokenReader struct {
+	io.Reader
+	n int
+}
+
+func (br *brokenReader) Read(p []byte) (int, error) {
+	if br.n <= 0 {
+		return 0, errors.New("stream error: stream ID 801; INTERNAL_ERROR")
+	}
+	if len(p) > br.n {
+		p = p[:br.n]
+	}
+	n, err := br.Reader.Read(p)
+	br.n -= n
+	return n, err
+}
+
+// flakySource returns a GCSSource for the archive whose stream breaks
+// at each of the failAt offsets, relative to where each open starts.
+func flakySource(t *testing.T, archive []byte, failAt ...int) (*GCSSource, *[]int64) {
+	offsets := []int64{}
+	open := func(offset int64) (io.ReadCloser, func(), error) {
+		offsets = append(offsets, offset)
+		var r io.Reader = bytes.NewReader(archive[offset:])
+		if len(offsets) <= len(failAt) {
+			r = &brokenReader{r, failAt[len(offsets)-1]}
+		}
+		return ioutil.NopCloser(r), func() {}, nil
+	}
+	src := &GCSSource{RetryBaseTime: time.Millisecond, TableBase: "label", open: open}
+	rtx.Must(src.reset(0), "reset")
+	return src, &offsets
+}
+
+func TestGCSSourceResume(t *testing.T) {
+	tgz := mustRead("testdata/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt.tgz")
+	zr, err := gzip.NewReader(bytes.NewReader(tgz))
+	rtx.Must(err, "gzip")
+	tarData, err := ioutil.ReadAll(zr)
+	rtx.Must(err, "gunzip")
+	want := serialTests(t, tgz)
+
+	tests := []struct {
+		name    string
+		archive []byte
+		gzipped bool
+	}{
+		{"tar", tarData, false},
+		{"tgz", tgz, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := len(tt.archive)
+			src, offsets := flakySource(t, tt.archive, n/3, n/4, 1000)
+			count := 0
+			for name, data, err := src.NextTest(1000000); err != io.EOF; name, data, err = src.NextTest(1000000) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, want[name]) {
+					t.Error("Data mismatch for", name)
+				}
+				count++
+			}
+			if count != len(want) {
+				t.Error("Expected", len(want), "tests, got", count)
+			}
+			if len(*offsets) != 4 {
+				t.Fatal("Expected 4 opens", *offsets)
+			}
+			for i, offset := range (*offsets)[1:] {
+				if tt.gzipped && offset != 0 {
+					t.Error("gzip should restart at 0", offset)
+				}
+				if !tt.gzipped && (offset == 0 || offset%512 != 0 || offset < (*offsets)[i]) {
+					t.Error("Bad resume offset", *offsets)
+				}
+			}
+		})
+	}
+
+	// Too many failures should eventually return an error.
+	src, _ := flakySource(t, tgz, 100, 100, 100, 100, 100, 100, 100)
+	if _, _, err := src.NextTest(1000000); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestGCSSourceCorrupt(t *testing.T) {
+	tgz := mustRead("testdata/20200318T003853.425987Z-ndt7-mlab3-syd03-ndt.tgz")
+	zr, err := gzip.NewReader(bytes.NewReader(tgz))
+	rtx.Must(err, "gzip")
+	tarData, err := ioutil.ReadAll(zr)
+	rtx.Must(err, "gunzip")
+	badHeader := append([]byte{}, tarData...)
+	copy(badHeader[148:156], "garbage!") // The checksum of the first header.
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"truncated-tgz", tgz[:len(tgz)/2]},
+		{"truncated-tar", tarData[:len(tarData)/2+100]},
+		{"bad-header", badHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, offsets := flakySource(t, tt.archive)
+			var err error
+			for _, _, err = src.NextTest(1000000); err == nil; _, _, err = src.NextTest(1000000) {
+			}
+			if !errors.Is(err, ErrCorruptArchive) {
+				t.Error("Expected ErrCorruptArchive, got", err)
+			}
+			// Corrupt archives should not be read again.
+			if len(*offsets) != 1 {
+				t.Error("Expected 1 open, got", *offsets)
+			}
+		})
+	}
+}
+
+func TestSourceErrorStatus(t *testing.T) {
+	if code := sourceErrorStatus(gcs.ErrObjectNotExist); code != http.StatusNotFound {
+		t.Error("Missing object should be not found, got", code)
+	}
+	if code := sourceErrorStatus(errors.New("stream error")); code != http.StatusInternalServerError {
+		t.Error("Other errors should be retried, got", code)
+	}
+}
@@ -40,6 +40,16 @@ type Task struct {
 
 	meta        map[string]bigquery.Value // Metadata about this task.
 	maxFileSize int64                     // Max file size to avoid OOM.
+	inflate     *storage.InflateBudget    // Limits decompressed sizes to avoid OOM.
+	finisher    Finisher                  // Optional, called when the task completes.
+}
+
+// Finisher is implemented by sinks that make a task's rows visible only when
+// the whole task completes, e.g. a bq.StreamSink using a pending stream.
+type Finisher interface {
+	// Finish commits the task's rows if err is nil, and discards them
+	// otherwise.  It returns an error if the rows could not be committed.
+	Finish(err error) error
 }
 
 // NewTask constructs a task, injecting the source and the parser.
@@ -50,7 +60,8 @@ func NewTask(filename string, src etl.TestSource, prsr etl.Parser) *Task {
 	meta["parse_time"] = time.Now()
 	meta["attempt"] = 1
 	meta["date"] = src.Date()
-	t := Task{src, prsr, meta, DefaultMaxFileSize}
+	t := Task{src, prsr, meta, DefaultMaxFileSize,
+		storage.NewInflateBudget(storage.DefaultMaxInflatedSize, storage.DefaultMaxInflatedTaskSize), nil}
 	return &t
 }
 
@@ -59,11 +70,40 @@ func (tt *Task) SetMaxFileSize(max int64) {
 	tt.maxFileSize = max
 }
 
+// SetInflateLimits overrides the default limits on the decompressed size of
+// each test file, and the total decompressed size for the task.
+func (tt *Task) SetInflateLimits(maxTest, maxTotal int64) {
+	tt.inflate = storage.NewInflateBudget(maxTest, maxTotal)
+}
+
+// SetFinisher sets a Finisher to be called when ProcessAllTests completes.
+func (tt *Task) SetFinisher(f Finisher) {
+	tt.finisher = f
+}
+
 // ProcessAllTests loops through all the tests in a tar file, calls the
 // injected parser to parse them, and inserts them into bigquery. Returns the
 // number of files processed.
-// TODO pass in the datatype label.
+// If there is a Finisher, it is passed the task result, and the task fails
+// if the rows cannot be committed.
 func (tt *Task) ProcessAllTests() (int, error) {
+	files, err := tt.processAllTests()
+	if tt.finisher == nil {
+		return files, err
+	}
+	finishErr := tt.finisher.Finish(err)
+	if finishErr != nil {
+		log.Printf("filename:%s finish err:%v", tt.meta["filename"], finishErr)
+		if err == nil {
+			err = finishErr
+		}
+	}
+	return files, err
+}
+
+// processAllTests does the work of ProcessAllTests.
+// TODO pass in the datatype label.
+func (tt *Task) processAllTests() (int, error) {
 	if tt.Parser == nil {
 		panic("Parser is nil")
 	}
@@ -119,7 +159,31 @@ OUTER:
 			// If verbose, log the filename that is skipped.
 			continue
 		}
-		kind, parsable := tt.Parser.IsParsable(testname, data)
+		// Decompress the test file, so that parsers only see raw content.
+		compressedSize := len(data)
+		var kindName string
+		var compression storage.Compression
+		var nErr error
+		// The stripped name is only used to detect the test type.  Parsers
+		// get the original name, which is part of the test_id and insert IDs.
+		kindName, data, compression, nErr = storage.NormalizeTest(testname, data, tt.inflate)
+		if nErr != nil {
+			log.Printf("filename:%s testname:%s files:%d, err:%v",
+				tt.meta["filename"], testname, files, nErr)
+			if storage.IsOversizeInflated(nErr) {
+				metrics.TestCount.WithLabelValues(
+					tt.Type(), "unknown", "oversize inflated").Inc()
+			} else {
+				metrics.TestCount.WithLabelValues(
+					tt.Type(), "unknown", "decompression error").Inc()
+			}
+			continue
+		}
+		kind, parsable := tt.Parser.IsParsable(kindName, data)
+		if compression != storage.NoCompression {
+			metrics.FileSizeHistogram.WithLabelValues(
+				tt.Type(), kind, "compressed").Observe(float64(compressedSize))
+		}
 		if !parsable {
 			metrics.FileSizeHistogram.WithLabelValues(
 				tt.Type(), kind, "ignored").Observe(float64(len(data)))
@@ -5,12 +5,14 @@ package task_test
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/klauspost/compress/zstd"
 
 	"time"
 
@@ -69,6 +71,7 @@ func MakeTestSource(t *testing.T) etl.TestSource {
 type TestParser struct {
 	parser.FakeRowStats
 	files []string
+	data  []string
 }
 
 func (tp *TestParser) IsParsable(testName string, test []byte) (string, bool) {
@@ -91,6 +94,7 @@ func (tp *TestParser) TaskError() error {
 // TODO - pass testName through to BQ inserter?
 func (tp *TestParser) ParseAndInsert(meta map[string]bigquery.Value, testName string, test []byte) error {
 	tp.files = append(tp.files, testName)
+	tp.data = append(tp.data, string(test))
 	return nil
 }
 
@@ -188,3 +192,84 @@ func TestTarFileInput(t *testing.T) {
 	}
 
 }
+
+func TestCompressedTests(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("biscuits"))
+	zw.Close()
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"foo.json.gz", gz.Bytes()},
+		{"bar.jsonl.zst", enc.EncodeAll([]byte("butter milk"), nil)},
+		{"bomb.zst", enc.EncodeAll(make([]byte, 10000), nil)},
+		{"baz", []byte("gravy")},
+	}
+	b := new(bytes.Buffer)
+	tw := tar.NewWriter(b)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0666, Typeflag: tar.TypeReg, Size: int64(len(f.data))})
+		tw.Write(f.data)
+	}
+	tw.Close()
+	rdr := &storage.GCSSource{TarReader: tar.NewReader(b), Closer: NullCloser{}, RetryBaseTime: time.Millisecond}
+
+	tp := &TestParser{}
+	tt := task.NewTask("filename", rdr, tp)
+	tt.SetInflateLimits(1000, 1000000)
+	fc, err := tt.ProcessAllTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc != 4 {
+		t.Error("Expected 4 files: ", fc)
+	}
+	// The bomb should be skipped, and the others decompressed, but passed to
+	// the parser with their original names.
+	if !reflect.DeepEqual(tp.files, []string{"foo.json.gz", "bar.jsonl.zst", "baz"}) {
+		t.Error("Not expected files: ", tp.files)
+	}
+	if !reflect.DeepEqual(tp.data, []string{"biscuits", "butter milk", "gravy"}) {
+		t.Error("Not expected data: ", tp.data)
+	}
+}
+
+type fakeFinisher struct {
+	calls int
+	err   error // Task error passed to Finish.
+	fail  error // Error returned by Finish.
+}
+
+func (ff *fakeFinisher) Finish(err error) error {
+	ff.calls++
+	ff.err = err
+	return ff.fail
+}
+
+func TestFinisher(t *testing.T) {
+	ff := &fakeFinisher{}
+	tt := task.NewTask("filename", MakeTestSource(t), &TestParser{})
+	tt.SetMaxFileSize(100)
+	tt.SetFinisher(ff)
+	if _, err := tt.ProcessAllTests(); err != nil {
+		t.Error("Expected nil error, but got ", err)
+	}
+	if ff.calls != 1 || ff.err != nil {
+		t.Error("Finish should be called once with nil error: ", ff.calls, ff.err)
+	}
+
+	// The task should fail if the rows cannot be committed.
+	ff = &fakeFinisher{fail: errors.New("commit failed")}
+	tt = task.NewTask("filename", MakeTestSource(t), &TestParser{})
+	tt.SetMaxFileSize(100)
+	tt.SetFinisher(ff)
+	if _, err := tt.ProcessAllTests(); err != ff.fail {
+		t.Error("Expected commit failed, but got ", err)
+	}
+}
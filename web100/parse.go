@@ -42,6 +42,19 @@ func ParseWeb100Definitions(tcpKis io.Reader) (map[string]string, error) {
 	return legacyNamesToNewNames, nil
 }
 
+// parseVariableNames returns the canonical names of all web100 variables
+// defined in tcpKis.
+func parseVariableNames(tcpKis []byte) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range strings.Split(string(tcpKis), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "VariableName:" {
+			names[fields[1]] = true
+		}
+	}
+	return names
+}
+
 // ParseIPFamily determines whether an IP string is v4 or v6
 func ParseIPFamily(ipStr string) int64 {
 	ip := net.ParseIP(ipStr)
@@ -16,10 +16,8 @@ import (
 //  be true across all NDT snaplogs.  The invariants are checked, and if they are
 //  not actually true, we should see errors in processing our archives.
 //
-// TODO
-//  With the new parser, it is now (probably) easy to identify where a log is
-//  corrupted, and possibly make use of all the snapshots up to that point.
-//  We probably should take advantage of this somehow.
+//  When a log is corrupted or truncated, Salvage can be used to keep all the
+//  valid snapshots up to the point of corruption.
 //
 // Terminology:
 //   Snapshot: a single Web100 snapshot.
@@ -91,6 +89,16 @@ type Saver interface {
 // This is exported so that SideStream parser can use it easily.
 var CanonicalNames map[string]string
 
+// variableNames is the set of canonical web100 variable names.
+var variableNames map[string]bool
+
+// IsVariable returns true if name is a web100 variable, by either its
+// canonical or legacy name.
+func IsVariable(name string) bool {
+	_, legacy := CanonicalNames[name]
+	return variableNames[name] || legacy
+}
+
 func init() {
 	data, err := Asset("tcp-kis.txt")
 	if err != nil {
@@ -102,6 +110,7 @@ func init() {
 	if err != nil {
 		panic("error parsing tcp-kis.txt")
 	}
+	variableNames = parseVariableNames(data)
 }
 
 //=================================================================================
@@ -286,10 +295,16 @@ type fieldSet struct {
 	Length int
 }
 
-// find returns the variable spec of a given name, or nil.
+// find returns the variable spec of a given name, or nil.  The name may be
+// either the name used in the snaplog, or the canonical name.
 func (fs *fieldSet) find(name string) *Variable {
 	index, ok := fs.FieldMap[name]
 	if !ok {
+		for i := range fs.Fields {
+			if CanonicalNames[fs.Fields[i].Name] == name {
+				return &fs.Fields[i]
+			}
+		}
 		return nil
 	}
 	return &fs.Fields[index]
@@ -353,6 +368,23 @@ func (sl *SnapLog) SnapshotNumFields() int {
 	return len(sl.read.Fields)
 }
 
+// FieldNames returns the canonical names of the snapshot fields, in the
+// order they appear in each snapshot.  Deprecated fields are omitted.
+func (sl *SnapLog) FieldNames() []string {
+	names := make([]string, 0, len(sl.read.Fields))
+	for _, field := range sl.read.Fields {
+		if field.Name[0] == '_' {
+			continue
+		}
+		name := field.Name
+		if canonical, ok := CanonicalNames[name]; ok {
+			name = canonical
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
 // parseFields parses the newline separated web100 variable types from the header.
 func parseFields(buf *bytes.Buffer, preamble string, terminator string) (*fieldSet, error) {
 	fields := new(fieldSet)
@@ -522,6 +554,48 @@ func (sl *SnapLog) ValidateSnapshots() error {
 	return nil
 }
 
+// ValidSnapCount returns the number of consecutive valid snapshots, starting
+// with the first, and an error describing the first problem found, if any.
+// A trailing partial snapshot is reported as an error, but the complete
+// snapshots before it are counted.
+func (sl *SnapLog) ValidSnapCount() (int, error) {
+	count := sl.SnapCount()
+	for i := 0; i < count; i++ {
+		_, err := sl.Snapshot(i)
+		if err != nil {
+			return i, fmt.Errorf("snapshot %d: %v", i, err)
+		}
+	}
+	total := len(sl.raw) - sl.bodyOffset
+	if total%sl.read.Length != 0 {
+		return count, errors.New("last snapshot truncated")
+	}
+	return count, nil
+}
+
+// Salvage discards the first corrupted snapshot and everything after it,
+// including any trailing partial snapshot, so that all remaining snapshots
+// are valid, and ValidateSnapshots succeeds.  It returns the number of
+// snapshots kept and the number of snapshots discarded, counting a trailing
+// partial snapshot as discarded, so dropped is non-zero whenever any data was
+// trimmed.  If there are no valid snapshots, it returns an error and leaves
+// the SnapLog unchanged.
+func (sl *SnapLog) Salvage() (int, int, error) {
+	before := sl.SnapCount()
+	if (len(sl.raw)-sl.bodyOffset)%sl.read.Length != 0 {
+		before++
+	}
+	valid, err := sl.ValidSnapCount()
+	if err == nil {
+		return valid, 0, nil
+	}
+	if valid == 0 {
+		return 0, before, err
+	}
+	sl.raw = sl.raw[:sl.bodyOffset+valid*sl.read.Length]
+	return valid, before - valid, nil
+}
+
 //=================================================================================
 
 // Snapshot represents a complete snapshot from a snapshot log.
@@ -1,6 +1,7 @@
 package web100_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -214,6 +215,114 @@ func TestChangeIndices(t *testing.T) {
 	log.Printf("count: %d\n", len(x))
 }
 
+func TestFieldNames(t *testing.T) {
+	c2sName := `20170509T13:45:13.590210000Z_eb.measurementlab.net:48716.c2s_snaplog`
+	c2sData, err := ioutil.ReadFile(`testdata/` + c2sName)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	slog, err := web100.NewSnapLog(c2sData)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	names := slog.FieldNames()
+	if len(names) == 0 || len(names) > slog.SnapshotNumFields() {
+		t.Fatal("Wrong number of field names", len(names))
+	}
+
+	// Every name should be populated by SnapshotValues.
+	snap, err := slog.Snapshot(0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	saver := NewSimpleSaver()
+	snap.SnapshotValues(saver)
+	for _, name := range names {
+		_, isInt := saver.Integers[name]
+		_, isString := saver.Strings[name]
+		if !isInt && !isString {
+			t.Error("Missing value for", name)
+		}
+	}
+}
+
+func TestSalvage(t *testing.T) {
+	c2sName := `20170509T13:45:13.590210000Z_eb.measurementlab.net:48716.c2s_snaplog`
+	c2sData, err := ioutil.ReadFile(`testdata/` + c2sName)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// An intact snaplog should be unchanged.
+	slog, err := web100.NewSnapLog(c2sData)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	total := slog.SnapCount()
+	kept, dropped, err := slog.Salvage()
+	if err != nil || kept != total || dropped != 0 {
+		t.Error("Intact snaplog should be unchanged", kept, dropped, err)
+	}
+
+	// Corrupt the BEGIN_SNAP_DATA marker of snapshot 100.
+	corrupt := append([]byte{}, c2sData...)
+	offset := 0
+	for i := 0; i <= 100; i++ {
+		next := bytes.Index(corrupt[offset:], []byte(web100.BEGIN_SNAP_DATA))
+		if next < 0 {
+			t.Fatal("Too few snapshots")
+		}
+		offset += next + 1
+	}
+	corrupt[offset] = 'X'
+	// Also truncate the last snapshot.
+	corrupt = corrupt[:len(corrupt)-10]
+
+	slog, err = web100.NewSnapLog(corrupt)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if slog.ValidateSnapshots() == nil {
+		t.Error("Corrupted snaplog should not validate")
+	}
+	valid, err := slog.ValidSnapCount()
+	if err == nil || valid != 100 {
+		t.Error("Expected 100 valid snapshots and an error", valid, err)
+	}
+	kept, dropped, err = slog.Salvage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The partial last snapshot counts as dropped.
+	if kept != 100 || dropped != total-100 {
+		t.Error("Wrong salvage counts", kept, dropped)
+	}
+	if slog.SnapCount() != 100 {
+		t.Error("Wrong SnapCount after salvage", slog.SnapCount())
+	}
+	if err := slog.ValidateSnapshots(); err != nil {
+		t.Error(err)
+	}
+
+	// A snaplog whose only problem is a partial last snapshot should have
+	// that snapshot trimmed, and report it as dropped.
+	slog, err = web100.NewSnapLog(c2sData[:len(c2sData)-10])
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	kept, dropped, err = slog.Salvage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept != total-1 || dropped != 1 {
+		t.Error("Wrong salvage counts for truncated snaplog", kept, dropped)
+	}
+	if err := slog.ValidateSnapshots(); err != nil {
+		t.Error(err)
+	}
+}
+
 // About 70 usec per test, independent of which field is used.
 func BenchmarkChangeIndices(b *testing.B) {
 	b.StopTimer()
@@ -279,3 +388,17 @@ func BenchmarkSaver(b *testing.B) {
 		v.Save(data, &ns)
 	}
 }
+
+func TestIsVariable(t *testing.T) {
+	for name, want := range map[string]bool{
+		"CongSignals":       true,
+		"CongestionSignals": true, // Legacy name.
+		"CurCwnd":           true,
+		"NoSuchField":       false,
+		"":                  false,
+	} {
+		if got := web100.IsVariable(name); got != want {
+			t.Errorf("IsVariable(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/task"
+)
+
+// ErrBadNotification is returned for a request that is not a GCS notification.
+var ErrBadNotification = errors.New("bad notification")
+
+// ObjectFinalize is the GCS notification event type for a new object.
+const ObjectFinalize = "OBJECT_FINALIZE"
+
+// DefaultNotificationTTL is how long a processed object is remembered, so
+// that duplicate notifications are ignored.  Pub/Sub retains unacknowledged
+// messages for at most 7 days, but duplicates usually arrive within minutes.
+const DefaultNotificationTTL = 24 * time.Hour
+
+// MaxAckDeadline is the longest ack deadline Pub/Sub allows for a push
+// subscription.  Archives that take longer to process are redelivered while
+// they are being processed.
+const MaxAckDeadline = 10 * time.Minute
+
+// pushRequest is the body of a Pub/Sub push request.  encoding/json decodes
+// the base64 message data.
+type pushRequest struct {
+	Message struct {
+		Attributes map[string]string `json:"attributes"`
+		Data       []byte            `json:"data"`
+		MessageID  string            `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// objectMetadata holds the fields used from the JSON_API_V1 payload of a GCS
+// notification.
+type objectMetadata struct {
+	Bucket     string `json:"bucket"`
+	Name       string `json:"name"`
+	Generation string `json:"generation"`
+}
+
+// Notification describes a GCS object notification.
+type Notification struct {
+	EventType  string
+	Bucket     string
+	Name       string
+	Generation string
+}
+
+// Path returns the gs:// uri of the object.
+func (n *Notification) Path() string {
+	return fmt.Sprintf("gs://%s/%s", n.Bucket, n.Name)
+}
+
+// key identifies a single version of the object.
+func (n *Notification) key() string {
+	return n.Path() + "#" + n.Generation
+}
+
+// DecodeNotification decodes a Pub/Sub push request body carrying a GCS
+// notification.  The bucket and object are taken from the message
+// attributes, or from the JSON payload if the attributes are missing.
+func DecodeNotification(body []byte) (*Notification, error) {
+	var req pushRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadNotification, err)
+	}
+	attrs := req.Message.Attributes
+	n := &Notification{
+		EventType:  attrs["eventType"],
+		Bucket:     attrs["bucketId"],
+		Name:       attrs["objectId"],
+		Generation: attrs["objectGeneration"],
+	}
+	if (n.Bucket == "" || n.Name == "") && len(req.Message.Data) > 0 {
+		var md objectMetadata
+		if err := json.Unmarshal(req.Message.Data, &md); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadNotification, err)
+		}
+		n.Bucket, n.Name, n.Generation = md.Bucket, md.Name, md.Generation
+	}
+	if n.EventType == "" || n.Bucket == "" || n.Name == "" {
+		return nil, fmt.Errorf("%w: message %q has no event type or object",
+			ErrBadNotification, req.Message.MessageID)
+	}
+	return n, nil
+}
+
+// NotificationHandler handles Pub/Sub push requests carrying GCS
+// OBJECT_FINALIZE notifications, and processes each new archive.
+//
+// The response status tells Pub/Sub whether to redeliver the message.
+// Success, and failures that would recur, are acknowledged with a 2xx status.
+// These include invalid filenames, and task errors with a 4xx status other
+// than 429, such as corrupt archives (422) and missing objects (404).
+// Transient failures return the task's 5xx or 429 status, so the message is
+// redelivered later.
+//
+// The archive is processed within the push request, so the subscription's ack
+// deadline should be set to MaxAckDeadline.  If processing takes longer, the
+// message is redelivered while the archive is still being processed.  Such
+// redeliveries are rejected with a 429 status, so that the message is not
+// lost if processing then fails, and are acknowledged once it succeeds.
+//
+// Duplicate notifications for an object that was recently processed are
+// acknowledged without processing the object again.  This only covers a
+// single instance, so rows may still be duplicated when several workers
+// share a subscription.
+// It is THREAD-SAFE.
+type NotificationHandler struct {
+	factory task.Factory
+	types   map[etl.DataType]bool // If empty, all valid datatypes are processed.
+	ttl     time.Duration
+
+	lock   sync.Mutex
+	active map[string]bool      // Objects being processed.
+	done   map[string]time.Time // When each object finished processing.
+}
+
+// NewNotificationHandler creates a NotificationHandler that processes
+// archives of the given datatypes, or all valid datatypes if none are given.
+func NewNotificationHandler(tf task.Factory, types ...etl.DataType) *NotificationHandler {
+	nh := &NotificationHandler{factory: tf, types: map[etl.DataType]bool{},
+		ttl: DefaultNotificationTTL, active: map[string]bool{}, done: map[string]time.Time{}}
+	for _, t := range types {
+		nh.types[t] = true
+	}
+	return nh
+}
+
+// start marks the object active.  If it is already active, or was processed
+// within the TTL, it returns the reason the object should be ignored.
+func (nh *NotificationHandler) start(key string) (reason string, ok bool) {
+	nh.lock.Lock()
+	defer nh.lock.Unlock()
+	if nh.active[key] {
+		return "InProgress", false
+	}
+	if t, ok := nh.done[key]; ok && time.Since(t) < nh.ttl {
+		return "Duplicate", false
+	}
+	nh.active[key] = true
+	return "", true
+}
+
+// finish clears the active object, and records it as done unless it should
+// be retried.
+func (nh *NotificationHandler) finish(key string, retry bool) {
+	nh.lock.Lock()
+	defer nh.lock.Unlock()
+	delete(nh.active, key)
+	if retry {
+		return
+	}
+	now := time.Now()
+	for k, t := range nh.done {
+		if now.Sub(t) >= nh.ttl {
+			delete(nh.done, k)
+		}
+	}
+	nh.done[key] = now
+}
+
+// isRetryable returns true for status codes that indicate a transient
+// failure.
+func isRetryable(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// ignore acknowledges a notification that will not be processed.
+func ignore(w http.ResponseWriter, dataType, reason string) {
+	metrics.NotificationCount.WithLabelValues(dataType, reason).Inc()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeHTTP implements http.Handler.
+func (nh *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"message": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, `{"message": "Could not read request"}`, http.StatusBadRequest)
+		return
+	}
+	n, err := DecodeNotification(body)
+	if err != nil {
+		// A malformed request indicates a misconfigured subscription, so it
+		// is rejected, and left to the subscription's dead letter policy.
+		log.Println(err)
+		metrics.NotificationCount.WithLabelValues("unknown", "BadRequest").Inc()
+		http.Error(w, `{"message": "Invalid notification."}`, http.StatusBadRequest)
+		return
+	}
+	if n.EventType != ObjectFinalize {
+		ignore(w, "unknown", "IgnoredEvent")
+		return
+	}
+	path, err := etl.ValidateTestPath(n.Path())
+	if err != nil {
+		log.Printf("Ignoring notification: %v", err)
+		ignore(w, "unknown", "InvalidFilename")
+		return
+	}
+	dataType := path.GetDataType()
+	if dataType == etl.INVALID || (len(nh.types) > 0 && !nh.types[dataType]) {
+		ignore(w, path.DataType, "IgnoredDataType")
+		return
+	}
+	key := n.key()
+	if reason, ok := nh.start(key); !ok {
+		log.Printf("Ignoring notification for %s: %s", key, reason)
+		if reason == "InProgress" {
+			// The ack deadline expired, but the first delivery may yet fail.
+			metrics.NotificationCount.WithLabelValues(path.DataType, reason).Inc()
+			http.Error(w, `{"message": "Already processing."}`, http.StatusTooManyRequests)
+			return
+		}
+		ignore(w, path.DataType, reason)
+		return
+	}
+
+	log.Println("Processing", key)
+	start := time.Now()
+	pErr := ProcessGKETask(path, nh.factory)
+	if d := time.Since(start); d > MaxAckDeadline {
+		log.Printf("Processing %s took %v, longer than the ack deadline", key, d)
+		metrics.NotificationCount.WithLabelValues(path.DataType, "AckDeadlineExceeded").Inc()
+	}
+	if pErr == nil {
+		nh.finish(key, false)
+		metrics.NotificationCount.WithLabelValues(path.DataType, "ok").Inc()
+		fmt.Fprint(w, `{"message": "Success"}`)
+		return
+	}
+	retry := isRetryable(pErr.Code())
+	nh.finish(key, retry)
+	log.Printf("Processing %s failed (retry: %v): %v", key, retry, pErr)
+	if retry {
+		metrics.NotificationCount.WithLabelValues(path.DataType, "Retry").Inc()
+		w.WriteHeader(pErr.Code())
+	} else {
+		metrics.NotificationCount.WithLabelValues(path.DataType, "Failed").Inc()
+		w.WriteHeader(http.StatusOK)
+	}
+	fmt.Fprintf(w, `{"message": "%s"}`, pErr.Error())
+}
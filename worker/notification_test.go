@@ -0,0 +1,219 @@
+package worker_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/m-lab/etl/etl"
+	"github.com/m-lab/etl/factory"
+	"github.com/m-lab/etl/fake"
+	"github.com/m-lab/etl/metrics"
+	"github.com/m-lab/etl/task"
+	"github.com/m-lab/etl/worker"
+)
+
+const notifyBucket = "test-bucket"
+const notifyObject = "ndt/ndt5/2019/12/01/20191201T020011.395772Z-ndt5-mlab1-bcn01-ndt.tgz"
+
+// pushBody returns a Pub/Sub push request body for a GCS notification.
+func pushBody(eventType, bucket, object string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"attributes": map[string]string{
+				"eventType":        eventType,
+				"bucketId":         bucket,
+				"objectId":         object,
+				"objectGeneration": "1575165611395772",
+				"payloadFormat":    "JSON_API_V1",
+			},
+			"data":      base64.StdEncoding.EncodeToString([]byte(`{"kind": "storage#object"}`)),
+			"messageId": "12345",
+		},
+		"subscription": "projects/mlab-sandbox/subscriptions/etl-ndt5",
+	})
+	return body
+}
+
+// resetMetrics resets the metrics checked by other tests.
+func resetMetrics() {
+	metrics.FileCount.Reset()
+	metrics.TaskCount.Reset()
+	metrics.TestCount.Reset()
+}
+
+func post(h http.Handler, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/notification", bytes.NewReader(body)))
+	return w
+}
+
+// failingTaskFactory fails every task with the given status code.
+type failingTaskFactory struct {
+	lock  sync.Mutex
+	calls int
+	code  int
+}
+
+func (f *failingTaskFactory) Get(ctx context.Context, dp etl.DataPath) (*task.Task, etl.ProcessingError) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls++
+	return nil, factory.NewError(dp.DataType, "fake", f.code, errors.New("task failed"))
+}
+
+func TestDecodeNotification(t *testing.T) {
+	n, err := worker.DecodeNotification(pushBody(worker.ObjectFinalize, notifyBucket, notifyObject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.EventType != worker.ObjectFinalize || n.Path() != "gs://"+notifyBucket+"/"+notifyObject {
+		t.Error("Wrong notification:", n)
+	}
+
+	// Without attributes, the object comes from the payload.
+	data := fmt.Sprintf(`{"bucket": %q, "name": %q, "generation": "1"}`, notifyBucket, notifyObject)
+	body := fmt.Sprintf(`{"message": {"attributes": {"eventType": %q}, "data": %q}}`,
+		worker.ObjectFinalize, base64.StdEncoding.EncodeToString([]byte(data)))
+	n, err = worker.DecodeNotification([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Path() != "gs://"+notifyBucket+"/"+notifyObject || n.Generation != "1" {
+		t.Error("Wrong notification:", n)
+	}
+
+	for _, bad := range []string{"", "{}", `{"message": {"attributes": {"eventType": "OBJECT_FINALIZE"}}}`} {
+		if _, err := worker.DecodeNotification([]byte(bad)); !errors.Is(err, worker.ErrBadNotification) {
+			t.Errorf("DecodeNotification(%q) error = %v", bad, err)
+		}
+	}
+}
+
+func TestNotificationHandler(t *testing.T) {
+	defer resetMetrics()
+	up := fake.NewFakeUploader()
+	tf := worker.StandardTaskFactory{
+		Annotator: &fakeAnnotatorFactory{},
+		Sink:      &fakeSinkFactory{up: up},
+		Source:    NewSourceFactory(),
+	}
+	nh := worker.NewNotificationHandler(&tf, etl.NDT5)
+
+	w := post(nh, pushBody(worker.ObjectFinalize, notifyBucket, notifyObject))
+	if w.Code != http.StatusOK {
+		t.Fatal("Expected", http.StatusOK, "got", w.Code, w.Body.String())
+	}
+	if up.Total != 478 {
+		t.Error("Expected 478 tests, got", up.Total)
+	}
+
+	// Duplicates are acknowledged, but not processed again.
+	w = post(nh, pushBody(worker.ObjectFinalize, notifyBucket, notifyObject))
+	if w.Code != http.StatusNoContent || up.Total != 478 {
+		t.Error("Duplicate should be ignored:", w.Code, up.Total)
+	}
+}
+
+func TestNotificationHandlerIgnored(t *testing.T) {
+	tf := &failingTaskFactory{code: http.StatusInternalServerError}
+	nh := worker.NewNotificationHandler(tf, etl.NDT5)
+	tests := []struct {
+		name   string
+		body   []byte
+		status int
+	}{
+		{"malformed", []byte("not json"), http.StatusBadRequest},
+		{"delete", pushBody("OBJECT_DELETE", notifyBucket, notifyObject), http.StatusNoContent},
+		{"bad-path", pushBody(worker.ObjectFinalize, notifyBucket, "ndt/foobar.tgz"), http.StatusNoContent},
+		{"other-type", pushBody(worker.ObjectFinalize, notifyBucket,
+			"ndt/tcpinfo/2019/12/01/20191201T020011.395772Z-tcpinfo-mlab1-bcn01-ndt.tgz"), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := post(nh, tt.body); w.Code != tt.status {
+				t.Errorf("Status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+	if tf.calls != 0 {
+		t.Error("Ignored notifications should not be processed")
+	}
+
+	w := httptest.NewRecorder()
+	nh.ServeHTTP(w, httptest.NewRequest("GET", "/notification", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("Expected", http.StatusMethodNotAllowed, "got", w.Code)
+	}
+}
+
+// blockingTaskFactory blocks each task until released, then fails it.
+type blockingTaskFactory struct {
+	started, release chan struct{}
+}
+
+func (f *blockingTaskFactory) Get(ctx context.Context, dp etl.DataPath) (*task.Task, etl.ProcessingError) {
+	f.started <- struct{}{}
+	<-f.release
+	return nil, factory.NewError(dp.DataType, "fake", http.StatusServiceUnavailable, errors.New("task failed"))
+}
+
+func TestNotificationHandlerInProgress(t *testing.T) {
+	defer resetMetrics()
+	tf := &blockingTaskFactory{started: make(chan struct{}), release: make(chan struct{})}
+	nh := worker.NewNotificationHandler(tf)
+	first := make(chan int)
+	go func() {
+		first <- post(nh, pushBody(worker.ObjectFinalize, notifyBucket, notifyObject)).Code
+	}()
+	<-tf.started
+
+	// A redelivery while the object is processed is not acknowledged, so the
+	// message is not lost if processing fails.
+	if w := post(nh, pushBody(worker.ObjectFinalize, notifyBucket, notifyObject)); w.Code != http.StatusTooManyRequests {
+		t.Error("Expected", http.StatusTooManyRequests, "got", w.Code)
+	}
+	close(tf.release)
+	if code := <-first; code != http.StatusServiceUnavailable {
+		t.Error("Expected", http.StatusServiceUnavailable, "got", code)
+	}
+}
+
+func TestNotificationHandlerFailures(t *testing.T) {
+	defer resetMetrics()
+	tests := []struct {
+		name   string
+		code   int
+		status int // Response status for each delivery.
+		calls  int // Tasks started after two deliveries.
+	}{
+		// Transient failures are redelivered, and processed again.
+		{"retry", http.StatusServiceUnavailable, http.StatusServiceUnavailable, 2},
+		{"throttled", http.StatusTooManyRequests, http.StatusTooManyRequests, 2},
+		// Permanent failures are acknowledged, and not processed again.
+		{"permanent", http.StatusBadRequest, http.StatusOK, 1},
+		{"corrupt", http.StatusUnprocessableEntity, http.StatusOK, 1},
+		{"missing", http.StatusNotFound, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tf := &failingTaskFactory{code: tt.code}
+			nh := worker.NewNotificationHandler(tf)
+			w := post(nh, pushBody(worker.ObjectFinalize, notifyBucket, notifyObject))
+			if w.Code != tt.status {
+				t.Errorf("Status = %d, want %d", w.Code, tt.status)
+			}
+			post(nh, pushBody(worker.ObjectFinalize, notifyBucket, notifyObject))
+			if tf.calls != tt.calls {
+				t.Errorf("Tasks = %d, want %d", tf.calls, tt.calls)
+			}
+		})
+	}
+}
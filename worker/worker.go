@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -88,6 +89,13 @@ func ProcessTestSource(src etl.TestSource, path etl.DataPath) (int, error) {
 
 	dataType := path.GetDataType()
 
+	// Tests from sites embargoed by the privacy policy are never parsed.
+	if policy := parser.PrivacyPolicy(dataType); policy != nil && policy.DropSite(path.Site) {
+		metrics.TaskCount.WithLabelValues(string(dataType), "PrivacyDropped").Inc()
+		log.Println("Dropping", src.Detail(), "from embargoed site", path.Site)
+		return http.StatusOK, nil
+	}
+
 	dateFormat := "20060102"
 	date, err := time.Parse(dateFormat, path.PackedDate)
 
@@ -119,14 +127,14 @@ func ProcessTestSource(src etl.TestSource, path etl.DataPath) (int, error) {
 	metrics.WorkerState.WithLabelValues(label, "finish").Inc()
 	defer metrics.WorkerState.WithLabelValues(label, "finish").Dec()
 	if err != nil {
-		metrics.TaskCount.WithLabelValues(string(dataType), "TaskError").Inc()
+		detail, code := taskErrorStatus(err)
+		metrics.TaskCount.WithLabelValues(string(dataType), detail).Inc()
 		log.Printf("Error Processing Tests:  %v", err)
 		// NOTE: This may cause indefinite retries, and stalled task queue.
 		//  Task will eventually expire, but it might be better to have a
 		// different mechanism for retries, particularly for gardener, which
 		// waits for empty task queue.
-		return http.StatusInternalServerError, err
-		// TODO - anything better we could do here?
+		return code, err
 	}
 
 	metrics.TaskCount.WithLabelValues(string(dataType), "OK").Inc()
@@ -170,9 +178,24 @@ func (tf *StandardTaskFactory) Get(ctx context.Context, dp etl.DataPath) (*task.
 	}
 
 	tsk := task.NewTask(dp.URI, src, p)
+	// Sinks that hold rows until the task completes must be told the result.
+	if f, ok := sink.(task.Finisher); ok {
+		tsk.SetFinisher(f)
+	}
 	return tsk, nil
 }
 
+// taskErrorStatus returns the metric detail and http status for a task that
+// failed with err.  A corrupt archive fails the same way every time, so it is
+// reported with a 4xx status, and not retried.  Other failures, such as GCS
+// or BigQuery errors, are reported as server errors.
+func taskErrorStatus(err error) (string, int) {
+	if errors.Is(err, storage.ErrCorruptArchive) {
+		return "CorruptArchive", http.StatusUnprocessableEntity
+	}
+	return "TaskError", http.StatusInternalServerError
+}
+
 // ProcessGKETask interprets a filename to create a Task, Parser, and Inserter,
 // and processes the file content.
 // Used default BQ Sink, and GCS Source.
@@ -218,11 +241,10 @@ func DoGKETask(tsk *task.Task, path etl.DataPath) etl.ProcessingError {
 		date.Weekday().String()).Add(float64(files))
 
 	if err != nil {
-		metrics.TaskCount.WithLabelValues(path.DataType, "TaskError").Inc()
+		detail, code := taskErrorStatus(err)
+		metrics.TaskCount.WithLabelValues(path.DataType, detail).Inc()
 		log.Printf("Error Processing Tests:  %v", err)
-		return factory.NewError(
-			path.DataType, "TaskError", http.StatusInternalServerError, err)
-		// TODO - anything better we could do here?
+		return factory.NewError(path.DataType, detail, code, err)
 	}
 
 	// NOTE: In the k8s parsers, there are huge spikes in the task rate.
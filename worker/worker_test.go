@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"cloud.google.com/go/civil"
 	"cloud.google.com/go/storage"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
@@ -23,12 +24,14 @@ import (
 	"github.com/m-lab/go/cloud/bqx"
 	"github.com/m-lab/go/rtx"
 
+	"github.com/m-lab/etl/active"
 	"github.com/m-lab/etl/bq"
 	"github.com/m-lab/etl/etl"
 	"github.com/m-lab/etl/factory"
 	"github.com/m-lab/etl/fake"
 	"github.com/m-lab/etl/metrics"
 	"github.com/m-lab/etl/row"
+	etlstorage "github.com/m-lab/etl/storage"
 	"github.com/m-lab/etl/worker"
 
 	"github.com/fsouza/fake-gcs-server/fakestorage"
@@ -254,3 +257,52 @@ func TestProcessGKETask(t *testing.T) {
 	metrics.TaskCount.Reset()
 	metrics.TestCount.Reset()
 }
+
+// corruptSource returns a few tests, and then a corrupt archive error.
+type corruptSource struct {
+	tests int
+}
+
+func (cs *corruptSource) NextTest(maxSize int64) (string, []byte, error) {
+	if cs.tests == 0 {
+		return "", nil, fmt.Errorf("%w: unexpected EOF", etlstorage.ErrCorruptArchive)
+	}
+	cs.tests--
+	return fmt.Sprint("test-", cs.tests), nil, nil
+}
+func (cs *corruptSource) Close() error     { return nil }
+func (cs *corruptSource) Detail() string   { return "corrupt" }
+func (cs *corruptSource) Type() string     { return "ndt5" }
+func (cs *corruptSource) Date() civil.Date { return civil.Date{Year: 2019, Month: 12, Day: 1} }
+
+type corruptSourceFactory struct{}
+
+func (sf *corruptSourceFactory) Get(ctx context.Context, dp etl.DataPath) (etl.TestSource, etl.ProcessingError) {
+	return &corruptSource{tests: 3}, nil
+}
+
+func TestProcessGKETaskCorrupt(t *testing.T) {
+	defer func() {
+		metrics.FileCount.Reset()
+		metrics.TaskCount.Reset()
+		metrics.TestCount.Reset()
+	}()
+	fakeFactory := worker.StandardTaskFactory{
+		Annotator: &fakeAnnotatorFactory{},
+		Sink:      &fakeSinkFactory{up: fake.NewFakeUploader()},
+		Source:    &corruptSourceFactory{},
+	}
+	path, err := etl.ValidateTestPath(
+		"gs://test-bucket/ndt/ndt5/2019/12/01/20191201T020011.395772Z-ndt5-mlab1-bcn01-ndt.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A corrupt archive is a permanent failure, so it must not be retried.
+	pErr := worker.ProcessGKETask(path, &fakeFactory)
+	if pErr == nil || pErr.Code() != http.StatusUnprocessableEntity {
+		t.Fatal("Expected error with", http.StatusUnprocessableEntity, "Got:", pErr)
+	}
+	if active.IsRetryable(pErr) {
+		t.Error("Corrupt archive should not be retryable")
+	}
+}